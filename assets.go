@@ -0,0 +1,58 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/thousandeyes/shoelaces/internal/environment"
+)
+
+const assetsUsage = `usage: shoelaces assets sync [parameters]
+
+Takes the same parameters as the server, e.g. -data-dir and -assets-dir.
+`
+
+// assetsCommand downloads the files of the assets listed in assets.yaml
+// into assets-dir and verifies them, printing their state. It exits with an
+// error if any of them is not available.
+func assetsCommand(args []string) {
+	if len(args) == 0 || args[0] != "sync" {
+		fmt.Fprint(os.Stderr, assetsUsage)
+		os.Exit(2)
+	}
+
+	env := environment.Load(args[1:])
+	if env.Assets == nil {
+		env.Logger.Info("no assets to sync", "component", "assets", "dir", env.DataDir)
+		return
+	}
+	err := env.Assets.Sync(context.Background())
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ASSET\tFILE\tSTATE\tSIZE\tSHA256")
+	for _, s := range env.Assets.Status() {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", s.Asset, s.Kind, s.State, s.Size, s.SHA256)
+	}
+	w.Flush()
+
+	if err != nil {
+		env.Logger.Error("assets sync failed", "component", "assets", "err", err)
+		os.Exit(1)
+	}
+}
@@ -3,3 +3,8 @@ module github.com/thousandeyes/shoelaces
 go 1.22
 
 require gopkg.in/yaml.v3 v3.0.1
+
+require (
+	golang.org/x/crypto v0.33.0
+	golang.org/x/sys v0.30.0 // indirect
+)
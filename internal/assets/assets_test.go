@@ -0,0 +1,269 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package assets
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/thousandeyes/shoelaces/internal/log"
+)
+
+const (
+	kernelData = "kernel-data"
+	initrdData = "initrd-data"
+)
+
+func sum(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+// testServer is a stub serving the files of the assets, counting the
+// requests. Requests wait for release, if not nil.
+type testServer struct {
+	*httptest.Server
+	requests atomic.Int32
+	release  chan struct{}
+}
+
+func newTestServer(t *testing.T, release chan struct{}) *testServer {
+	s := &testServer{release: release}
+	files := map[string]string{"/vmlinuz": kernelData, "/initrd.img": initrdData}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		if s.release != nil {
+			<-s.release
+		}
+		contents, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, contents)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func testCatalog(base string) []Asset {
+	return []Asset{{
+		Name:    "linux-amd64",
+		OS:      "linux",
+		Version: "1.0",
+		Arch:    "amd64",
+		Kernel:  &File{URL: base + "/vmlinuz", SHA256: sum(kernelData)},
+		Initrd:  &File{URL: base + "/initrd.img", SHA256: sum(initrdData)},
+	}}
+}
+
+func newTestStore(t *testing.T, dir string, catalog []Asset) *Store {
+	s, err := New(log.MakeLogger(io.Discard), dir, catalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func get(s *Store, p string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/assets/"+p, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	http.StripPrefix("/assets/", s).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestParseCatalog(t *testing.T) {
+	valid := "assets:\n" +
+		"  - name: flatcar-stable-amd64\n" +
+		"    os: flatcar\n" +
+		"    version: 4081.2.0\n" +
+		"    arch: amd64\n" +
+		"    kernel:\n" +
+		"      url: https://example.com/vmlinuz\n" +
+		"      sha256: " + sum("kernel") + "\n"
+	catalog, err := ParseCatalog([]byte(valid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(catalog) != 1 || catalog[0].Version != "4081.2.0" || catalog[0].Kernel.SHA256 != sum("kernel") || catalog[0].Initrd != nil {
+		t.Errorf("Expected: the flatcar asset\nGot: %+v", catalog)
+	}
+
+	for _, invalid := range []string{
+		"assets: [{name: a}]",
+		"assets: [{name: a/b, kernel: {url: 'http://a/k', sha256: " + sum("k") + "}}]",
+		"assets: [{name: a, kernel: {url: 'ftp://a/k', sha256: " + sum("k") + "}}]",
+		"assets: [{name: a, kernel: {url: 'http://a/k'}}]",
+		"assets: [{name: a, kernel: {url: 'http://a/k', sha256: abc}}]",
+		"assets: [{name: a, kernel: {url: 'http://a/k', sha256: " + sum("k") + "}}, {name: a, initrd: {url: 'http://a/i', sha256: " + sum("i") + "}}]",
+	} {
+		if _, err := ParseCatalog([]byte(invalid)); err == nil {
+			t.Errorf("Expected an error for %s", invalid)
+		}
+	}
+
+	if catalog, err := LoadCatalog(filepath.Join(t.TempDir(), CatalogFile)); err != nil || catalog != nil {
+		t.Errorf("Expected: no assets without catalog\nGot: %v %v", catalog, err)
+	}
+}
+
+func TestAssetURL(t *testing.T) {
+	s := newTestStore(t, t.TempDir(), testCatalog("http://example.com"))
+	if u, err := s.AssetURL("linux-amd64", Initrd); err != nil || u != "/assets/linux-amd64/initrd" {
+		t.Errorf("Expected: /assets/linux-amd64/initrd\nGot: %q %v", u, err)
+	}
+	if _, err := s.AssetURL("linux-amd64", "rootfs"); err == nil {
+		t.Error("Expected an error for an unknown kind of file")
+	}
+	var none *Store
+	if _, err := none.AssetURL("linux-amd64", Kernel); err == nil {
+		t.Error("Expected an error without assets")
+	}
+}
+
+func TestSync(t *testing.T) {
+	srv := newTestServer(t, nil)
+	dir := t.TempDir()
+	s := newTestStore(t, dir, testCatalog(srv.URL))
+
+	for _, st := range s.Status() {
+		if st.State != Pending {
+			t.Errorf("Expected: pending\nGot: %s", st.State)
+		}
+	}
+	if err := s.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, st := range s.Status() {
+		if st.State != Verified || st.Size != int64(len(kernelData)) {
+			t.Errorf("Expected: verified %d bytes\nGot: %s %d", len(kernelData), st.State, st.Size)
+		}
+	}
+	if n := srv.requests.Load(); n != 2 {
+		t.Errorf("Expected: 2 downloads\nGot: %d", n)
+	}
+
+	// Other processes loading the configuration leave running downloads
+	// alone, and restarting removes the interrupted ones.
+	partial := filepath.Join(dir, "tmp", "download-1")
+	os.WriteFile(partial, []byte("kernel"), 0644)
+	if _, err := New(log.MakeLogger(io.Discard), dir, testCatalog(srv.URL)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(partial); err != nil {
+		t.Errorf("Expected: the download left alone\nGot: %v", err)
+	}
+
+	// Restarting verifies the stored files, downloading the corrupted ones.
+	os.WriteFile(filepath.Join(dir, sum(initrdData)), []byte("corrupted"), 0644)
+	s = newTestStore(t, dir, testCatalog(srv.URL))
+	if _, err := os.Stat(partial); !os.IsNotExist(err) {
+		t.Errorf("Expected: the interrupted download removed\nGot: %v", err)
+	}
+	if err := s.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.requests.Load(); n != 3 {
+		t.Errorf("Expected: 3 downloads\nGot: %d", n)
+	}
+	contents, _ := os.ReadFile(filepath.Join(dir, sum(initrdData)))
+	if string(contents) != initrdData {
+		t.Errorf("Expected: %s\nGot: %s", initrdData, contents)
+	}
+}
+
+func TestSyncFailures(t *testing.T) {
+	srv := newTestServer(t, nil)
+	dir := t.TempDir()
+	catalog := testCatalog(srv.URL)
+	catalog[0].Kernel.SHA256 = sum("other kernel")
+	catalog[0].Initrd.URL = srv.URL + "/missing"
+	s := newTestStore(t, dir, catalog)
+
+	err := s.Sync(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected: checksum and 404 errors\nGot: %v", err)
+	}
+	for _, st := range s.Status() {
+		if st.State != Failed || st.Error == "" {
+			t.Errorf("Expected: failed with an error\nGot: %s %q", st.State, st.Error)
+		}
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) != 1 {
+		t.Errorf("Expected: only the tmp dir\nGot: %v", files)
+	}
+	if rec := get(s, "linux-amd64/kernel"); rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected: 502\nGot: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestServe(t *testing.T) {
+	release := make(chan struct{})
+	srv := newTestServer(t, release)
+	s := newTestStore(t, t.TempDir(), testCatalog(srv.URL))
+
+	// Concurrent requests share the download of missing files.
+	var wg sync.WaitGroup
+	recs := make([]*httptest.ResponseRecorder, 5)
+	for i := range recs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			recs[i] = get(s, "linux-amd64/kernel")
+		}(i)
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	for _, rec := range recs {
+		if rec.Code != http.StatusOK || rec.Body.String() != kernelData {
+			t.Errorf("Expected: 200 %s\nGot: %d %s", kernelData, rec.Code, rec.Body)
+		}
+	}
+	if n := srv.requests.Load(); n != 1 {
+		t.Errorf("Expected: 1 download\nGot: %d", n)
+	}
+
+	rec := get(s, "linux-amd64/kernel", "Range", "bytes=0-5")
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != kernelData[:6] {
+		t.Errorf("Expected: 206 %s\nGot: %d %s", kernelData[:6], rec.Code, rec.Body)
+	}
+	rec = get(s, "linux-amd64/kernel", "If-None-Match", `"`+sum(kernelData)+`"`)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("Expected: 304\nGot: %d", rec.Code)
+	}
+	for _, p := range []string{"linux-amd64", "linux-amd64/rootfs", "other/kernel", "linux-amd64/kernel/x"} {
+		if rec := get(s, p); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected: 404 for %s\nGot: %d", p, rec.Code)
+		}
+	}
+}
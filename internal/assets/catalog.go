@@ -0,0 +1,132 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package assets
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CatalogFile is the file, in the data dir, listing the boot assets.
+const CatalogFile = "assets.yaml"
+
+// Kinds of the files of an asset.
+const (
+	Kernel = "kernel"
+	Initrd = "initrd"
+)
+
+var (
+	nameRegex     = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	checksumRegex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+)
+
+// File is a file of an asset, pinned to its SHA-256.
+type File struct {
+	URL    string `yaml:"url" json:"url"`
+	SHA256 string `yaml:"sha256" json:"sha256"`
+}
+
+// Asset is a named set of boot files, such as the kernel and initrd of an
+// operating system release.
+type Asset struct {
+	Name    string `yaml:"name" json:"name"`
+	OS      string `yaml:"os" json:"os"`
+	Version string `yaml:"version" json:"version"`
+	Arch    string `yaml:"arch" json:"arch"`
+	Kernel  *File  `yaml:"kernel" json:"kernel,omitempty"`
+	Initrd  *File  `yaml:"initrd" json:"initrd,omitempty"`
+}
+
+// File returns the file of the given kind, or nil if the asset doesn't
+// have it.
+func (a *Asset) File(kind string) *File {
+	switch kind {
+	case Kernel:
+		return a.Kernel
+	case Initrd:
+		return a.Initrd
+	}
+	return nil
+}
+
+type catalog struct {
+	Assets []Asset `yaml:"assets"`
+}
+
+// LoadCatalog reads the assets listed in a catalog file. A missing file
+// lists no assets.
+func LoadCatalog(file string) ([]Asset, error) {
+	contents, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParseCatalog(contents)
+}
+
+// ParseCatalog parses and validates the contents of a catalog file.
+func ParseCatalog(contents []byte) ([]Asset, error) {
+	var c catalog
+	if err := yaml.Unmarshal(contents, &c); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, a := range c.Assets {
+		if !nameRegex.MatchString(a.Name) {
+			return nil, fmt.Errorf("invalid asset name %q", a.Name)
+		}
+		if seen[a.Name] {
+			return nil, fmt.Errorf("duplicate asset %s", a.Name)
+		}
+		seen[a.Name] = true
+		if a.Kernel == nil && a.Initrd == nil {
+			return nil, fmt.Errorf("asset %s: no kernel or initrd", a.Name)
+		}
+		for _, kind := range []string{Kernel, Initrd} {
+			if f := a.File(kind); f != nil {
+				if err := f.validate(); err != nil {
+					return nil, fmt.Errorf("asset %s: %s: %w", a.Name, kind, err)
+				}
+			}
+		}
+	}
+	return c.Assets, nil
+}
+
+func (f *File) validate() error {
+	u, err := url.Parse(f.URL)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid URL %q, only http and https are supported", f.URL)
+	}
+	if f.SHA256 == "" {
+		return errors.New("missing sha256")
+	}
+	if !checksumRegex.MatchString(f.SHA256) {
+		return fmt.Errorf("invalid sha256 %q", f.SHA256)
+	}
+	return nil
+}
@@ -0,0 +1,376 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package assets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thousandeyes/shoelaces/internal/fetch"
+	"github.com/thousandeyes/shoelaces/internal/log"
+)
+
+// State is the state of a file of an asset.
+type State string
+
+// States of the files of the assets.
+const (
+	Pending     State = "pending"
+	Verifying   State = "verifying"
+	Downloading State = "downloading"
+	Verified    State = "verified"
+	Failed      State = "failed"
+)
+
+// file holds the state of a stored file, shared by the assets having the
+// same SHA-256.
+type file struct {
+	state State
+	size  int64 // Bytes verified or downloaded so far
+	total int64 // -1 if unknown
+	err   error
+	done  chan struct{} // Closed when the running check ends, nil if none
+}
+
+// FileStatus is the state of a file of an asset, for the web frontend, the
+// API and the sync command.
+type FileStatus struct {
+	Asset   string `json:"asset"`
+	OS      string `json:"os"`
+	Version string `json:"version"`
+	Arch    string `json:"arch"`
+	Kind    string `json:"kind"`
+	File
+	State State  `json:"state"`
+	Size  int64  `json:"size"`
+	Total int64  `json:"total"`
+	Error string `json:"error,omitempty"`
+}
+
+// Store keeps the files of the assets of the catalog in a directory, named
+// after their SHA-256. Files are only served once verified.
+type Store struct {
+	dir     string
+	catalog []Asset
+	client  *http.Client
+	logger  log.Logger
+
+	mu    sync.Mutex
+	files map[string]*file // By SHA-256
+}
+
+// New returns a store keeping the files of catalog in dir, which is
+// created when the first file is downloaded. Files are checked and
+// downloaded by Sync, or when they are first requested.
+func New(logger log.Logger, dir string, catalog []Asset) (*Store, error) {
+	s := &Store{
+		dir:     dir,
+		catalog: catalog,
+		client:  fetch.NewClient(),
+		logger:  logger,
+		files:   make(map[string]*file),
+	}
+	for _, a := range catalog {
+		for _, kind := range []string{Kernel, Initrd} {
+			if f := a.File(kind); f != nil {
+				s.files[f.SHA256] = &file{state: Pending, total: -1}
+			}
+		}
+	}
+	return s, nil
+}
+
+// lookup returns the file of the given kind of an asset.
+func (s *Store) lookup(name, kind string) (*File, error) {
+	if s != nil {
+		for i := range s.catalog {
+			if s.catalog[i].Name != name {
+				continue
+			}
+			if f := s.catalog[i].File(kind); f != nil {
+				return f, nil
+			}
+			return nil, fmt.Errorf("asset %s has no %s", name, kind)
+		}
+	}
+	return nil, fmt.Errorf("unknown asset %q", name)
+}
+
+// AssetURL is the asset template function. It returns the path the file
+// of the given kind of an asset is served at, e.g.
+//
+//	kernel {{ asset "flatcar-stable-amd64" "kernel" }}
+//
+// iPXE resolves it against the URL of the script.
+func (s *Store) AssetURL(name, kind string) (string, error) {
+	if _, err := s.lookup(name, kind); err != nil {
+		return "", fmt.Errorf("asset: %w", err)
+	}
+	return "/assets/" + name + "/" + kind, nil
+}
+
+// Status returns the state of the files of every asset, in catalog order.
+func (s *Store) Status() []FileStatus {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ret []FileStatus
+	for _, a := range s.catalog {
+		for _, kind := range []string{Kernel, Initrd} {
+			f := a.File(kind)
+			if f == nil {
+				continue
+			}
+			st := s.files[f.SHA256]
+			fs := FileStatus{
+				Asset:   a.Name,
+				OS:      a.OS,
+				Version: a.Version,
+				Arch:    a.Arch,
+				Kind:    kind,
+				File:    *f,
+				State:   st.state,
+				Size:    st.size,
+				Total:   st.total,
+			}
+			if st.err != nil && st.state == Failed {
+				fs.Error = st.err.Error()
+			}
+			ret = append(ret, fs)
+		}
+	}
+	return ret
+}
+
+// Sync checks the stored files of every asset, downloading the ones
+// missing or not matching their SHA-256.
+func (s *Store) Sync(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	var errs []error
+	for _, a := range s.catalog {
+		for _, kind := range []string{Kernel, Initrd} {
+			f := a.File(kind)
+			if f == nil {
+				continue
+			}
+			if err := s.ensure(ctx, *f); err != nil {
+				errs = append(errs, fmt.Errorf("%s %s: %w", a.Name, kind, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Prepare removes the files of the downloads interrupted by a restart. Only
+// the process serving the assets calls it, as other ones may be
+// downloading meanwhile.
+func (s *Store) Prepare() error {
+	if s == nil {
+		return nil
+	}
+	return os.RemoveAll(filepath.Join(s.dir, "tmp"))
+}
+
+// Prefetch syncs the assets in the background.
+func (s *Store) Prefetch() {
+	if s == nil {
+		return
+	}
+	go func() {
+		if err := s.Sync(context.Background()); err != nil {
+			s.logger.Error("assets prefetch failed", "component", "assets", "err", err)
+			return
+		}
+		s.logger.Info("assets prefetched", "component", "assets", "assets", len(s.catalog))
+	}()
+}
+
+func (s *Store) path(checksum string) string {
+	return filepath.Join(s.dir, checksum)
+}
+
+// ensure waits until f is stored and verified, checking or downloading it
+// if needed. Checks are shared by concurrent callers and aren't canceled
+// with ctx.
+func (s *Store) ensure(ctx context.Context, f File) error {
+	s.mu.Lock()
+	st := s.files[f.SHA256]
+	if st.state == Verified {
+		s.mu.Unlock()
+		return nil
+	}
+	done := st.done
+	if done == nil {
+		done = make(chan struct{})
+		st.done = done
+		go s.check(f, st)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st.state == Verified {
+		return nil
+	}
+	return st.err
+}
+
+// check verifies the stored file, downloading it again if it's missing or
+// doesn't match its SHA-256.
+func (s *Store) check(f File, st *file) {
+	err := s.verify(f, st)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			s.logger.Error("stored asset is invalid", "component", "assets", "sha256", f.SHA256, "err", err)
+		}
+		err = s.download(f, st)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st.err = err
+	st.state = Verified
+	if err != nil {
+		st.state = Failed
+		s.logger.Error("asset download failed", "component", "assets", "url", f.URL, "err", err)
+	} else {
+		s.logger.Info("asset verified", "component", "assets", "url", f.URL, "sha256", f.SHA256)
+	}
+	close(st.done)
+	st.done = nil
+}
+
+func (s *Store) setState(st *file, state State, size, total int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st.state, st.size, st.total = state, size, total
+}
+
+// verify hashes the stored file, removing it if it doesn't match.
+func (s *Store) verify(f File, st *file) error {
+	in, err := os.Open(s.path(f.SHA256))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	s.setState(st, Verifying, 0, info.Size())
+
+	sum, _, err := fetch.Checksum(in, s.progress(st), 0)
+	if err != nil {
+		return err
+	}
+	if sum != f.SHA256 {
+		os.Remove(in.Name())
+		return fmt.Errorf("checksum mismatch, expected %s, got %s", f.SHA256, sum)
+	}
+	return nil
+}
+
+// download downloads the file into the store, verifying its SHA-256.
+func (s *Store) download(f File, st *file) error {
+	s.setState(st, Downloading, 0, -1)
+	req, err := http.NewRequest(http.MethodGet, f.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := fetch.Get(s.client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server answered %s", resp.Status)
+	}
+	s.setState(st, Downloading, 0, resp.ContentLength)
+
+	tmp, _, _, err := resp.Save(filepath.Join(s.dir, "tmp"), fetch.Options{SHA256: f.SHA256, Progress: s.progress(st)})
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path(f.SHA256)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// progress returns a function setting the bytes of st checked so far.
+func (s *Store) progress(st *file) func(int64) {
+	return func(size int64) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		st.size = size
+	}
+}
+
+// ServeHTTP serves the files of the assets, once verified. The path of the
+// request is the name of the asset followed by the kind of file, e.g.
+// flatcar-stable-amd64/kernel.
+func (s *Store) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, kind, ok := strings.Cut(r.URL.Path, "/")
+	if !ok {
+		http.Error(w, "Unknown asset", http.StatusNotFound)
+		return
+	}
+	f, err := s.lookup(name, kind)
+	if err != nil {
+		http.Error(w, "Unknown asset", http.StatusNotFound)
+		return
+	}
+	if err := s.ensure(r.Context(), *f); err != nil {
+		if r.Context().Err() == nil {
+			http.Error(w, "Asset not available: "+err.Error(), http.StatusBadGateway)
+		}
+		return
+	}
+
+	in, err := os.Open(s.path(f.SHA256))
+	if err != nil {
+		// The file was removed behind our back, check it again next time.
+		s.logger.Error("open asset failed", "component", "assets", "asset", name, "err", err)
+		s.mu.Lock()
+		if st := s.files[f.SHA256]; st.done == nil {
+			st.state, st.err = Failed, err
+		}
+		s.mu.Unlock()
+		http.Error(w, "Asset not available", http.StatusServiceUnavailable)
+		return
+	}
+	defer in.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", `"`+f.SHA256+`"`)
+	http.ServeContent(w, r, "", time.Time{}, in)
+}
@@ -0,0 +1,366 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package butane
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/thousandeyes/shoelaces/internal/ignition"
+)
+
+// versions holds the Ignition spec version of each Butane spec version, by
+// variant.
+var versions = map[string]map[string]string{
+	"fcos": {
+		"1.0.0": "3.0.0",
+		"1.1.0": "3.1.0",
+		"1.2.0": "3.2.0",
+		"1.3.0": "3.2.0",
+		"1.4.0": "3.3.0",
+		"1.5.0": "3.4.0",
+		"1.6.0": "3.5.0",
+	},
+	"flatcar": {
+		"1.0.0": "3.3.0",
+		"1.1.0": "3.4.0",
+	},
+}
+
+// unsupported holds the Butane fields needing files or sugar Shoelaces
+// doesn't provide, with the reason.
+var unsupported = map[string]string{
+	"local":                     "files can't be read from Shoelaces",
+	"contents_local":            "files can't be read from Shoelaces",
+	"ssh_authorized_keys_local": "files can't be read from Shoelaces",
+	"trees":                     "directories can't be read from Shoelaces",
+	"with_mount_unit":           "write the mount unit in systemd.units",
+	"boot_device":               "write the partitions and RAID arrays in storage",
+	"grub":                      "write the GRUB config in storage.files",
+}
+
+// maxNodes is the maximum number of YAML nodes of a config, with the ones
+// of aliases counted each time they're used.
+const maxNodes = 100000
+
+// camelCase holds the Ignition names of the Butane fields not following the
+// snake_case to camelCase rule.
+var camelCase = map[string]string{
+	"size_mib":  "sizeMiB",
+	"start_mib": "startMiB",
+}
+
+// Error lists the problems found in a Butane config, with their line.
+type Error struct {
+	Errors []string
+}
+
+func (e *Error) Error() string {
+	return "invalid Butane config:\n" + strings.Join(e.Errors, "\n")
+}
+
+// Transpile returns the Ignition config of a Butane config. Inline
+// contents are turned into data URLs, and the result is validated against
+// the Ignition spec version of the Butane spec version. Errors are *Error,
+// reporting the line and Butane path of every problem found.
+func Transpile(config []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(config, &doc); err != nil {
+		return nil, &Error{Errors: yamlErrors(err)}
+	}
+	if len(doc.Content) == 0 {
+		return nil, &Error{Errors: []string{"line 1: empty config"}}
+	}
+
+	t := &transpiler{fields: make(map[string]location), anchors: make(map[*yaml.Node]bool)}
+	root := doc.Content[0]
+	c, ok := t.convert(root, "", "").(map[string]interface{})
+	if !ok {
+		return nil, &Error{Errors: []string{fmt.Sprintf("line %d: the config must be a mapping", root.Line)}}
+	}
+	t.setVersion(c, root.Line)
+	if len(t.errs) > 0 {
+		return nil, &Error{Errors: t.errs}
+	}
+
+	out, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	// Unknown fields are mistakes in Butane, their names are all known
+	// to the transpiler.
+	warns, err := ignition.Validate(out)
+	if err != nil {
+		var vErr *ignition.ValidationError
+		if !errors.As(err, &vErr) {
+			return nil, err
+		}
+		return nil, &Error{Errors: t.locate(append(vErr.Errors, warns...))}
+	}
+	if len(warns) > 0 {
+		return nil, &Error{Errors: t.locate(warns)}
+	}
+	return append(out, '\n'), nil
+}
+
+var yamlLineRegex = regexp.MustCompile(`^(?:yaml: )?line (\d+): `)
+
+func yamlErrors(err error) []string {
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		return typeErr.Errors
+	}
+	msg := err.Error()
+	if m := yamlLineRegex.FindStringSubmatch(msg); m != nil {
+		return []string{"line " + m[1] + ": " + msg[len(m[0]):]}
+	}
+	return []string{strings.TrimPrefix(msg, "yaml: ")}
+}
+
+// location is where a field of the Ignition config comes from.
+type location struct {
+	line int
+	path string // Butane path
+}
+
+type transpiler struct {
+	fields  map[string]location // By Ignition path
+	errs    []string
+	anchors map[*yaml.Node]bool // Anchored nodes being converted
+	nodes   int
+}
+
+func (t *transpiler) errorf(line int, p string, format string, args ...interface{}) {
+	t.errs = append(t.errs, fmt.Sprintf("line %d: %s: ", line, p)+fmt.Sprintf(format, args...))
+}
+
+func join(p, key string) string {
+	if p == "" {
+		return key
+	}
+	return p + "." + key
+}
+
+// convert returns the value of a YAML node, with the Ignition names of
+// its fields. p and bp are its Ignition and Butane paths.
+func (t *transpiler) convert(n *yaml.Node, p, bp string) interface{} {
+	t.nodes++
+	if t.nodes > maxNodes {
+		if t.nodes == maxNodes+1 {
+			t.errorf(n.Line, bp, "more than %d nodes, with the ones of aliases", maxNodes)
+		}
+		return nil
+	}
+	t.fields[p] = location{line: n.Line, path: bp}
+	if n.Anchor != "" {
+		t.anchors[n] = true
+		defer delete(t.anchors, n)
+	}
+	switch n.Kind {
+	case yaml.AliasNode:
+		if t.anchors[n.Alias] {
+			t.errorf(n.Line, bp, "alias %q is used inside its own node", n.Value)
+			return nil
+		}
+		return t.convert(n.Alias, p, bp)
+	case yaml.MappingNode:
+		m := make(map[string]interface{}, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			key := k.Value
+			switch {
+			case k.Tag != "!!str":
+				t.errorf(k.Line, bp, "field names must be strings, not %q", key)
+				continue
+			case unsupported[key] != "":
+				t.errorf(k.Line, join(bp, key), "not supported, %s", unsupported[key])
+				continue
+			case strings.IndexFunc(key, unicode.IsUpper) >= 0:
+				t.errorf(k.Line, join(bp, key), "unknown field")
+				continue
+			}
+			name := ignitionName(key)
+			value := t.convert(v, join(p, name), join(bp, key))
+			t.fields[join(p, name)] = location{line: k.Line, path: join(bp, key)}
+			m[name] = value
+		}
+		if _, ok := m["inline"]; ok {
+			t.inline(m, p, bp)
+		}
+		return m
+	case yaml.SequenceNode:
+		l := make([]interface{}, len(n.Content))
+		for i, item := range n.Content {
+			l[i] = t.convert(item, fmt.Sprintf("%s[%d]", p, i), fmt.Sprintf("%s[%d]", bp, i))
+		}
+		return l
+	case yaml.ScalarNode:
+		var v interface{}
+		if err := n.Decode(&v); err != nil {
+			t.errorf(n.Line, bp, "%v", err)
+			return nil
+		}
+		switch v := v.(type) {
+		case int:
+			return json.Number(strconv.Itoa(v))
+		case float64:
+			return json.Number(strconv.FormatFloat(v, 'f', -1, 64))
+		}
+		return v
+	}
+	return nil
+}
+
+// inline turns the inline contents of a resource into a data URL source.
+func (t *transpiler) inline(m map[string]interface{}, p, bp string) {
+	loc := t.fields[join(p, "inline")]
+	if m["source"] != nil {
+		t.errorf(loc.line, bp, "inline and source can't both be set")
+		return
+	}
+	s, ok := m["inline"].(string)
+	if !ok && m["inline"] != nil {
+		t.errorf(loc.line, loc.path, "must be a string")
+		return
+	}
+	delete(m, "inline")
+	if ok {
+		m["source"] = dataURL(s)
+		t.fields[join(p, "source")] = loc
+	}
+}
+
+// setVersion replaces the Butane variant and version of a config with the
+// Ignition spec version.
+func (t *transpiler) setVersion(c map[string]interface{}, line int) {
+	variant, _ := c["variant"].(string)
+	version, _ := c["version"].(string)
+	delete(c, "variant")
+	delete(c, "version")
+
+	vLine := line
+	if loc, ok := t.fields["variant"]; ok {
+		vLine = loc.line
+	}
+	variants, ok := versions[variant]
+	if !ok {
+		variantNames := make([]string, 0, len(versions))
+		for v := range versions {
+			variantNames = append(variantNames, strconv.Quote(v))
+		}
+		sort.Strings(variantNames)
+		t.errorf(vLine, "variant", "must be one of %s", strings.Join(variantNames, ", "))
+		return
+	}
+	if loc, ok := t.fields["version"]; ok {
+		vLine = loc.line
+	}
+	ignitionVersion, ok := variants[version]
+	if !ok {
+		t.errorf(vLine, "version", "unsupported %s version %q", variant, version)
+		return
+	}
+
+	ign, ok := c["ignition"].(map[string]interface{})
+	if !ok {
+		ign = make(map[string]interface{})
+		c["ignition"] = ign
+	}
+	if _, ok := ign["version"]; ok {
+		loc := t.fields["ignition.version"]
+		t.errorf(loc.line, loc.path, "unknown field, use variant and version")
+		return
+	}
+	ign["version"] = ignitionVersion
+}
+
+// locate prefixes Ignition validation errors with the line and Butane path
+// of their field, or of its closest parent for missing fields.
+func (t *transpiler) locate(errs []string) []string {
+	located := make([]string, len(errs))
+	for i, err := range errs {
+		p, msg, _ := strings.Cut(err, ": ")
+		missing := ""
+		for {
+			if loc, ok := t.fields[p]; ok {
+				located[i] = fmt.Sprintf("line %d: %s: %s", loc.line, loc.path+missing, msg)
+				break
+			}
+			cut := strings.LastIndexAny(p, ".[")
+			if cut < 0 {
+				located[i] = "line 1: " + err
+				break
+			}
+			missing = snakeCase(p[cut:]) + missing
+			p = p[:cut]
+		}
+	}
+	return located
+}
+
+// ignitionName returns the Ignition name of a Butane field.
+func ignitionName(key string) string {
+	if name, ok := camelCase[key]; ok {
+		return name
+	}
+	parts := strings.Split(key, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// snakeCase returns the Butane name of an Ignition field.
+func snakeCase(name string) string {
+	for key, n := range camelCase {
+		if n == strings.TrimPrefix(name, ".") {
+			return strings.Replace(name, n, key, 1)
+		}
+	}
+	var b strings.Builder
+	for _, r := range name {
+		if unicode.IsUpper(r) {
+			b.WriteByte('_')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// dataURL returns a data URL with the given contents, percent-encoded.
+func dataURL(s string) string {
+	var b strings.Builder
+	b.WriteString("data:,")
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-._~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,119 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package butane
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTranspile(t *testing.T) {
+	config := `variant: flatcar
+version: 1.0.0
+passwd:
+  users:
+    - name: core
+      ssh_authorized_keys:
+        - ssh-ed25519 AAAA
+storage:
+  files:
+    - path: /etc/hostname
+      mode: 0644
+      contents:
+        inline: node1
+    - path: /etc/motd
+      append:
+        - inline: "Hello, world!\n"
+  disks:
+    - device: /dev/sda
+      partitions:
+        - label: root
+          size_mib: 0
+systemd:
+  units:
+    - name: etcd.service
+      enabled: true
+kernel_arguments:
+  should_exist:
+    - quiet
+`
+	want := `{
+  "ignition": {"version": "3.3.0"},
+  "kernelArguments": {"shouldExist": ["quiet"]},
+  "passwd": {"users": [{"name": "core", "sshAuthorizedKeys": ["ssh-ed25519 AAAA"]}]},
+  "storage": {
+    "disks": [{"device": "/dev/sda", "partitions": [{"label": "root", "sizeMiB": 0}]}],
+    "files": [
+      {"path": "/etc/hostname", "mode": 420, "contents": {"source": "data:,node1"}},
+      {"path": "/etc/motd", "append": [{"source": "data:,Hello%2C%20world%21%0A"}]}
+    ]
+  },
+  "systemd": {"units": [{"name": "etcd.service", "enabled": true}]}
+}`
+
+	out, err := Transpile([]byte(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, expected interface{}
+	json.Unmarshal(out, &got)
+	json.Unmarshal([]byte(want), &expected)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected: %s\nGot: %s", want, out)
+	}
+}
+
+func TestTranspileErrors(t *testing.T) {
+	for _, c := range []struct {
+		config string
+		errors []string
+	}{
+		{"variant: fcos\nversion: 1.0.0\nstorage: [\n", []string{"line 3: did not find expected node content"}},
+		{"variant: rhcos\nversion: 1.0.0\n", []string{`line 1: variant: must be one of "fcos", "flatcar"`}},
+		{"variant: flatcar\nversion: 1.9.0\n", []string{`line 2: version: unsupported flatcar version "1.9.0"`}},
+		{"variant: fcos\nversion: 1.0.0\nignition:\n  version: 3.0.0\n", []string{"line 4: ignition.version: unknown field, use variant and version"}},
+		{"variant: fcos\nversion: 1.0.0\nstorage:\n  trees:\n    - local: a\n  files:\n    - path: /a\n      contents:\n        inline: a\n        source: https://a\n", []string{
+			"line 4: storage.trees: not supported, directories can't be read from Shoelaces",
+			"line 9: storage.files[0].contents: inline and source can't both be set",
+		}},
+		{"variant: fcos\nversion: 1.0.0\nstorage:\n  files:\n    - path: etc/a\n      mode: \"644\"\n      overwrite: true\n      contents:\n        compression: zip\n  filesystems:\n    - format: ext4\n      wipeFilesystem: true\nkernel_arguments:\n  should_exist: [a]\n", []string{
+			"line 12: storage.filesystems[0].wipeFilesystem: unknown field",
+		}},
+		{"variant: fcos\nversion: 1.0.0\nstorage:\n  files:\n    - path: etc/a\n      mode: \"644\"\n      contents:\n        compression: zip\n  filesystems:\n    - format: ext4\nkernel_arguments:\n  should_exist: [a]\n", []string{
+			"line 11: kernel_arguments: requires spec version 3.3.0 or later",
+			`line 8: storage.files[0].contents.compression: must be one of "gzip"`,
+			"line 6: storage.files[0].mode: must be an integer",
+			"line 5: storage.files[0].path: must be an absolute path",
+			"line 10: storage.filesystems[0].device: required",
+		}},
+		{"variant: fcos\nversion: 1.0.0\nboot_device:\n  mirror:\n    devices: [/dev/sda]\n", []string{
+			"line 3: boot_device: not supported, write the partitions and RAID arrays in storage",
+		}},
+		{"variant: fcos\nversion: 1.5.0\nstorage: &a\n  files: [*a]\n", []string{
+			`line 4: storage.files[0]: alias "a" is used inside its own node`,
+		}},
+		{"variant: fcos\nversion: 1.0.0\na: &a [x, x, x, x, x, x, x, x, x, x]\nb: &b [*a, *a, *a, *a, *a, *a, *a, *a, *a, *a]\nc: &c [*b, *b, *b, *b, *b, *b, *b, *b, *b, *b]\nd: &d [*c, *c, *c, *c, *c, *c, *c, *c, *c, *c]\ne: &e [*d, *d, *d, *d, *d, *d, *d, *d, *d, *d]\nf: [*e, *e, *e, *e, *e, *e, *e, *e, *e, *e]\n", []string{
+			"line 3: e[7][0][7][0][6]: more than 100000 nodes, with the ones of aliases",
+		}},
+	} {
+		_, err := Transpile([]byte(c.config))
+		var bErr *Error
+		if !errors.As(err, &bErr) || !reflect.DeepEqual(bErr.Errors, c.errors) {
+			t.Errorf("Expected: %q\nGot: %v", c.errors, err)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thousandeyes/shoelaces/internal/fetch"
+	"github.com/thousandeyes/shoelaces/internal/log"
+	"github.com/thousandeyes/shoelaces/internal/utils"
+)
+
+// ChecksumParam is the query parameter with the SHA-256 the cached file
+// must have.
+const ChecksumParam = "sha256"
+
+var (
+	mirrorNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+	checksumRegex   = regexp.MustCompile(`^[0-9a-f]{64}$`)
+)
+
+// Mirror is an upstream server whose files are cached under its name.
+type Mirror struct {
+	Name string
+	URL  string
+}
+
+// ParseMirrors receives a comma separated list of name=URL pairs and returns
+// the mirrors.
+func ParseMirrors(list string) ([]Mirror, error) {
+	var mirrors []Mirror
+	seen := make(map[string]bool)
+	for _, m := range strings.Split(list, ",") {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+		name, rawURL, ok := strings.Cut(m, "=")
+		if !ok || !mirrorNameRegex.MatchString(name) {
+			return nil, fmt.Errorf("invalid mirror %q, expected name=URL", m)
+		}
+		u, err := url.Parse(rawURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid mirror URL %q", rawURL)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate mirror %q", name)
+		}
+		seen[name] = true
+		mirrors = append(mirrors, Mirror{Name: name, URL: strings.TrimSuffix(rawURL, "/")})
+	}
+	return mirrors, nil
+}
+
+// entry is a cached file. Its metadata is kept next to it, so the index
+// survives restarts.
+type entry struct {
+	Key          string    `json:"key"`
+	URL          string    `json:"url"`
+	Size         int64     `json:"size"`
+	SHA256       string    `json:"sha256"`
+	ContentType  string    `json:"contentType"`
+	ETag         string    `json:"etag"`
+	LastModified string    `json:"lastModified"`
+	Fetched      time.Time `json:"fetched"`
+
+	used time.Time
+}
+
+// Cache is a caching proxy for the files of upstream mirrors, such as
+// installer kernels and initrds. Files are stored on disk, up to a maximum
+// size, evicting the least recently used first. Concurrent requests for a
+// file being downloaded share the download, and files requested with a
+// checksum are verified.
+type Cache struct {
+	dir     string
+	mirrors []Mirror
+	maxSize int64
+	ttl     time.Duration
+	client  *http.Client
+	logger  log.Logger
+
+	mu        sync.Mutex
+	entries   map[string]*entry
+	size      int64
+	downloads map[string]*download
+}
+
+// New returns a Cache storing up to maxSize bytes in dir. Cached files are
+// revalidated with their mirror after ttl, unless it's 0. The dir isn't
+// used until Prepare is called.
+func New(logger log.Logger, dir string, mirrors []Mirror, maxSize int64, ttl time.Duration) (*Cache, error) {
+	if maxSize <= 0 {
+		return nil, errors.New("cache size must be positive")
+	}
+	return &Cache{
+		dir:       dir,
+		mirrors:   mirrors,
+		maxSize:   maxSize,
+		ttl:       ttl,
+		client:    fetch.NewClient(),
+		logger:    logger,
+		entries:   make(map[string]*entry),
+		downloads: make(map[string]*download),
+	}, nil
+}
+
+// Prepare creates the cache dir, if needed, and loads the files already
+// there, evicting the ones over the size of the cache. Downloads
+// interrupted by a restart are started over, so only the process serving
+// the cache calls it.
+func (c *Cache) Prepare() error {
+	if c == nil {
+		return nil
+	}
+	for _, d := range []string{"data", "meta", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(c.dir, d), 0755); err != nil {
+			return err
+		}
+	}
+	tmp, err := os.ReadDir(filepath.Join(c.dir, "tmp"))
+	if err != nil {
+		return err
+	}
+	for _, t := range tmp {
+		os.Remove(filepath.Join(c.dir, "tmp", t.Name()))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.load(); err != nil {
+		return err
+	}
+	c.evict("")
+	return nil
+}
+
+func (c *Cache) load() error {
+	metas, err := os.ReadDir(filepath.Join(c.dir, "meta"))
+	if err != nil {
+		return err
+	}
+	for _, m := range metas {
+		id := strings.TrimSuffix(m.Name(), ".json")
+		contents, err := os.ReadFile(filepath.Join(c.dir, "meta", m.Name()))
+		if err != nil {
+			return err
+		}
+		e := &entry{}
+		if err := json.Unmarshal(contents, e); err != nil || fileID(e.Key) != id {
+			c.logger.Info("invalid cache entry removed", "component", "cache", "file", m.Name())
+			c.remove(id)
+			continue
+		}
+		info, err := os.Stat(c.dataPath(e.Key))
+		if err != nil || info.Size() != e.Size {
+			c.remove(id)
+			continue
+		}
+		e.used = info.ModTime()
+		c.entries[e.Key] = e
+		c.size += e.Size
+	}
+
+	// Files downloaded right before a restart may have no metadata.
+	data, err := os.ReadDir(filepath.Join(c.dir, "data"))
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(c.entries))
+	for key := range c.entries {
+		known[fileID(key)] = true
+	}
+	for _, f := range data {
+		if !known[f.Name()] {
+			os.Remove(filepath.Join(c.dir, "data", f.Name()))
+		}
+	}
+	return nil
+}
+
+// Size returns the number of cached files and their total size.
+func (c *Cache) Size() (int, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries), c.size
+}
+
+// fileID returns the name of the data and metadata files of a key.
+func fileID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *Cache) dataPath(key string) string {
+	return filepath.Join(c.dir, "data", fileID(key))
+}
+
+func (c *Cache) metaPath(key string) string {
+	return filepath.Join(c.dir, "meta", fileID(key)+".json")
+}
+
+func (c *Cache) remove(id string) {
+	os.Remove(filepath.Join(c.dir, "data", id))
+	os.Remove(filepath.Join(c.dir, "meta", id+".json"))
+}
+
+// store adds a downloaded file to the index, replacing the previous
+// version, if any, and evicts files if needed. It must be called with the
+// lock held.
+func (c *Cache) store(e *entry) {
+	if old, ok := c.entries[e.Key]; ok {
+		c.size -= old.Size
+	}
+	e.used = time.Now()
+	c.entries[e.Key] = e
+	c.size += e.Size
+	c.evict(e.Key)
+}
+
+// evict removes the least recently used files, but keep, until the cache
+// fits in its maximum size. It must be called with the lock held.
+func (c *Cache) evict(keep string) {
+	for c.size > c.maxSize {
+		var oldest *entry
+		for _, e := range c.entries {
+			if e.Key != keep && (oldest == nil || e.used.Before(oldest.used)) {
+				oldest = e
+			}
+		}
+		if oldest == nil {
+			return
+		}
+		c.logger.Debug("cache file evicted", "component", "cache", "url", oldest.URL, "size", oldest.Size)
+		c.remove(fileID(oldest.Key))
+		delete(c.entries, oldest.Key)
+		c.size -= oldest.Size
+	}
+}
+
+// upstream returns the upstream URL of a cached path, mirror name
+// included.
+func (c *Cache) upstream(p string) (string, string, bool) {
+	name, rest, _ := strings.Cut(p, "/")
+	clean := path.Clean("/" + rest)
+	if rest == "" || clean != "/"+rest {
+		return "", "", false
+	}
+	for _, m := range c.mirrors {
+		if m.Name == name {
+			return name + clean, m.URL + clean, true
+		}
+	}
+	return "", "", false
+}
+
+// CacheURL is a template function rewriting an upstream URL, or a prefix
+// of it, to its URL in the cache, built with the baseURL template variable,
+// e.g.:
+//
+//	set mirror {{ cacheURL . "http://archive.ubuntu.com/ubuntu" }}
+//	kernel {{ cacheURL . "https://example.com/vmlinuz" "<sha256>" }}
+//
+// The optional SHA-256 of the file is verified when downloading it. URLs of
+// unknown mirrors, and all of them if there is no Cache, are returned as
+// they are.
+func (c *Cache) CacheURL(params map[string]interface{}, upstreamURL string, checksum ...string) (string, error) {
+	if len(checksum) > 1 {
+		return "", errors.New("cacheURL: too many arguments")
+	}
+	if len(checksum) == 1 && !checksumRegex.MatchString(checksum[0]) {
+		return "", fmt.Errorf("cacheURL: invalid SHA-256 %q", checksum[0])
+	}
+	if c == nil {
+		return upstreamURL, nil
+	}
+	baseURL, ok := params["baseURL"].(string)
+	if !ok || baseURL == "" {
+		return "", errors.New("cacheURL: missing baseURL variable")
+	}
+
+	for _, m := range c.mirrors {
+		if upstreamURL != m.URL && !strings.HasPrefix(upstreamURL, m.URL+"/") {
+			continue
+		}
+		u, err := utils.BaseURLJoin(baseURL, "/cache/"+m.Name+strings.TrimPrefix(upstreamURL, m.URL))
+		if err != nil {
+			return "", fmt.Errorf("cacheURL: %v", err)
+		}
+		if len(checksum) == 1 {
+			query := u.Query()
+			query.Set(ChecksumParam, checksum[0])
+			u.RawQuery = query.Encode()
+		}
+		return u.String(), nil
+	}
+	return upstreamURL, nil
+}
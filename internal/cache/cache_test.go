@@ -0,0 +1,395 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/thousandeyes/shoelaces/internal/log"
+)
+
+// testUpstream is a mirror stub serving files, counting the requests.
+type testUpstream struct {
+	*httptest.Server
+	mu       sync.Mutex
+	files    map[string]string
+	requests atomic.Int32
+	release  chan struct{} // Blocks downloads halfway if not nil
+}
+
+func newTestUpstream(t *testing.T, files map[string]string) *testUpstream {
+	u := &testUpstream{files: files}
+	u.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u.requests.Add(1)
+		u.mu.Lock()
+		contents, ok := u.files[r.URL.Path]
+		release := u.release
+		u.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		etag := `"` + fmt.Sprint(len(contents)) + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Length", fmt.Sprint(len(contents)))
+		half := len(contents) / 2
+		io.WriteString(w, contents[:half])
+		if release != nil {
+			w.(http.Flusher).Flush()
+			<-release
+		}
+		io.WriteString(w, contents[half:])
+	}))
+	t.Cleanup(u.Close)
+	return u
+}
+
+func (u *testUpstream) set(name, contents string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.files[name] = contents
+}
+
+func newTestCache(t *testing.T, dir string, upstream *testUpstream, maxSize int64, ttl time.Duration) (*Cache, *httptest.Server) {
+	c, err := New(log.MakeLogger(io.Discard), dir, []Mirror{{Name: "mirror", URL: upstream.URL + "/pub"}}, maxSize, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.StripPrefix("/cache/", c))
+	t.Cleanup(srv.Close)
+	return c, srv
+}
+
+func get(rawURL string, header ...string) (int, string) {
+	req, _ := http.NewRequest(http.MethodGet, rawURL, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	// Failed downloads abort the connection.
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return -1, ""
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return -1, string(body)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func sum(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+func TestParseMirrors(t *testing.T) {
+	mirrors, err := ParseMirrors(" ubuntu=http://archive.ubuntu.com/ubuntu/ , flatcar=https://stable.release.flatcar-linux.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mirrors) != 2 || mirrors[0] != (Mirror{"ubuntu", "http://archive.ubuntu.com/ubuntu"}) || mirrors[1].Name != "flatcar" {
+		t.Errorf("Expected: ubuntu and flatcar mirrors\nGot: %v", mirrors)
+	}
+	for _, list := range []string{"ubuntu", "=http://a", "a/b=http://a", "a=ftp://a", "a=http://a,a=http://b"} {
+		if _, err := ParseMirrors(list); err == nil {
+			t.Errorf("Expected: error for %q\nGot: nil", list)
+		}
+	}
+}
+
+func TestCacheURL(t *testing.T) {
+	c := &Cache{mirrors: []Mirror{{Name: "ubuntu", URL: "http://archive.ubuntu.com/ubuntu"}}}
+	params := map[string]interface{}{"baseURL": "localhost:8081/env/prod"}
+	cases := map[string]string{
+		"http://archive.ubuntu.com/ubuntu":          "http://localhost:8081/env/prod/cache/ubuntu",
+		"http://archive.ubuntu.com/ubuntu/dists/a":  "http://localhost:8081/env/prod/cache/ubuntu/dists/a",
+		"http://archive.ubuntu.com/ubuntu-ports/a":  "http://archive.ubuntu.com/ubuntu-ports/a",
+		"https://mirror.example.com/ubuntu/dists/a": "https://mirror.example.com/ubuntu/dists/a",
+	}
+	for upstream, expected := range cases {
+		if got, err := c.CacheURL(params, upstream); err != nil || got != expected {
+			t.Errorf("Expected: %s\nGot: %s %v", expected, got, err)
+		}
+	}
+
+	checksum := sum("linux")
+	got, err := c.CacheURL(params, "http://archive.ubuntu.com/ubuntu/linux", checksum)
+	if expected := "http://localhost:8081/env/prod/cache/ubuntu/linux?sha256=" + checksum; err != nil || got != expected {
+		t.Errorf("Expected: %s\nGot: %s %v", expected, got, err)
+	}
+	if _, err := c.CacheURL(params, "http://archive.ubuntu.com/ubuntu/linux", "md5"); err == nil {
+		t.Error("Expected: error for an invalid checksum\nGot: nil")
+	}
+
+	var disabled *Cache
+	if got, err := disabled.CacheURL(params, "http://archive.ubuntu.com/ubuntu"); err != nil || got != "http://archive.ubuntu.com/ubuntu" {
+		t.Errorf("Expected: the upstream URL without cache\nGot: %s %v", got, err)
+	}
+}
+
+func TestCacheHit(t *testing.T) {
+	upstream := newTestUpstream(t, map[string]string{"/pub/linux": "kernel image"})
+	dir := t.TempDir()
+	c, srv := newTestCache(t, dir, upstream, 1024, 0)
+
+	for i := 0; i < 2; i++ {
+		status, body := get(srv.URL + "/cache/mirror/linux")
+		if status != http.StatusOK || body != "kernel image" {
+			t.Errorf("Expected: kernel image\nGot: %d %q", status, body)
+		}
+	}
+	if n := upstream.requests.Load(); n != 1 {
+		t.Errorf("Expected: a single upstream request\nGot: %d", n)
+	}
+	if files, size := c.Size(); files != 1 || size != int64(len("kernel image")) {
+		t.Errorf("Expected: a cached file\nGot: %d files, %d bytes", files, size)
+	}
+
+	status, body := get(srv.URL+"/cache/mirror/linux", "Range", "bytes=2-5")
+	if status != http.StatusPartialContent || body != "rnel" {
+		t.Errorf("Expected: 206 rnel\nGot: %d %q", status, body)
+	}
+
+	// The index survives restarts.
+	c, srv = newTestCache(t, dir, upstream, 1024, 0)
+	if status, body := get(srv.URL + "/cache/mirror/linux"); status != http.StatusOK || body != "kernel image" {
+		t.Errorf("Expected: kernel image\nGot: %d %q", status, body)
+	}
+	if n := upstream.requests.Load(); n != 1 {
+		t.Errorf("Expected: no upstream request after restart\nGot: %d", n)
+	}
+
+	for _, p := range []string{"/cache/unknown/linux", "/cache/mirror/", "/cache/mirror/a/../linux", "/cache/mirror/missing"} {
+		if status, _ := get(srv.URL + p); status != http.StatusNotFound {
+			t.Errorf("Expected: 404 for %s\nGot: %d", p, status)
+		}
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	dir := t.TempDir()
+	upstream := newTestUpstream(t, map[string]string{"/pub/linux": "kernel image"})
+	_, srv := newTestCache(t, dir, upstream, 1024, 0)
+	get(srv.URL + "/cache/mirror/linux")
+	partial := filepath.Join(dir, "tmp", "download-1")
+	if err := os.WriteFile(partial, []byte("kernel"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Other processes loading the configuration leave the dir alone.
+	c, err := New(log.MakeLogger(io.Discard), dir, nil, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(partial); err != nil {
+		t.Errorf("Expected: the download left alone\nGot: %v", err)
+	}
+	if files, _ := c.Size(); files != 0 {
+		t.Errorf("Expected: nothing loaded\nGot: %d files", files)
+	}
+
+	if err := c.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(partial); !os.IsNotExist(err) {
+		t.Errorf("Expected: the interrupted download removed\nGot: %v", err)
+	}
+	if files, _ := c.Size(); files != 0 {
+		t.Errorf("Expected: the file over the size of the cache evicted\nGot: %d files", files)
+	}
+}
+
+func TestConcurrentDownloads(t *testing.T) {
+	contents := strings.Repeat("initrd", 10000)
+	upstream := newTestUpstream(t, map[string]string{"/pub/initrd": contents})
+	upstream.release = make(chan struct{})
+	_, srv := newTestCache(t, t.TempDir(), upstream, 1<<20, 0)
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 5)
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			header := []string{}
+			if i == 0 {
+				header = []string{"Range", "bytes=0-5"}
+			}
+			_, bodies[i] = get(srv.URL+"/cache/mirror/initrd", header...)
+		}(i)
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(upstream.release)
+	wg.Wait()
+
+	if bodies[0] != "initrd" {
+		t.Errorf("Expected: the range of the file\nGot: %q", bodies[0])
+	}
+	for _, b := range bodies[1:] {
+		if b != contents {
+			t.Errorf("Expected: the whole file\nGot: %d bytes", len(b))
+		}
+	}
+	if n := upstream.requests.Load(); n != 1 {
+		t.Errorf("Expected: a single upstream request\nGot: %d", n)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	upstream := newTestUpstream(t, map[string]string{"/pub/linux": "kernel image"})
+	c, srv := newTestCache(t, t.TempDir(), upstream, 1024, 0)
+
+	status, body := get(srv.URL + "/cache/mirror/linux?sha256=" + sum("other kernel"))
+	if status == http.StatusOK && body == "kernel image" {
+		t.Errorf("Expected: a failed download\nGot: %d %q", status, body)
+	}
+	if files, _ := c.Size(); files != 0 {
+		t.Errorf("Expected: nothing cached\nGot: %d files", files)
+	}
+	if status, _ := get(srv.URL + "/cache/mirror/linux?sha256=nope"); status != http.StatusBadRequest {
+		t.Errorf("Expected: 400 for an invalid checksum\nGot: %d", status)
+	}
+
+	status, body = get(srv.URL + "/cache/mirror/linux?sha256=" + sum("kernel image"))
+	if status != http.StatusOK || body != "kernel image" {
+		t.Errorf("Expected: kernel image\nGot: %d %q", status, body)
+	}
+	// A file cached with another checksum is downloaded again.
+	upstream.set("/pub/linux", "new kernel")
+	status, body = get(srv.URL + "/cache/mirror/linux?sha256=" + sum("new kernel"))
+	if status != http.StatusOK || body != "new kernel" {
+		t.Errorf("Expected: new kernel\nGot: %d %q", status, body)
+	}
+}
+
+func TestJoinedChecksum(t *testing.T) {
+	contents := strings.Repeat("kernel", 10000)
+	upstream := newTestUpstream(t, map[string]string{"/pub/linux": contents})
+	upstream.release = make(chan struct{})
+	_, srv := newTestCache(t, t.TempDir(), upstream, 1<<20, 0)
+
+	var wg sync.WaitGroup
+	statuses := make([]int, 3)
+	bodies := make([]string, 3)
+	for i, query := range []string{"", "?sha256=" + sum("other kernel"), "?sha256=" + sum(contents)} {
+		wg.Add(1)
+		go func(i int, query string) {
+			defer wg.Done()
+			statuses[i], bodies[i] = get(srv.URL + "/cache/mirror/linux" + query)
+		}(i, query)
+		// The first request starts the download the others join.
+		time.Sleep(50 * time.Millisecond)
+	}
+	close(upstream.release)
+	wg.Wait()
+
+	if statuses[0] != http.StatusOK || bodies[0] != contents {
+		t.Errorf("Expected: the whole file\nGot: %d, %d bytes", statuses[0], len(bodies[0]))
+	}
+	if statuses[1] != http.StatusBadGateway {
+		t.Errorf("Expected: 502 for the wrong checksum\nGot: %d, %d bytes", statuses[1], len(bodies[1]))
+	}
+	if statuses[2] != http.StatusOK || bodies[2] != contents {
+		t.Errorf("Expected: the whole file\nGot: %d, %d bytes", statuses[2], len(bodies[2]))
+	}
+	if n := upstream.requests.Load(); n != 1 {
+		t.Errorf("Expected: a single upstream request\nGot: %d", n)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	upstream := newTestUpstream(t, map[string]string{"/pub/a": "aaaaaa", "/pub/b": "bbbbbb", "/pub/big": "0123456789ab"})
+	c, srv := newTestCache(t, t.TempDir(), upstream, 10, 0)
+
+	get(srv.URL + "/cache/mirror/a")
+	get(srv.URL + "/cache/mirror/b")
+	if files, size := c.Size(); files != 1 || size != 6 {
+		t.Errorf("Expected: the least recently used file evicted\nGot: %d files, %d bytes", files, size)
+	}
+	get(srv.URL + "/cache/mirror/b")
+	if n := upstream.requests.Load(); n != 2 {
+		t.Errorf("Expected: b still cached\nGot: %d upstream requests", n)
+	}
+
+	if status, _ := get(srv.URL + "/cache/mirror/big"); status != http.StatusBadGateway {
+		t.Errorf("Expected: 502 for a file larger than the cache\nGot: %d", status)
+	}
+}
+
+func TestRevalidation(t *testing.T) {
+	upstream := newTestUpstream(t, map[string]string{"/pub/linux": "kernel image"})
+	_, srv := newTestCache(t, t.TempDir(), upstream, 1024, time.Nanosecond)
+
+	get(srv.URL + "/cache/mirror/linux")
+	status, body := get(srv.URL + "/cache/mirror/linux")
+	if status != http.StatusOK || body != "kernel image" || upstream.requests.Load() != 2 {
+		t.Errorf("Expected: the file revalidated\nGot: %d %q", status, body)
+	}
+
+	upstream.set("/pub/linux", "updated kernel")
+	if _, body := get(srv.URL + "/cache/mirror/linux"); body != "updated kernel" {
+		t.Errorf("Expected: updated kernel\nGot: %q", body)
+	}
+
+	// Stale files are served if the mirror can't be reached.
+	upstream.Close()
+	if status, body := get(srv.URL + "/cache/mirror/linux"); status != http.StatusOK || body != "updated kernel" {
+		t.Errorf("Expected: the stale file\nGot: %d %q", status, body)
+	}
+}
+
+func TestTruncatedDownload(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		io.WriteString(w, "partial")
+	}))
+	defer upstream.Close()
+	c, err := New(log.MakeLogger(io.Discard), t.TempDir(), []Mirror{{Name: "mirror", URL: upstream.URL}}, 1024, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.StripPrefix("/cache/", c))
+	defer srv.Close()
+
+	if status, body := get(srv.URL + "/cache/mirror/linux"); status == http.StatusOK && body == "partial" {
+		t.Errorf("Expected: a failed download\nGot: %d %q", status, body)
+	}
+	if files, _ := c.Size(); files != 0 {
+		t.Errorf("Expected: nothing cached\nGot: %d files", files)
+	}
+}
@@ -0,0 +1,362 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/thousandeyes/shoelaces/internal/fetch"
+)
+
+// download is a file being downloaded from its mirror. Requests arriving
+// meanwhile read it from its file as it's written.
+type download struct {
+	key      string
+	url      string
+	checksum string
+	stale    *entry // Cached version being revalidated or replaced
+
+	mu          sync.Mutex
+	cond        *sync.Cond
+	started     bool // The upstream answer has been received
+	file        string
+	contentType string
+	length      int64 // -1 if unknown
+	written     int64
+	done        bool
+	complete    bool // The file was fully downloaded and verified
+	status      int  // Upstream status, if it's an error
+	entry       *entry
+	err         error
+}
+
+func newDownload(key, rawURL, checksum string, stale *entry) *download {
+	d := &download{key: key, url: rawURL, checksum: checksum, stale: stale, length: -1}
+	d.cond = sync.NewCond(&d.mu)
+	return d
+}
+
+func (d *download) start(file, contentType string, length int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.file, d.contentType, d.length = file, contentType, length
+	d.started = true
+	d.cond.Broadcast()
+}
+
+func (d *download) progress(written int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.written = written
+	d.cond.Broadcast()
+}
+
+// moveTo moves the downloaded file to its place in the cache, so requests
+// opening it from now on find it.
+func (d *download) moveTo(p string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := os.Rename(d.file, p); err != nil {
+		return err
+	}
+	d.file = p
+	d.complete = true
+	return nil
+}
+
+func (d *download) finish(e *entry, status int, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entry, d.status, d.err = e, status, err
+	d.started, d.done = true, true
+	d.cond.Broadcast()
+}
+
+func (d *download) wait() (*entry, int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for !d.done {
+		d.cond.Wait()
+	}
+	return d.entry, d.status, d.err
+}
+
+// follow streams the file while it's being downloaded. It returns false,
+// without writing anything, if the download is already over. The last byte
+// is held back until the download is verified, and the connection is
+// aborted if it fails, so clients never get a corrupted file as a whole.
+func (d *download) follow(w http.ResponseWriter, r *http.Request) bool {
+	d.mu.Lock()
+	for !d.started {
+		d.cond.Wait()
+	}
+	if d.done {
+		d.mu.Unlock()
+		return false
+	}
+	f, err := os.Open(d.file)
+	contentType, length := d.contentType, d.length
+	d.mu.Unlock()
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	if length >= 0 {
+		w.Header().Set("Content-Length", fmt.Sprint(length))
+	}
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return true
+	}
+
+	buf := make([]byte, 64*1024)
+	var offset int64
+	for {
+		d.mu.Lock()
+		for !d.done && offset >= d.written-1 {
+			d.cond.Wait()
+		}
+		available := d.written - 1
+		if d.complete {
+			available = d.written
+		} else if d.done {
+			d.mu.Unlock()
+			panic(http.ErrAbortHandler)
+		}
+		d.mu.Unlock()
+		if offset >= available {
+			return true
+		}
+
+		n := int64(len(buf))
+		if available-offset < n {
+			n = available - offset
+		}
+		read, err := f.ReadAt(buf[:n], offset)
+		if read > 0 {
+			if _, err := w.Write(buf[:read]); err != nil {
+				return true
+			}
+			offset += int64(read)
+		}
+		if err != nil && err != io.EOF {
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+// lookup returns the cached file of key, if it's fresh, or the download
+// getting it, starting it if needed. A download already running may verify
+// another checksum, or none.
+func (c *Cache) lookup(key, rawURL, checksum string) (*entry, *download) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := c.entries[key]
+	if e != nil && c.fresh(e, checksum) {
+		e.used = time.Now()
+		return e, nil
+	}
+	d := c.downloads[key]
+	if d == nil {
+		d = newDownload(key, rawURL, checksum, e)
+		c.downloads[key] = d
+		go c.fetch(d)
+	}
+	return nil, d
+}
+
+// fresh returns whether a cached file can be served as it is. Files
+// requested with a checksum never change.
+func (c *Cache) fresh(e *entry, checksum string) bool {
+	if checksum != "" {
+		return e.SHA256 == checksum
+	}
+	return c.ttl == 0 || time.Since(e.Fetched) < c.ttl
+}
+
+// fetch runs a download. The stale version of the file, if any, is kept and
+// served if the download fails, unless it has the wrong checksum.
+func (c *Cache) fetch(d *download) {
+	e, status, err := c.get(d)
+	if err != nil {
+		c.logger.Error("cache download failed", "component", "cache", "url", d.url, "err", err)
+	}
+
+	c.mu.Lock()
+	switch {
+	case err == nil:
+		c.store(e)
+	case d.stale != nil && d.checksum == "" && c.entries[d.key] == d.stale:
+		c.logger.Info("serving stale cached file", "component", "cache", "url", d.url)
+		e, status, err = d.stale, 0, nil
+	}
+	delete(c.downloads, d.key)
+	c.mu.Unlock()
+
+	d.finish(e, status, err)
+}
+
+// get downloads a file, or revalidates its stale version, and returns its
+// entry, or the upstream status if it's an error.
+func (c *Cache) get(d *download) (*entry, int, error) {
+	req, err := http.NewRequest(http.MethodGet, d.url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if d.stale != nil && d.checksum == "" {
+		if d.stale.ETag != "" {
+			req.Header.Set("If-None-Match", d.stale.ETag)
+		}
+		if d.stale.LastModified != "" {
+			req.Header.Set("If-Modified-Since", d.stale.LastModified)
+		}
+	}
+
+	resp, err := fetch.Get(c.client, req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && d.stale != nil:
+		e := *d.stale
+		e.Fetched = time.Now()
+		return &e, 0, c.writeMeta(&e)
+	case resp.StatusCode != http.StatusOK:
+		return nil, resp.StatusCode, fmt.Errorf("upstream answered %s", resp.Status)
+	case resp.ContentLength > c.maxSize:
+		return nil, 0, errors.New("file larger than the cache")
+	}
+
+	tmp, size, sum, err := resp.Save(filepath.Join(c.dir, "tmp"), fetch.Options{
+		MaxSize: c.maxSize,
+		SHA256:  d.checksum,
+		Created: func(p string) {
+			d.start(p, resp.Header.Get("Content-Type"), resp.ContentLength)
+		},
+		Progress: d.progress,
+	})
+	if errors.Is(err, fetch.ErrTooLarge) {
+		return nil, 0, errors.New("file larger than the cache")
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	e := &entry{
+		Key:          d.key,
+		URL:          d.url,
+		Size:         size,
+		SHA256:       sum,
+		ContentType:  resp.Header.Get("Content-Type"),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Fetched:      time.Now(),
+	}
+	if err := d.moveTo(c.dataPath(d.key)); err != nil {
+		os.Remove(tmp)
+		return nil, 0, err
+	}
+	return e, 0, c.writeMeta(e)
+}
+
+func (c *Cache) writeMeta(e *entry) error {
+	contents, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.metaPath(e.Key), contents, 0644)
+}
+
+// ServeHTTP serves the cached files, downloading them from their mirror if
+// needed. The path of the request is the mirror name followed by the path
+// of the file in the mirror. With the sha256 query parameter, the file must
+// have that SHA-256.
+func (c *Cache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key, rawURL, ok := c.upstream(r.URL.Path)
+	if !ok {
+		http.Error(w, "Unknown mirror or invalid path", http.StatusNotFound)
+		return
+	}
+	checksum := r.URL.Query().Get(ChecksumParam)
+	if checksum != "" && !checksumRegex.MatchString(checksum) {
+		http.Error(w, "Invalid SHA-256", http.StatusBadRequest)
+		return
+	}
+
+	e, d := c.lookup(key, rawURL, checksum)
+	if d != nil {
+		// Range requests wait for the whole file, and so do requests with
+		// a checksum the download doesn't verify, to check the file once
+		// it's stored.
+		follow := checksum == "" || d.checksum == checksum
+		if follow && r.Header.Get("Range") == "" && d.follow(w, r) {
+			return
+		}
+		var status int
+		var err error
+		e, status, err = d.wait()
+		if status != 0 {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		if checksum != "" && e.SHA256 != checksum {
+			http.Error(w, "Checksum mismatch", http.StatusBadGateway)
+			return
+		}
+	}
+	c.serveFile(w, r, e)
+}
+
+func (c *Cache) serveFile(w http.ResponseWriter, r *http.Request, e *entry) {
+	p := c.dataPath(e.Key)
+	f, err := os.Open(p)
+	if err != nil {
+		c.logger.Error("open cached file failed", "component", "cache", "url", e.URL, "err", err)
+		http.Error(w, "Cached file not available", http.StatusServiceUnavailable)
+		return
+	}
+	defer f.Close()
+	now := time.Now()
+	os.Chtimes(p, now, now)
+
+	contentType := e.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", `"`+e.SHA256+`"`)
+	modified, _ := http.ParseTime(e.LastModified)
+	http.ServeContent(w, r, "", modified, f)
+}
@@ -0,0 +1,82 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csrf
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+const (
+	// CookieName is the name of the cookie holding the session secret the
+	// tokens are bound to.
+	CookieName = "shoelaces_csrf"
+	// FieldName is the name of the form field holding the token.
+	FieldName = "csrf_token"
+	// HeaderName is the name of the header holding the token, for scripts.
+	HeaderName = "X-CSRF-Token"
+
+	secretSize = 32
+)
+
+// Protector issues and checks CSRF tokens. Tokens are bound to a random
+// secret kept by the browser in a cookie, and signed with a key known only
+// by Shoelaces, so a cookie set by another site doesn't help forging them.
+type Protector struct {
+	key []byte
+}
+
+// New returns a Protector with a random key. Tokens issued by other
+// instances or before a restart aren't valid.
+func New() (*Protector, error) {
+	key := make([]byte, secretSize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return &Protector{key: key}, nil
+}
+
+// NewSecret returns a new random secret, to be stored in the cookie.
+func NewSecret() (string, error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// Token returns the token bound to secret.
+func (p *Protector) Token(secret string) string {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(secret))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks that token is bound to secret.
+func (p *Protector) Verify(secret, token string) error {
+	if secret == "" {
+		return errors.New("missing CSRF cookie")
+	}
+	if token == "" {
+		return errors.New("missing CSRF token")
+	}
+	if !hmac.Equal([]byte(token), []byte(p.Token(secret))) {
+		return errors.New("invalid CSRF token")
+	}
+	return nil
+}
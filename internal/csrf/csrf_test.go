@@ -0,0 +1,51 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csrf
+
+import (
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	p, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := p.Token(secret)
+
+	if err := p.Verify(secret, token); err != nil {
+		t.Errorf("Expected: valid token\nGot: %v", err)
+	}
+	if err := p.Verify(secret, ""); err == nil {
+		t.Error("Expected: error for missing token\nGot: nil")
+	}
+	if err := p.Verify("", token); err == nil {
+		t.Error("Expected: error for missing cookie\nGot: nil")
+	}
+
+	other, _ := NewSecret()
+	if err := p.Verify(other, token); err == nil {
+		t.Error("Expected: error for token bound to another secret\nGot: nil")
+	}
+
+	q, _ := New()
+	if err := q.Verify(secret, token); err == nil {
+		t.Error("Expected: error for token issued with another key\nGot: nil")
+	}
+}
@@ -17,20 +17,40 @@ package environment
 import (
 	"fmt"
 	"html/template"
+	"io"
 	"net"
 	"os"
 	"path"
-	"path/filepath"
 	"regexp"
-	"sync"
+	"strings"
+	"time"
 
+	"github.com/thousandeyes/shoelaces/internal/assets"
+	"github.com/thousandeyes/shoelaces/internal/cache"
+	"github.com/thousandeyes/shoelaces/internal/csrf"
 	"github.com/thousandeyes/shoelaces/internal/event"
+	"github.com/thousandeyes/shoelaces/internal/hosts"
+	"github.com/thousandeyes/shoelaces/internal/inventory"
 	"github.com/thousandeyes/shoelaces/internal/log"
 	"github.com/thousandeyes/shoelaces/internal/mappings"
+	"github.com/thousandeyes/shoelaces/internal/overrides"
+	"github.com/thousandeyes/shoelaces/internal/ratelimit"
+	"github.com/thousandeyes/shoelaces/internal/redact"
+	"github.com/thousandeyes/shoelaces/internal/resolver"
+	"github.com/thousandeyes/shoelaces/internal/secrets"
 	"github.com/thousandeyes/shoelaces/internal/server"
+	"github.com/thousandeyes/shoelaces/internal/signing"
 	"github.com/thousandeyes/shoelaces/internal/templates"
+	"github.com/thousandeyes/shoelaces/internal/utils"
 )
 
+// HostsDir is the directory, inside the data dir, with the host files.
+const HostsDir = "hosts"
+
+// DefaultSensitiveParams holds the default patterns of the parameter names
+// whose values are masked in events, logs and the web frontend.
+const DefaultSensitiveParams = "*password*,*passwd*,*secret*,*token*"
+
 // Environment struct holds the shoelaces instance global data.
 type Environment struct {
 	ConfigFile      string
@@ -42,6 +62,20 @@ type Environment struct {
 	Templates       *templates.ShoelacesTemplates // Dynamic slc templates
 	StaticTemplates *template.Template            // Static Templates
 	Environments    []string                      // Valid config environments
+	Overrides       *overrides.Tree               // Environment inheritance
+	Hosts           *hosts.Hosts                  // Per-host variables
+	HostSources     []inventory.HostSource        // Asked in order when polling
+	Resolver        *resolver.Resolver            // Finds the hostnames of booting hosts
+	Signer          *signing.Signer               // Nil if config URLs aren't signed
+	Secrets         *secrets.Store                // Backs the secret template function
+	Cache           *cache.Cache                  // Nil if installer files aren't cached
+	Assets          *assets.Store                 // Nil without assets in assets.yaml
+	Redactor        *redact.Redactor              // Masks secrets in events, logs and UI
+	CSRF            *csrf.Protector               // Issues the CSRF tokens of the UI forms
+	IPLimiter       *ratelimit.Limiter            // Nil if boot requests aren't limited by IP
+	MACLimiter      *ratelimit.Limiter            // Nil if polls aren't limited by MAC
+	BootNetworks    []*net.IPNet                  // Empty if every source can boot
+	TrustedNetworks []*net.IPNet                  // Proxies trusted to forward the client address
 	Logger          log.Logger
 
 	BindAddr          string
@@ -52,12 +86,77 @@ type Environment struct {
 	TemplateExtension string
 	MappingsFile      string
 	Debug             bool
+	InventoryURL      string
+	InventoryTimeout  time.Duration
+	InventoryCacheTTL time.Duration
+	DNSServer         string
+	DNSTimeout        time.Duration
+	DNSCacheTTL       time.Duration
+	DNSNegativeTTL    time.Duration
+	DNSHostsFile      string
+	IPXEDir           string
+	CacheDir          string
+	CacheMirrors      string
+	CacheMaxSize      int
+	CacheTTL          time.Duration
+	AssetsDir         string
+	StaticListing     bool
+	InstallDeadline   time.Duration
+	SigningKey        string
+	SigningTTL        time.Duration
+	SignedPaths       string
+	SecretsFile       string
+	SecretsKey        string
+	SensitiveParams   string
+	APIToken          string
+	RateLimitIP       int
+	RateLimitMAC      int
+	MaxWaiting        int
+	MaxEventHosts     int
+	BootAllow         string
+	TrustedProxies    string
+	ProxyProtocol     bool
+}
+
+// New receives the command line arguments and returns an initialized
+// environment structure, ready for serving requests.
+func New(args []string) *Environment {
+	env := Load(args)
+	env.initStaticTemplates()
+	if err := env.Cache.Prepare(); err != nil {
+		env.Logger.Error("prepare cache failed", "component", "environment", "err", err)
+		os.Exit(1)
+	}
+	if err := env.Assets.Prepare(); err != nil {
+		env.Logger.Error("prepare assets failed", "component", "environment", "err", err)
+		os.Exit(1)
+	}
+	server.StartStateCleaner(env.Logger, env.ServerStates)
+	event.StartStuckChecker(env.Logger, env.EventLog, env.InstallDeadline)
+	env.Assets.Prefetch()
+
+	return env
+}
+
+// Load receives the command line arguments and returns an environment
+// structure with the data dir loaded. It exits if the configuration or the
+// data dir are not valid.
+func Load(args []string) *Environment {
+	env, _ := load(args, os.Stdout)
+	return env
+}
+
+// LoadCommand is Load for the commands writing their result to the
+// standard output: the log is written to the standard error instead, and
+// the arguments following the parameters are returned.
+func LoadCommand(args []string) (*Environment, []string) {
+	return load(args, os.Stderr)
 }
 
-// New returns an initialized environment structure
-func New() *Environment {
+func load(args []string, logOutput io.Writer) (*Environment, []string) {
 	env := defaultEnvironment()
-	flags, err := env.setFlags(os.Args[1:], os.Environ())
+	env.Logger = log.SetRedactor(log.MakeLogger(logOutput), env.Redactor)
+	flags, err := env.setFlags(args, os.Environ())
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -74,13 +173,36 @@ func New() *Environment {
 		env.Logger = log.AllowDebug(env.Logger)
 	}
 
+	if err := env.Redactor.SetNames(strings.Split(env.SensitiveParams, ",")); err != nil {
+		env.Logger.Error("invalid sensitive-params", "component", "environment", "err", err)
+		os.Exit(1)
+	}
+
 	if env.BaseURL == "" {
 		env.BaseURL = env.BindAddr
 	}
+	if env.BaseURL, err = utils.NormalizeBaseURL(env.BaseURL); err != nil {
+		env.Logger.Error("invalid base-url", "component", "environment", "err", err)
+		os.Exit(1)
+	}
 
-	env.Environments = env.initEnvOverrides()
+	if err := env.initEnvOverrides(); err != nil {
+		env.Logger.Error("load environments failed", "component", "environment", "err", err)
+		os.Exit(1)
+	}
 
-	env.EventLog = &event.Log{}
+	env.EventLog = &event.Log{Redactor: env.Redactor, MaxHosts: env.MaxEventHosts}
+	env.ServerStates.MaxServers = env.MaxWaiting
+	env.IPLimiter = ratelimit.New(env.RateLimitIP)
+	env.MACLimiter = ratelimit.New(env.RateLimitMAC)
+	if err := env.initBootNetworks(); err != nil {
+		env.Logger.Error("invalid boot-allow", "component", "environment", "err", err)
+		os.Exit(1)
+	}
+	if env.TrustedNetworks, err = utils.ParseNetworks(env.TrustedProxies); err != nil {
+		env.Logger.Error("invalid trusted-proxies", "component", "environment", "err", err)
+		os.Exit(1)
+	}
 
 	env.Logger.Info("override found", "component", "environment", "environment", env.Environments)
 
@@ -89,32 +211,161 @@ func New() *Environment {
 		panic(err)
 	}
 
-	env.initStaticTemplates()
-	env.Templates.ParseTemplates(env.Logger, env.DataDir, env.EnvDir, env.Environments, env.TemplateExtension)
-	server.StartStateCleaner(env.Logger, env.ServerStates)
+	if err := env.initResolver(); err != nil {
+		env.Logger.Error("init resolver failed", "component", "environment", "err", err)
+		os.Exit(1)
+	}
 
-	return env
+	if err := env.checkIPXEDir(); err != nil {
+		env.Logger.Error("invalid ipxe-dir", "component", "environment", "err", err)
+		os.Exit(1)
+	}
+
+	if env.CSRF, err = csrf.New(); err != nil {
+		env.Logger.Error("init CSRF protection failed", "component", "environment", "err", err)
+		os.Exit(1)
+	}
+
+	if err := env.initSigner(); err != nil {
+		env.Logger.Error("init URL signing failed", "component", "environment", "err", err)
+		os.Exit(1)
+	}
+	if err := env.initSecrets(); err != nil {
+		env.Logger.Error("load secrets failed", "component", "environment", "err", err)
+		os.Exit(1)
+	}
+	if err := env.initCache(); err != nil {
+		env.Logger.Error("init cache failed", "component", "environment", "err", err)
+		os.Exit(1)
+	}
+	if err := env.initAssets(); err != nil {
+		env.Logger.Error("load assets failed", "component", "environment", "err", err)
+		os.Exit(1)
+	}
+	env.Templates.Funcs(map[string]interface{}{
+		"signedURL": env.Signer.SignedURL,
+		"secret":    env.Secrets.Secret,
+		"cacheURL":  env.Cache.CacheURL,
+		"asset":     env.Assets.AssetURL,
+	})
+
+	env.Templates.ParseTemplates(env.Logger, env.DataDir, env.EnvDir, env.Overrides, env.TemplateExtension)
+	if err := env.checkSignedRefs(); err != nil {
+		env.Logger.Error("check config links failed", "component", "environment", "err", err)
+		os.Exit(1)
+	}
+
+	// Host files are checked against the templates, so they go after them.
+	hostVars, err := hosts.Load(path.Join(env.DataDir, HostsDir), env.checkHostScript)
+	if err != nil {
+		env.Logger.Error("load host files failed", "component", "environment", "err", err)
+		os.Exit(1)
+	}
+	env.Hosts = hostVars
+
+	if err := env.initHostSources(); err != nil {
+		env.Logger.Error("init host sources failed", "component", "environment", "err", err)
+		os.Exit(1)
+	}
+
+	return env, flags.Args()
 }
 
 func defaultEnvironment() *Environment {
 	env := &Environment{}
 	env.NetworkMaps = make([]mappings.NetworkMap, 0)
 	env.HostnameMaps = make([]mappings.HostnameMap, 0)
-	env.ServerStates = &server.States{sync.RWMutex{}, make(map[string]*server.State)}
+	env.ServerStates = &server.States{
+		Servers: make(map[string]*server.State),
+		Pending: make(map[string]*server.Assignment),
+	}
 	env.ParamsBlacklist = []string{"baseURL"}
 	env.Templates = templates.New()
 	env.Environments = make([]string, 0)
-	env.Logger = log.MakeLogger(os.Stdout)
+	env.Redactor = redact.New()
+	env.Logger = log.SetRedactor(log.MakeLogger(os.Stdout), env.Redactor)
 
 	return env
 }
 
+// initBootNetworks parses the networks allowed to use the boot endpoints.
+// Single addresses are allowed as well.
+func (env *Environment) initBootNetworks() error {
+	networks, err := utils.ParseNetworks(env.BootAllow)
+	if err != nil {
+		return err
+	}
+	env.BootNetworks = networks
+	if len(env.BootNetworks) > 0 {
+		env.Logger.Info("restricting boot endpoints", "component", "environment", "networks", env.BootAllow)
+	}
+	return nil
+}
+
+// initSigner sets up the signing of config URLs, if there is a key.
+func (env *Environment) initSigner() error {
+	if env.SigningKey == "" {
+		return nil
+	}
+	var paths []string
+	for _, p := range strings.Split(env.SignedPaths, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, strings.TrimPrefix(p, "/"))
+		}
+	}
+	signer, err := signing.New(env.SigningKey, env.SigningTTL, paths)
+	if err != nil {
+		return err
+	}
+	env.Signer = signer
+	env.Logger.Info("signing config URLs", "component", "environment", "signed-paths", paths)
+	return nil
+}
+
+// checkSignedRefs fails if a template links to a config needing a
+// signature with a plain baseURL, as the link would be refused when
+// followed. It needs signedURL instead.
+func (env *Environment) checkSignedRefs() error {
+	var links []string
+	for _, ref := range env.Templates.ConfigReferences() {
+		if ref.Config != "" && env.Signer.Required(ref.Config) {
+			links = append(links, fmt.Sprintf("%s (environment %q) links to %s", ref.Template, ref.Environment, ref.Config))
+		}
+	}
+	if len(links) > 0 {
+		return fmt.Errorf("signed configs linked without signature, use signedURL: %s", strings.Join(links, ", "))
+	}
+	return nil
+}
+
+// initSecrets sets up the secret providers. Environment variables take
+// precedence over the secrets file.
+func (env *Environment) initSecrets() error {
+	providers := []secrets.Provider{secrets.Env{}}
+	if env.SecretsFile != "" {
+		f, err := secrets.LoadFile(path.Join(env.DataDir, env.SecretsFile), env.SecretsKey)
+		if err != nil {
+			return err
+		}
+		providers = append(providers, f)
+	}
+	store, err := secrets.NewStore(env.Redactor, providers...)
+	if err != nil {
+		return err
+	}
+	env.Secrets = store
+	return nil
+}
+
 func (env *Environment) initStaticTemplates() {
 	staticTemplates := []string{
 		path.Join(env.StaticDir, "templates/html/header.html"),
 		path.Join(env.StaticDir, "templates/html/index.html"),
 		path.Join(env.StaticDir, "templates/html/events.html"),
 		path.Join(env.StaticDir, "templates/html/mappings.html"),
+		path.Join(env.StaticDir, "templates/html/pending.html"),
+		path.Join(env.StaticDir, "templates/html/downloads.html"),
+		path.Join(env.StaticDir, "templates/html/assets.html"),
 		path.Join(env.StaticDir, "templates/html/footer.html"),
 	}
 
@@ -130,18 +381,14 @@ func (env *Environment) initStaticTemplates() {
 	env.StaticTemplates = template.Must(template.ParseFiles(staticTemplates...))
 }
 
-func (env *Environment) initEnvOverrides() []string {
-	var environments = make([]string, 0)
-	envPath := filepath.Join(env.DataDir, env.EnvDir)
-	files, err := os.ReadDir(envPath)
-	if err == nil {
-		for _, f := range files {
-			if f.IsDir() {
-				environments = append(environments, f.Name())
-			}
-		}
+func (env *Environment) initEnvOverrides() error {
+	tree, err := overrides.Load(env.DataDir, env.EnvDir)
+	if err != nil {
+		return err
 	}
-	return environments
+	env.Overrides = tree
+	env.Environments = tree.Names()
+	return nil
 }
 
 func (env *Environment) initMappings(mappingsPath string) error {
@@ -170,6 +417,105 @@ func (env *Environment) initMappings(mappingsPath string) error {
 	return nil
 }
 
+// initHostSources sets up the sources asked for the script a host should
+// boot. Host files are the most specific ones, followed by the inventory
+// service, if any, and the mappings file.
+func (env *Environment) initHostSources() error {
+	env.HostSources = []inventory.HostSource{inventory.NewHostFiles(env.Hosts)}
+
+	if env.InventoryURL != "" {
+		inv, err := inventory.NewHTTP(env.InventoryURL, env.InventoryTimeout, env.InventoryCacheTTL)
+		if err != nil {
+			return err
+		}
+		env.Logger.Info("using inventory", "component", "environment", "url", env.InventoryURL)
+		env.HostSources = append(env.HostSources, inv)
+	}
+
+	env.HostSources = append(env.HostSources, inventory.NewMappings(env.HostnameMaps, env.NetworkMaps))
+	return nil
+}
+
+// initCache sets up the caching proxy of the upstream mirrors, if any.
+func (env *Environment) initCache() error {
+	if env.CacheDir == "" {
+		return nil
+	}
+	mirrors, err := cache.ParseMirrors(env.CacheMirrors)
+	if err != nil {
+		return err
+	}
+	env.Cache, err = cache.New(env.Logger, env.CacheDir, mirrors, int64(env.CacheMaxSize)<<20, env.CacheTTL)
+	return err
+}
+
+// initAssets loads the boot assets listed in the catalog, if any.
+func (env *Environment) initAssets() error {
+	catalog, err := assets.LoadCatalog(path.Join(env.DataDir, assets.CatalogFile))
+	if err != nil {
+		return err
+	}
+	if len(catalog) == 0 {
+		return nil
+	}
+	if env.AssetsDir == "" {
+		return fmt.Errorf("%s lists assets, but there is no assets-dir", assets.CatalogFile)
+	}
+	env.Assets, err = assets.New(env.Logger, env.AssetsDir, catalog)
+	return err
+}
+
+// checkHostScript makes sure the script and environment set by a host file
+// exist, so hosts don't fail to boot them.
+func (env *Environment) checkHostScript(script, envName string) error {
+	if envName != "" && envName != overrides.Default && !utils.StringInSlice(envName, env.Environments) {
+		return fmt.Errorf("unknown environment %q", envName)
+	}
+	if script != "" && !env.Templates.Has(script, envName) {
+		if envName != "" {
+			return fmt.Errorf("unknown script %q in environment %q", script, envName)
+		}
+		return fmt.Errorf("unknown script %q", script)
+	}
+	return nil
+}
+
+// checkIPXEDir makes sure the iPXE binaries directory, if any, exists, so
+// typos don't show up as missing downloads.
+func (env *Environment) checkIPXEDir() error {
+	if env.IPXEDir == "" {
+		return nil
+	}
+	dir := path.Join(env.DataDir, env.IPXEDir)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return nil
+}
+
+// initResolver sets up the reverse DNS lookups of booting hosts, with the
+// static names of the hosts file, if any.
+func (env *Environment) initResolver() error {
+	r, err := resolver.New(env.DNSServer, env.DNSTimeout, env.DNSCacheTTL, env.DNSNegativeTTL)
+	if err != nil {
+		return err
+	}
+	if env.DNSHostsFile != "" {
+		if err := r.LoadHosts(path.Join(env.DataDir, env.DNSHostsFile)); err != nil {
+			return err
+		}
+	}
+	env.Resolver = r
+	if env.DNSServer != "" {
+		env.Logger.Info("using DNS server", "component", "environment", "server", env.DNSServer)
+	}
+	return nil
+}
+
 func initScript(configScript mappings.YamlScript) *mappings.Script {
 	mappingScript := &mappings.Script{
 		Name:        configScript.Name,
@@ -15,9 +15,18 @@
 package environment
 
 import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/thousandeyes/shoelaces/internal/log"
 	"github.com/thousandeyes/shoelaces/internal/mappings"
+	"github.com/thousandeyes/shoelaces/internal/overrides"
+	"github.com/thousandeyes/shoelaces/internal/signing"
+	"github.com/thousandeyes/shoelaces/internal/templates"
 )
 
 func TestDefaultEnvironment(t *testing.T) {
@@ -59,3 +68,37 @@ func TestInitScript(t *testing.T) {
 		}
 	}
 }
+
+func TestCheckSignedRefs(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "ipxe", "a.ipxe.slc")
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	contents := "{{define \"a.ipxe\"}}#!ipxe\nchain http://{{.baseURL}}/configs/open.cfg\nchain http://{{.baseURL}}/configs/secret/{{.hostname}}.cfg\n{{end}}"
+	if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tree, err := overrides.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := &Environment{Templates: templates.New(), Logger: log.MakeLogger(io.Discard)}
+	env.Templates.ParseTemplates(env.Logger, dir, "env_overrides", tree, ".slc")
+
+	if err := env.checkSignedRefs(); err != nil {
+		t.Errorf("Expected: no error without signing\nGot: %v", err)
+	}
+	if env.Signer, err = signing.New("key", time.Hour, []string{"open.cfg.bak", "other/"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.checkSignedRefs(); err != nil {
+		t.Errorf("Expected: no error for unsigned configs\nGot: %v", err)
+	}
+	if env.Signer, err = signing.New("key", time.Hour, []string{"secret/"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.checkSignedRefs(); err == nil || !strings.Contains(err.Error(), "a.ipxe (environment \"default\") links to secret/") {
+		t.Errorf("Expected: error for the link to secret/\nGot: %v", err)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func (env *Environment) setFlags(args []string, environ []string) (*flag.FlagSet, error) {
@@ -54,6 +55,20 @@ func (env *Environment) setFlagDefaults() {
 	env.EnvDir = "env_overrides"
 	env.TemplateExtension = ".slc"
 	env.MappingsFile = "mappings.yaml"
+	env.InventoryTimeout = 5 * time.Second
+	env.InventoryCacheTTL = time.Minute
+	env.DNSTimeout = 2 * time.Second
+	env.DNSCacheTTL = 5 * time.Minute
+	env.DNSNegativeTTL = time.Minute
+	env.CacheMaxSize = 10240
+	env.CacheTTL = 24 * time.Hour
+	env.StaticListing = true
+	env.InstallDeadline = time.Hour
+	env.SigningTTL = time.Hour
+	env.SensitiveParams = DefaultSensitiveParams
+	env.RateLimitMAC = 60
+	env.MaxWaiting = 1000
+	env.MaxEventHosts = 10000
 }
 
 func (env *Environment) registerFlags() *flag.FlagSet {
@@ -67,6 +82,36 @@ func (env *Environment) registerFlags() *flag.FlagSet {
 	flags.StringVar(&env.TemplateExtension, "template-extension", env.TemplateExtension, "Shoelaces template extension")
 	flags.StringVar(&env.MappingsFile, "mappings-file", env.MappingsFile, "My mappings YAML file")
 	flags.BoolVar(&env.Debug, "debug", env.Debug, "Debug mode")
+	flags.StringVar(&env.InventoryURL, "inventory-url", env.InventoryURL, "URL of an HTTP JSON inventory service asked for the script of booting hosts")
+	flags.DurationVar(&env.InventoryTimeout, "inventory-timeout", env.InventoryTimeout, "Timeout for inventory service requests")
+	flags.DurationVar(&env.InventoryCacheTTL, "inventory-cache-ttl", env.InventoryCacheTTL, "How long inventory service answers are cached")
+	flags.StringVar(&env.DNSServer, "dns-server", env.DNSServer, "DNS server resolving the hostnames of booting hosts, the system resolver if empty")
+	flags.DurationVar(&env.DNSTimeout, "dns-timeout", env.DNSTimeout, "Timeout for reverse DNS lookups, 0 to disable")
+	flags.DurationVar(&env.DNSCacheTTL, "dns-cache-ttl", env.DNSCacheTTL, "How long resolved hostnames are cached")
+	flags.DurationVar(&env.DNSNegativeTTL, "dns-negative-ttl", env.DNSNegativeTTL, "How long failed reverse DNS lookups are cached")
+	flags.StringVar(&env.DNSHostsFile, "dns-hosts-file", env.DNSHostsFile, "Hosts file, relative to data-dir, whose names are used before reverse DNS")
+	flags.StringVar(&env.IPXEDir, "ipxe-dir", env.IPXEDir, "Directory, relative to data-dir, with the iPXE binaries served to download")
+	flags.StringVar(&env.CacheDir, "cache-dir", env.CacheDir, "Directory where the files of cache-mirrors are cached, disabled if empty")
+	flags.StringVar(&env.CacheMirrors, "cache-mirrors", env.CacheMirrors, "Comma separated name=URL pairs of the mirrors cached under /cache/name/")
+	flags.IntVar(&env.CacheMaxSize, "cache-max-size", env.CacheMaxSize, "Maximum size of the cache in MiB")
+	flags.DurationVar(&env.CacheTTL, "cache-ttl", env.CacheTTL, "Time after which cached files are revalidated with their mirror, 0 to disable")
+	flags.StringVar(&env.AssetsDir, "assets-dir", env.AssetsDir, "Directory where the assets of assets.yaml are downloaded")
+	flags.BoolVar(&env.StaticListing, "static-listing", env.StaticListing, "List the directories of the static config files")
+	flags.StringVar(&env.SigningKey, "signing-key", env.SigningKey, "Secret key for signing config URLs")
+	flags.DurationVar(&env.SigningTTL, "signing-ttl", env.SigningTTL, "How long signed config URLs are valid")
+	flags.StringVar(&env.SignedPaths, "signed-paths", env.SignedPaths, "Comma separated config names, or directories ending with a slash, only served with a valid signature")
+	flags.StringVar(&env.SecretsFile, "secrets-file", env.SecretsFile, "Encrypted secrets file, relative to data-dir")
+	flags.StringVar(&env.SecretsKey, "secrets-key", env.SecretsKey, "Key of the secrets file, 32 bytes encoded in base64")
+	flags.StringVar(&env.SensitiveParams, "sensitive-params", env.SensitiveParams, "Comma separated patterns of the parameter names whose values are masked in events, logs and the web UI")
+	flags.StringVar(&env.APIToken, "api-token", env.APIToken, "Bearer token of the API scripts, exempting their requests from the CSRF checks")
+	flags.IntVar(&env.RateLimitIP, "rate-limit-ip", env.RateLimitIP, "Boot requests allowed per minute for each source IP, 0 to disable")
+	flags.IntVar(&env.RateLimitMAC, "rate-limit-mac", env.RateLimitMAC, "Polls allowed per minute for each MAC, 0 to disable")
+	flags.IntVar(&env.MaxWaiting, "max-waiting", env.MaxWaiting, "Maximum number of hosts waiting for a manual selection, 0 to disable")
+	flags.IntVar(&env.MaxEventHosts, "max-event-hosts", env.MaxEventHosts, "Maximum number of hosts kept in the events log, 0 to disable")
+	flags.StringVar(&env.BootAllow, "boot-allow", env.BootAllow, "Comma separated networks allowed to use the boot endpoints, all if empty")
+	flags.StringVar(&env.TrustedProxies, "trusted-proxies", env.TrustedProxies, "Comma separated networks of the proxies trusted to forward the client address")
+	flags.BoolVar(&env.ProxyProtocol, "proxy-protocol", env.ProxyProtocol, "Read the PROXY protocol header sent by trusted proxies")
+	flags.DurationVar(&env.InstallDeadline, "install-deadline", env.InstallDeadline, "Time after booting for hosts to report the end of their installation before being flagged as stuck, 0 to disable")
 	return flags
 }
 
@@ -151,6 +196,96 @@ func (env *Environment) applyEnvVars(environ []string) error {
 	if err := env.applyEnvVar(environ, "mappings-file", "MAPPINGS_FILE"); err != nil {
 		return err
 	}
+	if err := env.applyEnvVar(environ, "inventory-url", "INVENTORY_URL"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "inventory-timeout", "INVENTORY_TIMEOUT"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "inventory-cache-ttl", "INVENTORY_CACHE_TTL"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "dns-server", "DNS_SERVER"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "dns-timeout", "DNS_TIMEOUT"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "dns-cache-ttl", "DNS_CACHE_TTL"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "dns-negative-ttl", "DNS_NEGATIVE_TTL"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "dns-hosts-file", "DNS_HOSTS_FILE"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "ipxe-dir", "IPXE_DIR"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "cache-dir", "CACHE_DIR"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "cache-mirrors", "CACHE_MIRRORS"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "cache-max-size", "CACHE_MAX_SIZE"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "cache-ttl", "CACHE_TTL"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "assets-dir", "ASSETS_DIR"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "static-listing", "STATIC_LISTING"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "install-deadline", "INSTALL_DEADLINE"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "secrets-file", "SECRETS_FILE"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "secrets-key", "SECRETS_KEY"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "rate-limit-ip", "RATE_LIMIT_IP"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "rate-limit-mac", "RATE_LIMIT_MAC"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "max-waiting", "MAX_WAITING"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "max-event-hosts", "MAX_EVENT_HOSTS"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "boot-allow", "BOOT_ALLOW"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "trusted-proxies", "TRUSTED_PROXIES"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "proxy-protocol", "PROXY_PROTOCOL"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "sensitive-params", "SENSITIVE_PARAMS"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "api-token", "API_TOKEN"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "signing-key", "SIGNING_KEY"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "signing-ttl", "SIGNING_TTL"); err != nil {
+		return err
+	}
+	if err := env.applyEnvVar(environ, "signed-paths", "SIGNED_PATHS"); err != nil {
+		return err
+	}
 	return env.applyEnvVar(environ, "debug", "DEBUG")
 }
 
@@ -159,7 +294,7 @@ func (env *Environment) applyEnvVar(environ []string, key, name string) error {
 	if !ok {
 		return nil
 	}
-	if key == "debug" && value == "" {
+	if (key == "debug" || key == "proxy-protocol") && value == "" {
 		value = "true"
 	}
 	return env.setConfigValue(key, value)
@@ -199,12 +334,98 @@ func (env *Environment) setConfigValue(key, value string) error {
 			return fmt.Errorf("invalid debug value %q: %w", value, err)
 		}
 		env.Debug = debug
+	case "inventory-url":
+		env.InventoryURL = value
+	case "inventory-timeout":
+		return setDuration(&env.InventoryTimeout, key, value)
+	case "inventory-cache-ttl":
+		return setDuration(&env.InventoryCacheTTL, key, value)
+	case "dns-server":
+		env.DNSServer = value
+	case "dns-timeout":
+		return setDuration(&env.DNSTimeout, key, value)
+	case "dns-cache-ttl":
+		return setDuration(&env.DNSCacheTTL, key, value)
+	case "dns-negative-ttl":
+		return setDuration(&env.DNSNegativeTTL, key, value)
+	case "dns-hosts-file":
+		env.DNSHostsFile = value
+	case "ipxe-dir":
+		env.IPXEDir = value
+	case "cache-dir":
+		env.CacheDir = value
+	case "cache-mirrors":
+		env.CacheMirrors = value
+	case "cache-max-size":
+		return setInt(&env.CacheMaxSize, key, value)
+	case "cache-ttl":
+		return setDuration(&env.CacheTTL, key, value)
+	case "assets-dir":
+		env.AssetsDir = value
+	case "static-listing":
+		staticListing, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid static-listing value %q: %w", value, err)
+		}
+		env.StaticListing = staticListing
+	case "install-deadline":
+		return setDuration(&env.InstallDeadline, key, value)
+	case "rate-limit-ip":
+		return setInt(&env.RateLimitIP, key, value)
+	case "rate-limit-mac":
+		return setInt(&env.RateLimitMAC, key, value)
+	case "max-waiting":
+		return setInt(&env.MaxWaiting, key, value)
+	case "max-event-hosts":
+		return setInt(&env.MaxEventHosts, key, value)
+	case "boot-allow":
+		env.BootAllow = value
+	case "trusted-proxies":
+		env.TrustedProxies = value
+	case "proxy-protocol":
+		proxyProtocol, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid proxy-protocol value %q: %w", value, err)
+		}
+		env.ProxyProtocol = proxyProtocol
+	case "secrets-file":
+		env.SecretsFile = value
+	case "secrets-key":
+		env.SecretsKey = value
+	case "sensitive-params":
+		env.SensitiveParams = value
+	case "api-token":
+		env.APIToken = value
+	case "signing-key":
+		env.SigningKey = value
+	case "signing-ttl":
+		return setDuration(&env.SigningTTL, key, value)
+	case "signed-paths":
+		env.SignedPaths = value
 	default:
 		return fmt.Errorf("unknown config key %q", key)
 	}
 	return nil
 }
 
+func setDuration(d *time.Duration, key, value string) error {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s value %q: %w", key, value, err)
+	}
+	*d = duration
+	return nil
+}
+
+func setInt(i *int, key, value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s value %q: %w", key, value, err)
+	}
+	*i = n
+	return nil
+}
+
 func (env *Environment) validateFlags() error {
 	var messages []string
 
@@ -216,6 +437,22 @@ func (env *Environment) validateFlags() error {
 		messages = append(messages, "[*] You must specify the data-dir parameter")
 	}
 
+	if env.SecretsFile != "" && env.SecretsKey == "" {
+		messages = append(messages, "[*] You must specify the secrets-key parameter when using secrets-file")
+	}
+
+	if env.SignedPaths != "" && env.SigningKey == "" {
+		messages = append(messages, "[*] You must specify the signing-key parameter when using signed-paths")
+	}
+
+	if env.CacheMirrors != "" && env.CacheDir == "" {
+		messages = append(messages, "[*] You must specify the cache-dir parameter when using cache-mirrors")
+	}
+
+	if env.ProxyProtocol && env.TrustedProxies == "" {
+		messages = append(messages, "[*] You must specify the trusted-proxies parameter when using proxy-protocol")
+	}
+
 	if len(messages) > 0 {
 		return errors.New(strings.Join(messages, "\n"))
 	}
@@ -18,6 +18,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestSetFlagsAppliesDefaults(t *testing.T) {
@@ -41,6 +42,21 @@ func TestSetFlagsAppliesDefaults(t *testing.T) {
 	if env.MappingsFile != "mappings.yaml" {
 		t.Errorf("Expected default mappings file, got %q", env.MappingsFile)
 	}
+	if env.SensitiveParams != DefaultSensitiveParams {
+		t.Errorf("Expected default sensitive params, got %q", env.SensitiveParams)
+	}
+	if env.RateLimitIP != 0 || env.RateLimitMAC != 60 || env.MaxWaiting != 1000 || env.MaxEventHosts != 10000 {
+		t.Errorf("Expected default boot limits, got %d %d %d %d", env.RateLimitIP, env.RateLimitMAC, env.MaxWaiting, env.MaxEventHosts)
+	}
+	if env.DNSTimeout != 2*time.Second || env.DNSCacheTTL != 5*time.Minute || env.DNSNegativeTTL != time.Minute {
+		t.Errorf("Expected default DNS settings, got %v %v %v", env.DNSTimeout, env.DNSCacheTTL, env.DNSNegativeTTL)
+	}
+	if env.CacheMaxSize != 10240 || env.CacheTTL != 24*time.Hour {
+		t.Errorf("Expected default cache settings, got %d %v", env.CacheMaxSize, env.CacheTTL)
+	}
+	if !env.StaticListing {
+		t.Errorf("Expected static listing by default")
+	}
 }
 
 func TestSetFlagsLoadsConfigEnvAndCLIInOrder(t *testing.T) {
@@ -175,6 +191,7 @@ func TestSetFlagsReturnsConfigErrors(t *testing.T) {
 		{name: "unknown key", config: "unknown=value\n"},
 		{name: "invalid bool", config: "debug=maybe\n"},
 		{name: "empty bool", config: "debug=\n"},
+		{name: "invalid int", config: "max-waiting=many\n"},
 	}
 
 	for _, tt := range tests {
@@ -197,6 +214,15 @@ func TestValidateFlagsReturnsError(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	env.ProxyProtocol = true
+	if err := env.validateFlags(); err == nil {
+		t.Fatal("Expected error for proxy-protocol without trusted-proxies")
+	}
+	env.TrustedProxies = "10.0.0.0/8"
+	if err := env.validateFlags(); err != nil {
+		t.Fatal(err)
+	}
+
 	env.StaticDir = ""
 	if err := env.validateFlags(); err == nil {
 		t.Fatal("Expected error")
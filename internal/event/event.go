@@ -16,8 +16,11 @@ package event
 
 import (
 	"encoding/json"
+	"fmt"
+	"sync"
 	"time"
 
+	"github.com/thousandeyes/shoelaces/internal/redact"
 	"github.com/thousandeyes/shoelaces/internal/server"
 )
 
@@ -34,6 +37,18 @@ const (
 	// HostTimeout is the event generated when a host polls and after some
 	// minutes without activity, timeouts.
 	HostTimeout Type = 3
+	// HostProgress is the event generated when a host reports an
+	// installation phase through the callback endpoint
+	HostProgress Type = 4
+	// HostStuck is the event generated when a host doesn't finish its
+	// installation before the deadline
+	HostStuck Type = 5
+	// HostDownload is the event generated when a host downloads a static or
+	// templated config file
+	HostDownload Type = 6
+	// SecurityAlert is the event generated when a host is denied access to
+	// a config file
+	SecurityAlert Type = 7
 
 	// PtrMatchBoot is triggered when a PTR is matched to an IP
 	PtrMatchBoot = "DNS Match"
@@ -41,6 +56,14 @@ const (
 	SubnetMatchBoot = "Subnet Match"
 	// ManualBoot is triggered when the user selects manual boot
 	ManualBoot = "Manual"
+	// HostFileBoot is triggered when a host file sets the script to boot
+	HostFileBoot = "Host File"
+	// InventoryBoot is triggered when an inventory service sets the script
+	// to boot
+	InventoryBoot = "Inventory"
+	// PendingBoot is triggered when a host boots a script assigned to it
+	// before it polled
+	PendingBoot = "Pre-provisioned"
 )
 
 // Event holds information related to the interactions of hosts when they boot.
@@ -53,11 +76,26 @@ type Event struct {
 	Script   string                 `json:"script"`
 	Message  string                 `json:"message"`
 	Params   map[string]interface{} `json:"params"`
+	HostFile string                 `json:"hostFile,omitempty"`
+	Phase    string                 `json:"phase,omitempty"`
+
+	Environment string `json:"environment,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	Status      int    `json:"status,omitempty"`
+	Reason      string `json:"reason,omitempty"`
 }
 
-// Log holds the events log
+// Log holds the events log. It provides a mutex for thread-safety. The
+// parameters of the events are masked by its Redactor, if any. MaxHosts
+// caps the number of hosts with events, the ones without recent events are
+// dropped first. 0 means no limit.
 type Log struct {
-	Events map[string][]Event
+	sync.RWMutex
+	Events   map[string][]Event
+	Redactor *redact.Redactor
+	MaxHosts int
+
+	ips map[string]server.Server // Server of the last event of each IP
 }
 
 // New creates a new Event object
@@ -85,16 +123,166 @@ func (e *Event) setMessage() {
 	case HostBoot:
 		params, _ := json.Marshal(e.Params)
 		e.Message = "Host " + e.Server.Hostname + " booted using " + e.BootType + " method with the following parameters: " + string(params)
+		if e.HostFile != "" {
+			e.Message += " Host variables were read from " + e.HostFile + "."
+		}
 	case HostTimeout:
 		e.Message = "Host " + e.Server.Hostname + " timed out."
+	case HostProgress:
+		e.Message = "Host " + e.Server.Hostname + " reported the " + e.Phase + " phase."
+	case HostDownload:
+		e.Message = "Host " + e.Server.Hostname + " downloaded " + e.Script
+		if e.Environment != "" {
+			e.Message += " from the " + e.Environment + " environment"
+		}
+		e.Message += fmt.Sprintf(" with status %d, %d bytes.", e.Status, e.Size)
+	case SecurityAlert:
+		e.Message = "Host " + e.Server.Hostname + " was denied access to " + e.Script + ": " + e.Reason + "."
+	case HostStuck:
+		e.Message = "Host " + e.Server.Hostname + " didn't finish its installation in time."
+		if e.Phase != "" {
+			e.Message += " The last phase reported was " + e.Phase + "."
+		}
 	}
 }
 
 // AddEvent adds an Event into the event log
 func (el *Log) AddEvent(eventType Type, srv server.Server, bootType string, script string, params map[string]interface{}) {
+	el.Lock()
+	defer el.Unlock()
+	el.add(New(eventType, srv, bootType, script, el.Redactor.Params(params)))
+}
+
+// AddHostBootEvent adds a HostBoot Event into the event log, recording the
+// host file whose variables were used, if any.
+func (el *Log) AddHostBootEvent(srv server.Server, bootType string, script string, params map[string]interface{}, hostFile string) {
+	e := New(HostBoot, srv, bootType, script, el.Redactor.Params(params))
+	e.HostFile = hostFile
+	e.setMessage()
+
+	el.Lock()
+	defer el.Unlock()
+	el.add(e)
+}
+
+// AddDownloadEvent adds a HostDownload Event into the event log, recording
+// the name, environment, status and size of the file downloaded by a host.
+// The server is completed with the data of the previous events of the host.
+func (el *Log) AddDownloadEvent(srv server.Server, name string, envName string, status int, size int64) {
+	el.Lock()
+	defer el.Unlock()
+
+	e := New(HostDownload, el.complete(srv), "", name, nil)
+	e.Environment = envName
+	e.Status = status
+	e.Size = size
+	e.setMessage()
+	el.add(e)
+}
+
+// AddSecurityEvent adds a SecurityAlert Event into the event log, recording
+// the file a host was denied access to and why. The server is completed with
+// the data of the previous events of the host.
+func (el *Log) AddSecurityEvent(srv server.Server, name string, reason string) {
+	el.Lock()
+	defer el.Unlock()
+
+	e := New(SecurityAlert, el.complete(srv), "", name, nil)
+	e.Reason = reason
+	e.setMessage()
+	el.add(e)
+}
+
+// Booted reports whether a host booted from Shoelaces, having a HostBoot
+// event in the log.
+func (el *Log) Booted(mac string) bool {
+	el.RLock()
+	defer el.RUnlock()
+	return el.booted(mac)
+}
+
+// booted is Booted for callers holding the lock.
+func (el *Log) booted(mac string) bool {
+	for _, e := range el.Events[mac] {
+		if e.Type == HostBoot {
+			return true
+		}
+	}
+	return false
+}
+
+// FindServer returns the server of the last event recorded for ip.
+func (el *Log) FindServer(ip string) (server.Server, bool) {
+	el.RLock()
+	defer el.RUnlock()
+
+	srv, ok := el.ips[ip]
+	return srv, ok
+}
+
+// List returns a copy of the events log, indexed by MAC.
+func (el *Log) List() map[string][]Event {
+	el.RLock()
+	defer el.RUnlock()
+
+	ret := make(map[string][]Event, len(el.Events))
+	for mac, events := range el.Events {
+		ret[mac] = append([]Event(nil), events...)
+	}
+	return ret
+}
+
+// complete fills the missing data of srv with the one of the last event of
+// the same MAC. The caller must hold the lock.
+func (el *Log) complete(srv server.Server) server.Server {
+	if events := el.Events[srv.Mac]; len(events) > 0 {
+		last := events[len(events)-1].Server
+		if srv.Hostname == "" {
+			srv.Hostname = last.Hostname
+		}
+		if srv.Serial == "" {
+			srv.Serial = last.Serial
+		}
+		if srv.UUID == "" {
+			srv.UUID = last.UUID
+		}
+	}
+	return srv
+}
+
+// add appends an event to the log. The caller must hold the lock.
+func (el *Log) add(e Event) {
 	if el.Events == nil {
 		el.Events = make(map[string][]Event)
 	}
+	if _, ok := el.Events[e.Server.Mac]; !ok && el.MaxHosts > 0 && len(el.Events) >= el.MaxHosts {
+		el.dropOldest()
+	}
+	el.Events[e.Server.Mac] = append(el.Events[e.Server.Mac], e)
+
+	if e.Server.IP != "" {
+		if el.ips == nil {
+			el.ips = make(map[string]server.Server)
+		}
+		el.ips[e.Server.IP] = e.Server
+	}
+}
 
-	el.Events[srv.Mac] = append(el.Events[srv.Mac], New(eventType, srv, bootType, script, params))
+// dropOldest removes the events of the host whose last event is the
+// oldest. The caller must hold the lock.
+func (el *Log) dropOldest() {
+	oldest := ""
+	var date time.Time
+	for mac, events := range el.Events {
+		last := events[len(events)-1].Date
+		if oldest == "" || last.Before(date) {
+			oldest, date = mac, last
+		}
+	}
+	delete(el.Events, oldest)
+	for ip, srv := range el.ips {
+		if srv.Mac == oldest {
+			delete(el.ips, ip)
+		}
+	}
 }
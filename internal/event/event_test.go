@@ -16,9 +16,11 @@ package event
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/thousandeyes/shoelaces/internal/redact"
 	"github.com/thousandeyes/shoelaces/internal/server"
 )
 
@@ -70,3 +72,69 @@ func TestEventMarshalJSON(t *testing.T) {
 		t.Errorf("Expected %s\nGot: %s\n", expectedEvent, marshaled)
 	}
 }
+
+func TestAddDownloadEvent(t *testing.T) {
+	el := &Log{}
+	srv := server.New("06:66:de:ad:be:ef", "10.0.0.1", "host1")
+
+	if _, ok := el.FindServer("10.0.0.1"); ok {
+		t.Error("Expected: unknown IP\nGot: found")
+	}
+	el.AddEvent(HostPoll, srv, "", "", nil)
+	found, ok := el.FindServer("10.0.0.1")
+	if !ok || found.Mac != srv.Mac {
+		t.Errorf("Expected: %s\nGot: %v", srv.Mac, found)
+	}
+
+	el.AddDownloadEvent(server.New(srv.Mac, "10.0.0.1", ""), "preseeds/ubuntu", "staging", 200, 1234)
+	events := el.List()[srv.Mac]
+	e := events[len(events)-1]
+	if e.Type != HostDownload || e.Script != "preseeds/ubuntu" || e.Environment != "staging" || e.Status != 200 || e.Size != 1234 {
+		t.Errorf("Expected: download event\nGot: %v", e)
+	}
+	expected := "Host host1 downloaded preseeds/ubuntu from the staging environment with status 200, 1234 bytes."
+	if e.Message != expected {
+		t.Errorf("Expected: %s\nGot: %s", expected, e.Message)
+	}
+}
+
+func TestRedactedParams(t *testing.T) {
+	r := redact.New()
+	if err := r.SetNames([]string{"*password*"}); err != nil {
+		t.Fatal(err)
+	}
+	el := &Log{Redactor: r}
+	srv := server.New("06:66:de:ad:be:ef", "10.0.0.1", "host1")
+	params := map[string]interface{}{"rootPassword": "hunter2", "version": "1.0"}
+
+	el.AddHostBootEvent(srv, ManualBoot, "flatcar.ipxe", params, "")
+	e := el.List()[srv.Mac][0]
+	if e.Params["rootPassword"] != redact.Mask || e.Params["version"] != "1.0" {
+		t.Errorf("Expected: rootPassword masked\nGot: %v", e.Params)
+	}
+	if strings.Contains(e.Message, "hunter2") {
+		t.Errorf("Expected: message without the password\nGot: %s", e.Message)
+	}
+	if params["rootPassword"] != "hunter2" {
+		t.Errorf("Expected: params not modified\nGot: %v", params)
+	}
+}
+
+func TestMaxHosts(t *testing.T) {
+	el := &Log{MaxHosts: 2}
+	el.AddEvent(HostPoll, server.New("06:66:de:ad:be:01", "10.0.0.1", ""), "", "", nil)
+	el.AddEvent(HostPoll, server.New("06:66:de:ad:be:02", "10.0.0.2", ""), "", "", nil)
+	el.AddEvent(HostPoll, server.New("06:66:de:ad:be:01", "10.0.0.1", ""), "", "", nil)
+	el.AddEvent(HostPoll, server.New("06:66:de:ad:be:03", "10.0.0.3", ""), "", "", nil)
+
+	events := el.List()
+	if len(events) != 2 || events["06:66:de:ad:be:02"] != nil || len(events["06:66:de:ad:be:01"]) != 2 {
+		t.Errorf("Expected: the host without recent events dropped\nGot: %v", events)
+	}
+	if _, ok := el.FindServer("10.0.0.2"); ok {
+		t.Error("Expected: IP of the dropped host unknown\nGot: found")
+	}
+	if srv, ok := el.FindServer("10.0.0.3"); !ok || srv.Mac != "06:66:de:ad:be:03" {
+		t.Errorf("Expected: 06:66:de:ad:be:03\nGot: %v", srv)
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/thousandeyes/shoelaces/internal/log"
+	"github.com/thousandeyes/shoelaces/internal/server"
+)
+
+// Installation phases usually reported by hosts through the callback
+// endpoint, in order. Other phases are accepted too.
+const (
+	PhaseKernelFetched    = "kernel-fetched"
+	PhaseInstallerStarted = "installer-started"
+	PhaseInstallComplete  = "install-complete"
+	PhaseFirstBoot        = "first-boot"
+)
+
+var phaseRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// PhaseEntry holds a phase reported by a host, along with its date.
+type PhaseEntry struct {
+	Phase string    `json:"phase"`
+	Date  time.Time `json:"date"`
+}
+
+// Timeline holds the progress of the last installation of a host, built
+// from its events since it last booted.
+type Timeline struct {
+	Server server.Server `json:"server"`
+	Script string        `json:"script"`
+	Booted time.Time     `json:"booted"`
+	Phases []PhaseEntry  `json:"phases"`
+	Done   bool          `json:"done"`
+	Stuck  bool          `json:"stuck"`
+}
+
+// IsValidPhase returns true if phase can be used as a phase name.
+func IsValidPhase(phase string) bool {
+	return phaseRegex.MatchString(phase)
+}
+
+// LastPhase returns the last phase reported, if any.
+func (t Timeline) LastPhase() string {
+	if len(t.Phases) == 0 {
+		return ""
+	}
+	return t.Phases[len(t.Phases)-1].Phase
+}
+
+// AddProgressEvent adds a HostProgress Event into the event log. The
+// server is completed with the data of the previous events of the host.
+// Only hosts that booted from Shoelaces report progress, so the event is
+// dropped, returning false, for any other.
+func (el *Log) AddProgressEvent(srv server.Server, phase string) bool {
+	el.Lock()
+	defer el.Unlock()
+
+	if !el.booted(srv.Mac) {
+		return false
+	}
+	e := New(HostProgress, el.complete(srv), "", "", nil)
+	e.Phase = phase
+	e.setMessage()
+	el.add(e)
+	return true
+}
+
+// Timelines returns the timeline of every host that booted, indexed by MAC.
+func (el *Log) Timelines() map[string]Timeline {
+	el.RLock()
+	defer el.RUnlock()
+
+	ret := make(map[string]Timeline)
+	for mac, events := range el.Events {
+		if t, ok := timeline(events); ok {
+			ret[mac] = t
+		}
+	}
+	return ret
+}
+
+// FlagStuck adds a HostStuck Event for each host that booted more than
+// deadline ago without finishing its installation. Hosts are flagged once
+// per boot. It returns the flagged timelines.
+func (el *Log) FlagStuck(deadline time.Duration, now time.Time) []Timeline {
+	el.Lock()
+	defer el.Unlock()
+
+	flagged := make([]Timeline, 0)
+	for _, events := range el.Events {
+		t, ok := timeline(events)
+		if !ok || t.Done || t.Stuck || now.Sub(t.Booted) < deadline {
+			continue
+		}
+		e := New(HostStuck, t.Server, "", t.Script, nil)
+		e.Phase = t.LastPhase()
+		e.setMessage()
+		el.add(e)
+
+		t.Stuck = true
+		flagged = append(flagged, t)
+	}
+	sort.Slice(flagged, func(i, j int) bool { return flagged[i].Server.Mac < flagged[j].Server.Mac })
+	return flagged
+}
+
+// timeline builds the timeline of a host from its events since the last
+// HostBoot one. It returns false if the host never booted.
+func timeline(events []Event) (Timeline, bool) {
+	var t Timeline
+	booted := false
+	for _, e := range events {
+		switch e.Type {
+		case HostBoot:
+			t = Timeline{Server: e.Server, Script: e.Script, Booted: e.Date, Phases: make([]PhaseEntry, 0)}
+			booted = true
+		case HostProgress:
+			if !booted {
+				continue
+			}
+			t.Phases = append(t.Phases, PhaseEntry{Phase: e.Phase, Date: e.Date})
+			if e.Phase == PhaseInstallComplete || e.Phase == PhaseFirstBoot {
+				t.Done = true
+			}
+		case HostStuck:
+			t.Stuck = true
+		}
+	}
+	return t, booted
+}
+
+// StartStuckChecker spawns a goroutine that flags the hosts not finishing
+// their installation before the deadline. A zero deadline disables it.
+func StartStuckChecker(logger log.Logger, eventLog *Log, deadline time.Duration) {
+	const checkInterval = time.Minute
+
+	if deadline <= 0 {
+		return
+	}
+	go func() {
+		for {
+			time.Sleep(checkInterval)
+
+			for _, t := range eventLog.FlagStuck(deadline, time.Now()) {
+				logger.Info("installation stuck", "component", "event", "mac", t.Server.Mac, "host", t.Server.Hostname, "script", t.Script, "phase", t.LastPhase())
+			}
+		}
+	}()
+}
@@ -0,0 +1,106 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"testing"
+	"time"
+
+	"github.com/thousandeyes/shoelaces/internal/server"
+)
+
+func TestIsValidPhase(t *testing.T) {
+	for _, phase := range []string{PhaseKernelFetched, PhaseFirstBoot, "custom_phase-2"} {
+		if !IsValidPhase(phase) {
+			t.Errorf("Expected: %s to be valid\nGot: invalid", phase)
+		}
+	}
+	for _, phase := range []string{"", "-start", "Install", "a/b", "a b"} {
+		if IsValidPhase(phase) {
+			t.Errorf("Expected: %q to be invalid\nGot: valid", phase)
+		}
+	}
+}
+
+func TestTimelines(t *testing.T) {
+	el := &Log{}
+	srv := server.New("06:66:de:ad:be:ef", "10.0.0.1", "host1")
+
+	if el.AddProgressEvent(srv, PhaseFirstBoot) {
+		t.Error("Expected: progress of a host that didn't boot dropped\nGot: recorded")
+	}
+	if len(el.Timelines()) != 0 || len(el.List()) != 0 {
+		t.Errorf("Expected: no timelines before booting\nGot: %v", el.Timelines())
+	}
+
+	el.AddHostBootEvent(srv, ManualBoot, "ubuntu.ipxe", nil, "")
+	el.AddProgressEvent(server.New(srv.Mac, "10.0.0.1", ""), PhaseKernelFetched)
+	el.AddProgressEvent(server.New(srv.Mac, "10.0.0.1", ""), PhaseInstallerStarted)
+
+	tl, ok := el.Timelines()[srv.Mac]
+	if !ok {
+		t.Fatal("Expected: a timeline\nGot: none")
+	}
+	if tl.Script != "ubuntu.ipxe" || len(tl.Phases) != 2 || tl.LastPhase() != PhaseInstallerStarted || tl.Done {
+		t.Errorf("Expected: ubuntu.ipxe in progress at %s\nGot: %v", PhaseInstallerStarted, tl)
+	}
+	if events := el.List()[srv.Mac]; events[len(events)-1].Server.Hostname != "host1" {
+		t.Errorf("Expected: hostname of the previous events\nGot: %v", events[len(events)-1].Server)
+	}
+
+	el.AddProgressEvent(srv, PhaseInstallComplete)
+	if tl := el.Timelines()[srv.Mac]; !tl.Done {
+		t.Errorf("Expected: done timeline\nGot: %v", tl)
+	}
+
+	// A new boot starts a new timeline.
+	el.AddHostBootEvent(srv, ManualBoot, "debian.ipxe", nil, "")
+	if tl := el.Timelines()[srv.Mac]; tl.Done || len(tl.Phases) != 0 || tl.Script != "debian.ipxe" {
+		t.Errorf("Expected: new timeline\nGot: %v", tl)
+	}
+}
+
+func TestFlagStuck(t *testing.T) {
+	el := &Log{}
+	stuck := server.New("06:66:de:ad:be:01", "10.0.0.1", "stuck")
+	done := server.New("06:66:de:ad:be:02", "10.0.0.2", "done")
+
+	el.AddHostBootEvent(stuck, ManualBoot, "ubuntu.ipxe", nil, "")
+	el.AddProgressEvent(stuck, PhaseInstallerStarted)
+	el.AddHostBootEvent(done, ManualBoot, "ubuntu.ipxe", nil, "")
+	el.AddProgressEvent(done, PhaseInstallComplete)
+
+	if flagged := el.FlagStuck(time.Hour, time.Now()); len(flagged) != 0 {
+		t.Errorf("Expected: no stuck hosts before the deadline\nGot: %v", flagged)
+	}
+
+	later := time.Now().Add(2 * time.Hour)
+	flagged := el.FlagStuck(time.Hour, later)
+	if len(flagged) != 1 || flagged[0].Server.Mac != stuck.Mac {
+		t.Fatalf("Expected: %s flagged\nGot: %v", stuck.Mac, flagged)
+	}
+	events := el.List()[stuck.Mac]
+	last := events[len(events)-1]
+	if last.Type != HostStuck || last.Phase != PhaseInstallerStarted {
+		t.Errorf("Expected: HostStuck event at %s\nGot: %v", PhaseInstallerStarted, last)
+	}
+	if !el.Timelines()[stuck.Mac].Stuck {
+		t.Error("Expected: stuck timeline\nGot: not stuck")
+	}
+
+	if flagged := el.FlagStuck(time.Hour, later); len(flagged) != 0 {
+		t.Errorf("Expected: hosts flagged once\nGot: %v", flagged)
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	// headerTimeout is how long servers have to start answering.
+	headerTimeout = 30 * time.Second
+	// idleTimeout is how long downloads can stall before being canceled.
+	idleTimeout = time.Minute
+)
+
+// NewClient returns an HTTP client failing the requests of servers taking
+// longer than headerTimeout to start answering.
+func NewClient() *http.Client {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.ResponseHeaderTimeout = headerTimeout
+	return &http.Client{Transport: t}
+}
+
+// Response is the answer to a download request. The request is canceled if
+// the body stalls for idleTimeout.
+type Response struct {
+	*http.Response
+	cancel   context.CancelFunc
+	watchdog *time.Timer
+}
+
+// Get sends req with client. The response must be closed.
+func Get(client *http.Client, req *http.Request) (*Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	watchdog := time.AfterFunc(idleTimeout, cancel)
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		watchdog.Stop()
+		cancel()
+		return nil, err
+	}
+	return &Response{Response: resp, cancel: cancel, watchdog: watchdog}, nil
+}
+
+// Close closes the body and releases the request.
+func (r *Response) Close() error {
+	r.watchdog.Stop()
+	r.cancel()
+	return r.Body.Close()
+}
+
+// Options are the checks and callbacks of Save.
+type Options struct {
+	MaxSize  int64             // Unlimited if 0
+	SHA256   string            // Not checked if empty
+	Created  func(path string) // Called once the file is created
+	Progress func(size int64)  // Called with the bytes written so far
+}
+
+// Save writes the body into a new temporary file in dir, checking it's
+// complete and it matches the checksum of opts. It returns the path of the
+// file, for the caller to move or remove, along with its size and SHA-256.
+// The file is removed on errors.
+func (r *Response) Save(dir string, opts Options) (string, int64, string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", 0, "", err
+	}
+	tmp, err := os.CreateTemp(dir, "download-")
+	if err != nil {
+		return "", 0, "", err
+	}
+	if opts.Created != nil {
+		opts.Created(tmp.Name())
+	}
+
+	sum, size, err := r.copy(tmp, opts)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", 0, "", err
+	}
+	return tmp.Name(), size, sum, nil
+}
+
+func (r *Response) copy(w io.Writer, opts Options) (string, int64, error) {
+	sum, size, err := Checksum(io.TeeReader(r.Body, w), func(size int64) {
+		r.watchdog.Reset(idleTimeout)
+		if opts.Progress != nil {
+			opts.Progress(size)
+		}
+	}, opts.MaxSize)
+	if err != nil {
+		return "", 0, err
+	}
+	if r.ContentLength >= 0 && size != r.ContentLength {
+		return "", 0, fmt.Errorf("truncated download, %d of %d bytes", size, r.ContentLength)
+	}
+	if opts.SHA256 != "" && sum != opts.SHA256 {
+		return "", 0, fmt.Errorf("checksum mismatch, expected %s, got %s", opts.SHA256, sum)
+	}
+	return sum, size, nil
+}
+
+// ErrTooLarge is returned when a file is larger than its maximum size.
+var ErrTooLarge = errors.New("file too large")
+
+// Checksum returns the SHA-256 of what r reads, and its size, calling
+// progress with the bytes read so far. It fails with ErrTooLarge after
+// maxSize bytes, if positive.
+func Checksum(r io.Reader, progress func(size int64), maxSize int64) (string, int64, error) {
+	hash := sha256.New()
+	buf := make([]byte, 64*1024)
+	var size int64
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			hash.Write(buf[:n])
+			size += int64(n)
+			if maxSize > 0 && size > maxSize {
+				return "", 0, ErrTooLarge
+			}
+			if progress != nil {
+				progress(size)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", 0, err
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
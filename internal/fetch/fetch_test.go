@@ -0,0 +1,75 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func sum(data string) string {
+	s := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(s[:])
+}
+
+func TestSave(t *testing.T) {
+	const data = "kernel"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(data))
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+
+	save := func(opts Options) (string, int64, string, error) {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		resp, err := Get(NewClient(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Close()
+		return resp.Save(dir, opts)
+	}
+
+	var created string
+	var progress int64
+	p, size, got, err := save(Options{
+		SHA256:   sum(data),
+		Created:  func(p string) { created = p },
+		Progress: func(size int64) { progress = size },
+	})
+	if err != nil || p != created || size != int64(len(data)) || progress != size || got != sum(data) {
+		t.Errorf("Expected: %s saved\nGot: %s %d %s %v", data, p, size, got, err)
+	}
+	if contents, _ := os.ReadFile(p); string(contents) != data {
+		t.Errorf("Expected: %s\nGot: %s", data, contents)
+	}
+	os.Remove(p)
+
+	if _, _, _, err := save(Options{SHA256: sum("other")}); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("Expected: checksum mismatch\nGot: %v", err)
+	}
+	if _, _, _, err := save(Options{MaxSize: 3}); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected: %v\nGot: %v", ErrTooLarge, err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Expected: failed downloads removed\nGot: %v", files)
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+)
+
+// AssetHandler serves the verified files of the assets of assets.yaml.
+func AssetHandler(w http.ResponseWriter, r *http.Request) {
+	env := envFromRequest(r)
+	if env.Assets == nil {
+		http.Error(w, "No assets configured", http.StatusNotFound)
+		return
+	}
+	env.Assets.ServeHTTP(w, r)
+}
+
+// ListAssets returns a JSON list of the files of the assets, with their
+// download and verification state.
+func ListAssets(w http.ResponseWriter, r *http.Request) {
+	env := envFromRequest(r)
+	assets, err := json.Marshal(env.Assets.Status())
+	if err != nil {
+		env.Logger.Error("marshal assets failed", "component", "handler", "err", err)
+		os.Exit(1)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(assets)
+}
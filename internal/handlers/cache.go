@@ -0,0 +1,30 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"net/http"
+)
+
+// CacheHandler serves the files of the mirrors cached by Shoelaces. The
+// path of the request is the mirror name followed by the path of the file.
+func CacheHandler(w http.ResponseWriter, r *http.Request) {
+	env := envFromRequest(r)
+	if env.Cache == nil {
+		http.Error(w, "No cache configured", http.StatusNotFound)
+		return
+	}
+	env.Cache.ServeHTTP(w, r)
+}
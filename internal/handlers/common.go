@@ -18,9 +18,15 @@ import (
 	"html/template"
 	"net/http"
 
+	"github.com/thousandeyes/shoelaces/internal/assets"
 	"github.com/thousandeyes/shoelaces/internal/environment"
+	"github.com/thousandeyes/shoelaces/internal/hosts"
 	"github.com/thousandeyes/shoelaces/internal/ipxe"
+	"github.com/thousandeyes/shoelaces/internal/ipxebin"
 	"github.com/thousandeyes/shoelaces/internal/mappings"
+	"github.com/thousandeyes/shoelaces/internal/polling"
+	"github.com/thousandeyes/shoelaces/internal/redact"
+	"github.com/thousandeyes/shoelaces/internal/server"
 )
 
 // DefaultTemplateRenderer holds information for rendering a template based
@@ -39,22 +45,78 @@ func (t *DefaultTemplateRenderer) ServeHTTP(w http.ResponseWriter, r *http.Reque
 	tpl := env.StaticTemplates
 	// XXX: Probably not ideal as it's doing the directory listing on every request
 	ipxeScripts := ipxe.ScriptList(env)
+	hostnameMaps := redactHostnameMaps(env.Redactor, env.HostnameMaps)
+	networkMaps := redactNetworkMaps(env.Redactor, env.NetworkMaps)
 	tplVars := struct {
 		BaseURL      string
 		HostnameMaps *[]mappings.HostnameMap
 		NetworkMaps  *[]mappings.NetworkMap
 		Scripts      *[]ipxe.Script
+		Hosts        []hosts.Host
+		Pending      server.Assignments
+		Binaries     []ipxebin.Binary
+		Assets       []assets.FileStatus
+		CSRFToken    string
 	}{
 		env.BaseURL,
-		&env.HostnameMaps,
-		&env.NetworkMaps,
+		&hostnameMaps,
+		&networkMaps,
 		&ipxeScripts,
+		redactHosts(env.Redactor, env.Hosts.List()),
+		redactPending(env.Redactor, polling.ListPending(env.ServerStates)),
+		nil,
+		nil,
+		csrfToken(w, r),
+	}
+	if t.templateName == "downloads" {
+		tplVars.Binaries = ipxeBinaries(env)
+	}
+	if t.templateName == "assets" {
+		tplVars.Assets = env.Assets.Status()
 	}
 	renderTemplate(w, tpl, "header", tplVars)
 	renderTemplate(w, tpl, t.templateName, tplVars)
 	renderTemplate(w, tpl, "footer", tplVars)
 }
 
+// redactHostnameMaps returns a copy of maps with the script parameters
+// masked, to be shown in the web frontend.
+func redactHostnameMaps(r *redact.Redactor, maps []mappings.HostnameMap) []mappings.HostnameMap {
+	ret := make([]mappings.HostnameMap, len(maps))
+	for i, m := range maps {
+		ret[i] = mappings.HostnameMap{Hostname: m.Hostname, Script: m.Script.Redacted(r)}
+	}
+	return ret
+}
+
+// redactNetworkMaps returns a copy of maps with the script parameters
+// masked, to be shown in the web frontend.
+func redactNetworkMaps(r *redact.Redactor, maps []mappings.NetworkMap) []mappings.NetworkMap {
+	ret := make([]mappings.NetworkMap, len(maps))
+	for i, m := range maps {
+		ret[i] = mappings.NetworkMap{Network: m.Network, Script: m.Script.Redacted(r)}
+	}
+	return ret
+}
+
+// redactHosts masks the secret values in the params of hosts before they are
+// shown in the web frontend.
+func redactHosts(r *redact.Redactor, hs []hosts.Host) []hosts.Host {
+	for i := range hs {
+		hs[i].Params = r.Params(hs[i].Params)
+	}
+	return hs
+}
+
+// redactPending masks the secret values in the params of pending
+// assignments before they are shown in the web frontend or the API.
+func redactPending(r *redact.Redactor, pending server.Assignments) server.Assignments {
+	for i := range pending {
+		pending[i].Params = r.Params(pending[i].Params)
+	}
+	return pending
+}
+
 func renderTemplate(w http.ResponseWriter, tpl *template.Template, tmpl string, d interface{}) {
 	err := tpl.ExecuteTemplate(w, tmpl, d)
 	if err != nil {
@@ -0,0 +1,157 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/thousandeyes/shoelaces/internal/csrf"
+)
+
+// bootPaths holds the prefixes of the endpoints used by booting hosts and
+// installers, which don't send the Origin or Referer headers of a browser.
+var bootPaths = []string{"/start", "/poll/", "/ipxemenu", "/configs/", "/callback/"}
+
+// csrfToken returns the CSRF token of the session of the request, setting
+// the session cookie if the browser doesn't have one yet.
+func csrfToken(w http.ResponseWriter, r *http.Request) string {
+	env := envFromRequest(r)
+	secret := ""
+	if c, err := r.Cookie(csrf.CookieName); err == nil {
+		secret = c.Value
+	}
+	if secret == "" {
+		var err error
+		if secret, err = csrf.NewSecret(); err != nil {
+			env.Logger.Error("generate CSRF secret failed", "component", "http", "err", err)
+			return ""
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     csrf.CookieName,
+			Value:    secret,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+	return env.CSRF.Token(secret)
+}
+
+// CSRFCheck denies the state-changing requests of the web frontend without
+// the CSRF token of the pages rendered by DefaultTemplateRenderer, in the
+// csrf_token form field or the X-CSRF-Token header. Requests with the
+// bearer token of the API scripts are exempt, as browsers don't add it on
+// their own. The token is removed from the form before calling h.
+func CSRFCheck(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		env := envFromRequest(r)
+		if hasAPIToken(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		token := r.Header.Get(csrf.HeaderName)
+		if token == "" {
+			token = r.PostForm.Get(csrf.FieldName)
+		}
+		r.PostForm.Del(csrf.FieldName)
+		r.Form.Del(csrf.FieldName)
+
+		secret := ""
+		if c, err := r.Cookie(csrf.CookieName); err == nil {
+			secret = c.Value
+		}
+		if err := env.CSRF.Verify(secret, token); err != nil {
+			env.Logger.Warn("CSRF check failed", "component", "http", "type", "security", "src", r.RemoteAddr, "url", r.URL, "err", err)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// sameOriginMiddleware denies the state-changing requests whose Origin, or
+// Referer if there is no Origin, isn't Shoelaces itself. Requests without
+// any of them, with the bearer token of the API scripts or to the boot
+// endpoints are let through.
+func sameOriginMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			h.ServeHTTP(w, r)
+			return
+		}
+		if hasAPIToken(r) || isBootPath(r.URL.Path) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		source := r.Header.Get("Origin")
+		if source == "" {
+			source = r.Header.Get("Referer")
+		}
+		if source == "" || isSameOrigin(r, source) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		env := envFromRequest(r)
+		env.Logger.Warn("cross-origin request denied", "component", "http", "type", "security", "src", r.RemoteAddr, "url", r.URL, "origin", source)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	})
+}
+
+// isSameOrigin reports whether source, an Origin or Referer header, points
+// to the host of the request or of the base URL.
+func isSameOrigin(r *http.Request, source string) bool {
+	u, err := url.Parse(source)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	base := envFromRequest(r).BaseURL
+	if !strings.Contains(base, "://") {
+		base = "http://" + base
+	}
+	b, err := url.Parse(base)
+	return err == nil && strings.EqualFold(u.Host, b.Host)
+}
+
+// hasAPIToken reports whether the request has the api-token setting as
+// bearer token. No request has it if the setting is empty.
+func hasAPIToken(r *http.Request) bool {
+	apiToken := envFromRequest(r).APIToken
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	return apiToken != "" && ok && strings.EqualFold(scheme, "Bearer") &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(apiToken)) == 1
+}
+
+func isBootPath(path string) bool {
+	for _, p := range bootPaths {
+		if path == p || strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/thousandeyes/shoelaces/internal/csrf"
+	"github.com/thousandeyes/shoelaces/internal/environment"
+	"github.com/thousandeyes/shoelaces/internal/log"
+)
+
+func TestCSRFCheckAPIToken(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := sameOriginMiddleware(CSRFCheck(ok))
+	c, err := csrf.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		apiToken string
+		header   string
+		status   int
+	}{
+		{"", "Bearer anything", http.StatusForbidden},
+		{"s3cret", "Bearer wrong", http.StatusForbidden},
+		{"s3cret", "Basic s3cret", http.StatusForbidden},
+		{"s3cret", "Bearer s3cret", http.StatusOK},
+		{"s3cret", "bearer s3cret", http.StatusOK},
+	} {
+		env := &environment.Environment{APIToken: tc.apiToken, CSRF: c, Logger: log.MakeLogger(io.Discard)}
+		r := httptest.NewRequest("POST", "/update/target", strings.NewReader("mac=06:66:de:ad:be:ef"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Origin", "http://evil.example")
+		r.Header.Set("Authorization", tc.header)
+		r = r.WithContext(context.WithValue(r.Context(), ShoelacesEnvCtxID, env))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tc.status {
+			t.Errorf("Expected: %d for %q with api-token %q\nGot: %d", tc.status, tc.header, tc.apiToken, w.Code)
+		}
+	}
+}
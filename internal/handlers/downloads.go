@@ -0,0 +1,115 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/thousandeyes/shoelaces/internal/server"
+	"github.com/thousandeyes/shoelaces/internal/utils"
+)
+
+// downloadRecorder is an http.ResponseWriter keeping the status and size of
+// the response.
+type downloadRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (d *downloadRecorder) WriteHeader(status int) {
+	if d.status == 0 {
+		d.status = status
+	}
+	d.ResponseWriter.WriteHeader(status)
+}
+
+func (d *downloadRecorder) Write(b []byte) (int, error) {
+	if d.status == 0 {
+		d.status = http.StatusOK
+	}
+	n, err := d.ResponseWriter.Write(b)
+	d.size += int64(n)
+	return n, err
+}
+
+// ReadFrom lets io.Copy use the io.ReaderFrom of the underlying
+// http.ResponseWriter, such as sendfile for http.ServeContent.
+func (d *downloadRecorder) ReadFrom(r io.Reader) (int64, error) {
+	if d.status == 0 {
+		d.status = http.StatusOK
+	}
+	n, err := io.Copy(d.ResponseWriter, r)
+	d.size += n
+	return n, err
+}
+
+// Unwrap returns the underlying http.ResponseWriter for
+// http.ResponseController.
+func (d *downloadRecorder) Unwrap() http.ResponseWriter {
+	return d.ResponseWriter
+}
+
+// DownloadTracker records the files downloaded through h in the events log.
+// The host downloading a file is identified by the mac query parameter, if
+// it booted from Shoelaces, or else by its IP, as the host of the last event
+// with that IP.
+// Downloads of unknown hosts, and HEAD requests, aren't recorded. Files are
+// named after their path without prefix.
+func DownloadTracker(prefix string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			h.ServeHTTP(w, r)
+			return
+		}
+		rec := &downloadRecorder{ResponseWriter: w}
+		h.ServeHTTP(rec, r)
+
+		env := envFromRequest(r)
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return
+		}
+
+		srv, ok := downloadingServer(r, ip)
+		if !ok {
+			env.Logger.Debug("download from unknown host", "component", "handler", "ip", ip, "url", r.URL)
+			return
+		}
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		name := strings.TrimPrefix(r.URL.Path, prefix)
+		env.EventLog.AddDownloadEvent(srv, name, envNameFromRequest(r), rec.status, rec.size)
+	})
+}
+
+func downloadingServer(r *http.Request, ip string) (server.Server, bool) {
+	env := envFromRequest(r)
+
+	// The mac parameter is only trusted for hosts that booted, so clients
+	// can't fill the events log with made up hosts.
+	if mac := strings.ToLower(utils.MacDashToColon(r.URL.Query().Get("mac"))); utils.IsValidMAC(mac) && env.EventLog.Booted(mac) {
+		return server.New(mac, ip, r.URL.Query().Get("hostname")), true
+	}
+	srv, ok := env.EventLog.FindServer(ip)
+	if !ok {
+		return srv, false
+	}
+	return server.New(srv.Mac, ip, ""), true
+}
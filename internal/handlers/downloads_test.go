@@ -0,0 +1,42 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDownloadRecorder(t *testing.T) {
+	w := httptest.NewRecorder()
+	rec := &downloadRecorder{ResponseWriter: w}
+
+	if n, err := io.Copy(rec, strings.NewReader("kernel")); err != nil || n != 6 {
+		t.Errorf("Expected: 6 bytes copied\nGot: %d, %v", n, err)
+	}
+	if rec.status != http.StatusOK || rec.size != 6 {
+		t.Errorf("Expected: status 200 and size 6\nGot: %d and %d", rec.status, rec.size)
+	}
+	if w.Body.String() != "kernel" {
+		t.Errorf("Expected: kernel\nGot: %s", w.Body.String())
+	}
+
+	if err := http.NewResponseController(rec).Flush(); err != nil || !w.Flushed {
+		t.Errorf("Expected: flushed response\nGot: %v", err)
+	}
+}
@@ -16,15 +16,21 @@ package handlers
 
 import (
 	"encoding/json"
+	"net"
 	"net/http"
 	"os"
+	"strings"
+
+	"github.com/thousandeyes/shoelaces/internal/event"
+	"github.com/thousandeyes/shoelaces/internal/server"
+	"github.com/thousandeyes/shoelaces/internal/utils"
 )
 
 // ListEvents returns a JSON list of the logged events.
 func ListEvents(w http.ResponseWriter, r *http.Request) {
 	// Get Environment and convert the EventLog to JSON
 	env := envFromRequest(r)
-	eventList, err := json.Marshal(env.EventLog.Events)
+	eventList, err := json.Marshal(env.EventLog.List())
 	if err != nil {
 		env.Logger.Error("marshal events failed", "component", "handler", "err", err)
 		os.Exit(1)
@@ -34,3 +40,48 @@ func ListEvents(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(eventList)
 }
+
+// ListTimelines returns a JSON list of the installation timelines of the
+// hosts that booted.
+func ListTimelines(w http.ResponseWriter, r *http.Request) {
+	env := envFromRequest(r)
+	timelines, err := json.Marshal(env.EventLog.Timelines())
+	if err != nil {
+		env.Logger.Error("marshal timelines failed", "component", "handler", "err", err)
+		os.Exit(1)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(timelines)
+}
+
+// CallbackHandler is called by installers and booted hosts to report the
+// progress of their installation, e.g. /callback/{mac}/install-complete.
+// Hosts that didn't boot from Shoelaces get a 404.
+func CallbackHandler(w http.ResponseWriter, r *http.Request) {
+	env := envFromRequest(r)
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	mac := strings.ToLower(utils.MacDashToColon(r.PathValue("mac")))
+	phase := r.PathValue("phase")
+	if !utils.IsValidMAC(mac) {
+		http.Error(w, "Invalid MAC", http.StatusBadRequest)
+		return
+	}
+	if !event.IsValidPhase(phase) {
+		http.Error(w, "Invalid phase", http.StatusBadRequest)
+		return
+	}
+
+	if !env.EventLog.AddProgressEvent(server.New(mac, ip, ""), phase) {
+		env.Logger.Info("progress of unknown host", "component", "handler", "mac", mac, "ip", ip, "phase", phase)
+		http.Error(w, "Unknown host", http.StatusNotFound)
+		return
+	}
+	env.Logger.Info("host progress", "component", "handler", "mac", mac, "ip", ip, "phase", phase)
+}
@@ -0,0 +1,106 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"errors"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/thousandeyes/shoelaces/internal/butane"
+	"github.com/thousandeyes/shoelaces/internal/environment"
+	"github.com/thousandeyes/shoelaces/internal/ignition"
+	"github.com/thousandeyes/shoelaces/internal/signing"
+	"github.com/thousandeyes/shoelaces/internal/utils"
+)
+
+// configFormat returns the extension of the file a config is named after,
+// or else of the file its template is defined in, e.g. ".ign".
+func configFormat(env *environment.Environment, configName, envName string) string {
+	if ext := path.Ext(configName); ext != "" {
+		return ext
+	}
+	return env.Templates.Format(configName, envName)
+}
+
+// IsIgnition reports whether a config is an Ignition config, rendered from
+// Ignition JSON or from Butane YAML.
+func IsIgnition(env *environment.Environment, configName, envName string) bool {
+	format := configFormat(env, configName, envName)
+	return format == ".ign" || format == ".bu"
+}
+
+// transpileButane returns the Ignition config of a rendered Butane template.
+func transpileButane(env *environment.Environment, configName, rendered string) (string, error) {
+	out, err := butane.Transpile([]byte(rendered))
+	if err != nil {
+		env.Logger.Info("invalid Butane config", "component", "template", "template", configName, "err", err)
+		return "", err
+	}
+	return string(out), nil
+}
+
+// resolveIgnition validates a rendered Ignition config, and merges into it
+// the configs of its ignition.config.merge list served by Shoelaces. They
+// are rendered with the parameters of the config, overridden by the ones of
+// their URL, but for the signature ones. Configs needing a signature are
+// only merged if their URL has a valid one, as when Ignition fetches them.
+func resolveIgnition(env *environment.Environment, envName, configName string, params map[string]interface{}, config string) (string, error) {
+	baseURL, _ := params["baseURL"].(string)
+	prefix, err := utils.BaseURLJoin(baseURL, "/configs/")
+	if err != nil {
+		return "", err
+	}
+	render := func(name string, query url.Values) (string, error) {
+		if env.Signer.Required(name) {
+			u, err := utils.BaseURLJoin(baseURL, "/configs/"+name)
+			if err == nil {
+				err = env.Signer.Verify(u.Path, query, time.Now())
+			}
+			if err != nil {
+				env.Logger.Warn("merged config signature check failed", "component", "template", "type", "security",
+					"template", configName, "config", name, "err", err)
+				return "", err
+			}
+		}
+		fragmentParams := make(map[string]interface{}, len(params)+len(query))
+		for k, v := range params {
+			fragmentParams[k] = v
+		}
+		for k, v := range query {
+			if k == signing.SignatureParam || k == signing.ExpiresParam || k == signing.MacParam {
+				continue
+			}
+			fragmentParams[k] = v[0]
+		}
+		_, body, err := renderConfig(env, envName, name, fragmentParams)
+		return body, err
+	}
+
+	resolved, warns, err := ignition.Resolve(configName, []byte(config), prefix.String(), render)
+	for _, w := range warns {
+		env.Logger.Warn("Ignition config field ignored", "component", "template", "template", configName, "warning", w)
+	}
+	// Merged configs failing to render or transpile were already logged.
+	var vErr *ignition.ValidationError
+	if errors.As(err, &vErr) {
+		env.Logger.Info("invalid Ignition config", "component", "template", "template", configName, "err", err)
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(resolved), nil
+}
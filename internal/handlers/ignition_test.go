@@ -0,0 +1,85 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thousandeyes/shoelaces/internal/environment"
+	"github.com/thousandeyes/shoelaces/internal/log"
+	"github.com/thousandeyes/shoelaces/internal/overrides"
+	"github.com/thousandeyes/shoelaces/internal/signing"
+	"github.com/thousandeyes/shoelaces/internal/templates"
+)
+
+func TestSignedMergedConfig(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"ignition/main.ign.slc":   `{{define "main.ign"}}{"ignition": {"version": "3.4.0", "config": {"merge": [{"source": "{{.fragment}}"}]}}}{{end}}`,
+		"ignition/secret.ign.slc": `{{define "secret.ign"}}{"ignition": {"version": "3.4.0"}, "passwd": {"users": [{"name": "core", "gecos": "{{if or .signature .expires}}signed{{end}}"}]}}{{end}}`,
+	}
+	for name, contents := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tree, err := overrides.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := signing.New("key", time.Hour, []string{"secret.ign"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := &environment.Environment{
+		DataDir:   dir,
+		BaseURL:   "localhost:8081",
+		Overrides: tree,
+		Signer:    signer,
+		Templates: templates.New(),
+		Logger:    log.MakeLogger(io.Discard),
+	}
+	env.Templates.ParseTemplates(env.Logger, dir, "env_overrides", tree, ".slc")
+
+	params := map[string]interface{}{"baseURL": "localhost:8081", "mac": "06:66:de:ad:be:ef"}
+	signed, err := signer.SignedURL(params, "secret.ign")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for fragment, merged := range map[string]bool{
+		"http://localhost:8081/configs/secret.ign": false,
+		signed:              true,
+		signed + "&role=db": false,
+	} {
+		params["fragment"] = fragment
+		_, body, err := RenderConfig(env, "", "main.ign", params)
+		// The signature parameters aren't template parameters.
+		if merged && (err != nil || !strings.Contains(body, `"core"`) || strings.Contains(body, "signed")) {
+			t.Errorf("Expected: %s merged\nGot: %v %s", fragment, err, body)
+		}
+		if !merged && err == nil {
+			t.Errorf("Expected: error for %s\nGot: %s", fragment, body)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/thousandeyes/shoelaces/internal/environment"
+	"github.com/thousandeyes/shoelaces/internal/ipxebin"
+)
+
+// IPXEBinary serves the binaries of the iPXE dir. With the embed query
+// parameter, the script chaining the start endpoint of the environment is
+// embedded in the binary. The boot images are built from the EFI binary
+// given with the efi query parameter, ipxe.efi by default, with the script
+// as autoexec.ipxe, and embedded too if the binary has the placeholder.
+func IPXEBinary(w http.ResponseWriter, r *http.Request) {
+	env := envFromRequest(r)
+	if env.IPXEDir == "" {
+		http.Error(w, "No iPXE dir configured", http.StatusNotFound)
+		return
+	}
+	dir := path.Join(env.DataDir, env.IPXEDir)
+	name := r.PathValue("file")
+	script := ipxebin.StartScript(env.Overrides.BaseURL(env.BaseURL, envNameFromRequest(r)))
+	query := r.URL.Query()
+
+	readName := name
+	if name == ipxebin.ISOName || name == ipxebin.USBName {
+		readName = query.Get("efi")
+		if readName == "" {
+			readName = ipxebin.DefaultEFI
+		}
+	}
+	contents, err := ipxebin.Read(dir, readName)
+	if os.IsNotExist(err) {
+		http.Error(w, "Unknown iPXE binary", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		env.Logger.Error("serve ipxe binary failed", "component", "http", "file", name, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case name == ipxebin.ISOName:
+		contents, err = ipxebin.ISOImage(contents, script)
+	case name == ipxebin.USBName:
+		contents, err = ipxebin.USBImage(contents, script)
+	case query.Has("embed"):
+		contents, err = ipxebin.Embed(contents, script)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(contents))
+}
+
+// ipxeBinaries lists the binaries of the iPXE dir, for the web frontend.
+func ipxeBinaries(env *environment.Environment) []ipxebin.Binary {
+	if env.IPXEDir == "" {
+		return nil
+	}
+	binaries, err := ipxebin.List(path.Join(env.DataDir, env.IPXEDir))
+	if err != nil {
+		env.Logger.Error("list ipxe binaries failed", "component", "http", "err", err)
+	}
+	return binaries
+}
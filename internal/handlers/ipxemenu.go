@@ -15,49 +15,43 @@
 package handlers
 
 import (
-	"bytes"
-	"fmt"
 	"net/http"
 
 	"github.com/thousandeyes/shoelaces/internal/ipxe"
 )
 
-const menuHeader = "#!ipxe\n" +
-	"menu Choose target to boot\n"
-
-const menuFooter = "\n" +
-	"choose target\n" +
-	"echo -n Enter hostname or none:\n" +
-	"read hostname\n" +
-	"set baseurl %s\n" +
-	"# Boot it as intended.\n" +
-	"chain ${target}\n"
-
-// IPXEMenu serves the ipxe menu with list of all available scripts
+// IPXEMenu serves the iPXE menu of the requested environment. It's built
+// from the menu file, if any, and rendered with the menu template, if
+// defined, or the built-in one.
 func IPXEMenu(w http.ResponseWriter, r *http.Request) {
 	env := envFromRequest(r)
+	envName := envNameFromRequest(r)
 
-	scripts := ipxe.ScriptList(env)
-	if len(scripts) == 0 {
+	if !env.Overrides.Has(envName) {
+		http.Error(w, "Unknown environment", http.StatusNotFound)
+		return
+	}
+	menu, err := ipxe.BuildMenu(env, envName)
+	if err != nil {
+		env.Logger.Error("build ipxe menu failed", "component", "http", "environment", envName, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(menu.Entries) == 0 {
 		http.Error(w, "No Scripts Found", http.StatusInternalServerError)
 		return
 	}
 
-	var bootItemsBuffer bytes.Buffer
-	//Creates the top portion of the iPXE menu
-	bootItemsBuffer.WriteString(menuHeader)
-	for _, s := range scripts {
-		//Formats the bootable scripts separated by newlines into a single string
-		var desc string
-		if len(s.Env) > 0 {
-			desc = fmt.Sprintf("%s [%s]", s.Name, s.Env)
-		} else {
-			desc = string(s.Name)
-		}
-		bootItem := fmt.Sprintf("item %s%s %s\n", s.Path, s.Name, desc)
-		bootItemsBuffer.WriteString(bootItem)
+	var script string
+	if env.Templates.Has(ipxe.MenuTemplate, envName) {
+		params := map[string]interface{}{"menu": menu, "baseURL": menu.BaseURL}
+		script, err = env.Templates.RenderTemplate(env.Logger, ipxe.MenuTemplate, params, envName)
+	} else {
+		script, err = menu.Render()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
-	//Creates the bottom portion of the iPXE menu
-	bootItemsBuffer.WriteString(fmt.Sprintf(menuFooter, env.BaseURL))
-	w.Write(bootItemsBuffer.Bytes())
+	w.Write([]byte(script))
 }
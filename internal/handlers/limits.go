@@ -0,0 +1,98 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thousandeyes/shoelaces/internal/polling"
+	"github.com/thousandeyes/shoelaces/internal/ratelimit"
+	"github.com/thousandeyes/shoelaces/internal/utils"
+)
+
+// BootSourceCheck denies the boot endpoints to the sources out of the
+// networks of the boot-allow setting, if any.
+func BootSourceCheck(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		env := envFromRequest(r)
+		if len(env.BootNetworks) == 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+		if utils.InNetworks(ip, env.BootNetworks) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		env.Logger.Warn("boot source denied", "component", "http", "type", "security", "src", r.RemoteAddr, "url", r.URL)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	})
+}
+
+// BootRateLimit limits the iPXE requests of each source IP and, when the
+// route has a mac path value, of each MAC. Limited clients get a script
+// that sleeps and tries again, as iPXE gives up on HTTP errors.
+func BootRateLimit(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		env := envFromRequest(r)
+		ok, wait := allowRequest(r, time.Now())
+		if ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		env.Logger.Debug("boot request rate limited", "component", "http", "src", r.RemoteAddr, "url", r.URL, "wait", wait)
+		w.Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+		w.Write([]byte(polling.GenSleepScript(env.Logger, "http://"+env.BaseURL+r.RequestURI, wait)))
+	})
+}
+
+// RateLimit applies the same limits as BootRateLimit to the endpoints not
+// requested by iPXE, answering 429 to limited clients.
+func RateLimit(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		env := envFromRequest(r)
+		ok, wait := allowRequest(r, time.Now())
+		if ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		env.Logger.Debug("request rate limited", "component", "http", "src", r.RemoteAddr, "url", r.URL, "wait", wait)
+		w.Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+	})
+}
+
+// allowRequest applies the IP and, when the route has a mac path value,
+// the MAC rate limits to r, returning how long to wait if it's limited.
+func allowRequest(r *http.Request, now time.Time) (bool, time.Duration) {
+	env := envFromRequest(r)
+
+	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+	ok, wait := env.IPLimiter.Allow(ratelimit.IPKey(ip), now)
+	if ok {
+		if mac := r.PathValue("mac"); mac != "" {
+			ok, wait = env.MACLimiter.Allow(strings.ToLower(utils.MacDashToColon(mac)), now)
+		}
+	}
+	return ok, wait
+}
@@ -0,0 +1,41 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/thousandeyes/shoelaces/internal/environment"
+	"github.com/thousandeyes/shoelaces/internal/ratelimit"
+)
+
+func TestAllowRequestMACCase(t *testing.T) {
+	env := &environment.Environment{MACLimiter: ratelimit.New(1)}
+	now := time.Now()
+
+	for i, mac := range []string{"06-66-de-ad-be-ef", "06:66:DE:AD:BE:EF", "06-66-De-Ad-Be-Ef"} {
+		r := httptest.NewRequest("GET", "/poll/1/"+mac, nil)
+		r.SetPathValue("mac", mac)
+		r = r.WithContext(context.WithValue(r.Context(), ShoelacesEnvCtxID, env))
+
+		ok, _ := allowRequest(r, now)
+		if ok != (i == 0) {
+			t.Errorf("Expected: only the first request for %s allowed\nGot: %t for request %d", mac, ok, i)
+		}
+	}
+}
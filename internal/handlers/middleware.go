@@ -16,10 +16,13 @@ package handlers
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"regexp"
 
 	"github.com/thousandeyes/shoelaces/internal/environment"
+	"github.com/thousandeyes/shoelaces/internal/proxy"
+	"github.com/thousandeyes/shoelaces/internal/utils"
 )
 
 // ShoelacesCtxID Shoelaces Specific Request Context ID.
@@ -59,6 +62,25 @@ func loggingMiddleware(h http.Handler) http.Handler {
 	})
 }
 
+// realIPMiddleware replaces the remote address of requests coming from a
+// trusted proxy with the client address in the forwarding headers, so that
+// logs, events, rate limits and polling all see the booting host. The IP is
+// normalized, so IPv6 hosts are seen the same way whatever the form used.
+func realIPMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		env := envFromRequest(r)
+		if ip, port, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			r.RemoteAddr = net.JoinHostPort(utils.NormalizeIP(ip), port)
+		}
+		if len(env.TrustedNetworks) > 0 {
+			if ip, ok := proxy.ClientIP(r.RemoteAddr, r.Header, env.TrustedNetworks); ok {
+				r.RemoteAddr = net.JoinHostPort(utils.NormalizeIP(ip), "0")
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
 // SecureHeaders adds secure headers to the responses
 func secureHeadersMiddleware(h http.Handler) http.Handler {
 
@@ -107,7 +129,9 @@ func MiddlewareChain(env *environment.Environment, h http.Handler) http.Handler
 		disableCacheMiddleware,
 		environmentMiddleware,
 		contextMiddleware,
+		realIPMiddleware,
 		loggingMiddleware,
+		sameOriginMiddleware,
 	}
 
 	for i := len(middlewares) - 1; i >= 0; i-- {
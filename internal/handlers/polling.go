@@ -21,6 +21,7 @@ import (
 	"net/http"
 	"os"
 
+	"github.com/thousandeyes/shoelaces/internal/environment"
 	"github.com/thousandeyes/shoelaces/internal/log"
 	"github.com/thousandeyes/shoelaces/internal/polling"
 	"github.com/thousandeyes/shoelaces/internal/server"
@@ -59,13 +60,15 @@ func PollHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if host == "" {
-		host = resolveHostname(env.Logger, ip)
+		host = resolveHostname(env, ip)
 	}
 
 	server := server.New(mac, ip, host)
+	server.Serial = r.FormValue("serial")
+	server.UUID = r.FormValue("uuid")
 	script, err := polling.Poll(
-		env.Logger, env.ServerStates, env.HostnameMaps, env.NetworkMaps,
-		env.EventLog, env.Templates, env.BaseURL, server)
+		env.Logger, env.ServerStates, env.HostSources,
+		env.EventLog, env.Templates, env.Overrides, env.Hosts, env.BaseURL, server)
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -112,7 +115,7 @@ func UpdateTargetHandler(w http.ResponseWriter, r *http.Request) {
 
 	server := server.New(mac, ip, "")
 	inputErr, err := polling.UpdateTarget(
-		env.Logger, env.ServerStates, env.Templates, env.EventLog, env.BaseURL, server,
+		env.Logger, env.ServerStates, env.Templates, env.Overrides, env.Hosts, env.EventLog, env.BaseURL, server,
 		scriptName, environment, params)
 
 	if err != nil {
@@ -126,6 +129,119 @@ func UpdateTargetHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/", http.StatusFound)
 }
 
+// UpdateTargetsHandler is a POST endpoint that receives parameters for
+// booting manually a group of waiting servers. Servers are chosen with
+// any number of mac values, and the macPrefix, subnet and hostnameRegex
+// filters. It answers with the outcome for each server in JSON.
+func UpdateTargetsHandler(w http.ResponseWriter, r *http.Request) {
+	env := envFromRequest(r)
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	form := make(map[string][]string)
+	for k, v := range r.PostForm {
+		switch k {
+		case "mac", "macPrefix", "subnet", "hostnameRegex":
+		default:
+			form[k] = v
+		}
+	}
+	_, scriptName, environment, params := parsePostForm(form)
+	if scriptName == "" {
+		http.Error(w, "Target must not be empty", http.StatusBadRequest)
+		return
+	}
+
+	selection, err := polling.NewSelection(r.PostForm["mac"], r.PostFormValue("macPrefix"),
+		r.PostFormValue("subnet"), r.PostFormValue("hostnameRegex"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	results := polling.UpdateTargets(
+		env.Logger, env.ServerStates, env.Templates, env.Overrides, env.Hosts, env.EventLog, env.BaseURL,
+		selection, scriptName, environment, params)
+	for i := range results {
+		results[i].Params = env.Redactor.Params(results[i].Params)
+	}
+	body, err := json.Marshal(results)
+	if err != nil {
+		env.Logger.Error("marshal target results failed", "component", "handler", "err", err)
+		os.Exit(1)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// PendingListHandler provides a list of the assignments registered for
+// hosts that didn't poll yet.
+func PendingListHandler(w http.ResponseWriter, r *http.Request) {
+	env := envFromRequest(r)
+
+	pending, err := json.Marshal(redactPending(env.Redactor, polling.ListPending(env.ServerStates)))
+	if err != nil {
+		env.Logger.Error("marshal pending assignments failed", "component", "handler", "err", err)
+		os.Exit(1)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(pending)
+}
+
+// UpdatePendingHandler is a POST endpoint that registers, or replaces, the
+// script a host boots the next time it polls. It receives the same
+// parameters as UpdateTargetHandler.
+func UpdatePendingHandler(w http.ResponseWriter, r *http.Request) {
+	env := envFromRequest(r)
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mac, scriptName, environment, params := parsePostForm(r.PostForm)
+	if mac == "" || scriptName == "" {
+		http.Error(w, "MAC address and target must not be empty", http.StatusBadRequest)
+		return
+	}
+
+	server := server.New(mac, "", "")
+	inputErr, err := polling.AddPending(
+		env.Logger, env.ServerStates, env.Templates, env.Overrides, env.Hosts, env.EventLog, env.BaseURL, server,
+		scriptName, environment, params)
+
+	if err != nil {
+		if inputErr {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	http.Redirect(w, r, "/pending", http.StatusFound)
+}
+
+// CancelPendingHandler is a POST endpoint that removes the assignment
+// registered for the received MAC.
+func CancelPendingHandler(w http.ResponseWriter, r *http.Request) {
+	env := envFromRequest(r)
+
+	mac := utils.MacDashToColon(r.PostFormValue("mac"))
+	if mac == "" {
+		http.Error(w, "MAC address must not be empty", http.StatusBadRequest)
+		return
+	}
+
+	if err := polling.CancelPending(env.Logger, env.ServerStates, mac); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Redirect(w, r, "/pending", http.StatusFound)
+}
+
 func parsePostForm(form map[string][]string) (mac, scriptName, environment string, params map[string]interface{}) {
 	params = make(map[string]interface{})
 	for k, v := range form {
@@ -158,10 +274,10 @@ func validateMACAndIP(logger log.Logger, mac string, ip string) (err error) {
 	return nil
 }
 
-func resolveHostname(logger log.Logger, ip string) string {
-	host := utils.ResolveHostname(ip)
+func resolveHostname(env *environment.Environment, ip string) string {
+	host := env.Resolver.Resolve(ip)
 	if host == "" {
-		logger.Info("can't resolve ip", "component", "polling", "ip", ip)
+		env.Logger.Info("can't resolve ip", "component", "polling", "ip", ip)
 	}
 
 	return host
@@ -0,0 +1,54 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SignatureCheck denies access to the configs under prefix that need a
+// signature, unless the request URL has a valid one. Failures are logged
+// and recorded as security events of the requesting host, if known.
+func SignatureCheck(prefix string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		env := envFromRequest(r)
+		name := strings.TrimPrefix(r.URL.Path, prefix)
+		if !env.Signer.Required(name) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		// URLs are signed as seen by the host, with the environment.
+		u, err := url.ParseRequestURI(r.RequestURI)
+		if err == nil {
+			err = env.Signer.Verify(u.Path, r.URL.Query(), time.Now())
+		}
+		if err == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+		env.Logger.Warn("signature check failed", "component", "http", "type", "security", "src", r.RemoteAddr, "url", r.URL, "err", err)
+		if srv, ok := downloadingServer(r, ip); ok {
+			env.EventLog.AddSecurityEvent(srv, name, err.Error())
+		}
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	})
+}
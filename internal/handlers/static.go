@@ -15,112 +15,44 @@
 package handlers
 
 import (
-	"fmt"
 	"net/http"
-	"os"
-	"path"
 	"path/filepath"
-	"sort"
+
+	"github.com/thousandeyes/shoelaces/internal/overlay"
+	"github.com/thousandeyes/shoelaces/internal/overrides"
 )
 
 // StaticConfigFileHandler handles static config files
 type StaticConfigFileHandler struct{}
 
+// ServeHTTP serves the static config files of the environment of the
+// request, found through its inheritance chain, on top of the ones of the
+// data dir. Each directory is listed according to the setting of its
+// environment.
 func (s *StaticConfigFileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	env := envFromRequest(r)
 	envName := envNameFromRequest(r)
-	basePath := path.Join(env.DataDir, "static")
-	if envName == "" {
-		http.FileServer(http.Dir(basePath)).ServeHTTP(w, r)
-		return
+	var layers []overlay.Layer
+	if envName != "" {
+		for _, e := range env.Overrides.Chain(envName) {
+			if e == overrides.Default {
+				break
+			}
+			layers = append(layers, overlay.Layer{
+				FS:      overlay.Dir(filepath.Join(env.DataDir, env.EnvDir, e, "static")),
+				Listing: env.Overrides.StaticListing(e, env.StaticListing),
+			})
+		}
 	}
-	envPath := filepath.Join(env.DataDir, env.EnvDir, envName, "static")
-	OverlayFileServer(envPath, basePath).ServeHTTP(w, r)
+	layers = append(layers, overlay.Layer{
+		FS:      overlay.Dir(filepath.Join(env.DataDir, "static")),
+		Listing: env.StaticListing,
+	})
+	server := &overlay.FileServer{Layers: layers}
+	server.ServeHTTP(w, r)
 }
 
 // StaticConfigFileServer returns a StaticConfigFileHandler instance implementing http.Handler
 func StaticConfigFileServer() *StaticConfigFileHandler {
 	return &StaticConfigFileHandler{}
 }
-
-// OverlayFileServerHandler handles request for overlayer directories
-type OverlayFileServerHandler struct {
-	upper string
-	lower string
-}
-
-// OverlayFileServer serves static content from two overlayed directories
-func OverlayFileServer(upper, lower string) *OverlayFileServerHandler {
-	return &OverlayFileServerHandler{
-		upper: upper,
-		lower: lower,
-	}
-}
-
-func (o *OverlayFileServerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-
-	fp := filepath.Clean(r.URL.Path)
-	upper := filepath.Clean(path.Join(o.upper, fp))
-	lower := filepath.Clean(path.Join(o.lower, fp))
-
-	// TODO: try to avoid stat()-ing both if not necessary
-	infoUpper, errUpper := os.Stat(upper)
-	infoLower, errLower := os.Stat(lower)
-
-	// If both upper and lower files/dirs do not exist, return 404
-	if errUpper != nil && os.IsNotExist(errUpper) &&
-		errLower != nil && os.IsNotExist(errLower) {
-		http.NotFound(w, r)
-		return
-	}
-
-	isDir := false
-	fileList := make(map[string]os.DirEntry)
-
-	if errUpper == nil && infoUpper.IsDir() {
-		files, _ := os.ReadDir(upper)
-		for _, f := range files {
-			fileList[f.Name()] = f
-		}
-		isDir = true
-	}
-	if errLower == nil && infoLower.IsDir() {
-		files, _ := os.ReadDir(lower)
-		for _, f := range files {
-			if _, ok := fileList[f.Name()]; !ok {
-				fileList[f.Name()] = f
-			}
-		}
-		isDir = true
-	}
-
-	// Generate HTML directory index
-	if isDir {
-		fileListIndex := []string{}
-		for i := range fileList {
-			fileListIndex = append(fileListIndex, i)
-		}
-		sort.Strings(fileListIndex)
-		w.Write([]byte("<pre>\n"))
-		for _, i := range fileListIndex {
-			f := fileList[i]
-			name := f.Name()
-			if f.IsDir() {
-				name = name + "/"
-			}
-			l := fmt.Sprintf("<a href=\"%s\">%s</a>\n", name, name)
-			w.Write([]byte(l))
-		}
-		w.Write([]byte("</pre>\n"))
-		return
-	}
-
-	// Serve the file from the upper layer if it exists.
-	if errUpper == nil {
-		http.ServeFile(w, r, upper)
-		// If not serve it from the lower
-	} else if errLower == nil {
-		http.ServeFile(w, r, lower)
-	}
-	http.NotFound(w, r)
-}
@@ -18,8 +18,13 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"net/url"
+	"path"
 	"path/filepath"
+	"strconv"
 
+	"github.com/thousandeyes/shoelaces/internal/environment"
+	"github.com/thousandeyes/shoelaces/internal/templates"
 	"github.com/thousandeyes/shoelaces/internal/utils"
 )
 
@@ -27,9 +32,9 @@ import (
 type TemplateHandler struct{}
 
 // TemplateHandler is the dynamic configuration provider endpoint. It
-// receives a key and maybe an environment.
+// receives a key and maybe an environment, and serves the config rendered
+// by RenderConfig. HEAD requests render the template without sending it.
 func (t *TemplateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	variablesMap := map[string]interface{}{}
 	configName := filepath.Clean(r.URL.Path)
 
 	if configName == "" {
@@ -37,20 +42,84 @@ func (t *TemplateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	for key, val := range r.URL.Query() {
-		variablesMap[key] = val[0]
-	}
-
 	env := envFromRequest(r)
 	envName := envNameFromRequest(r)
-	variablesMap["baseURL"] = utils.BaseURLforEnvName(env.BaseURL, envName)
 
-	configString, err := env.Templates.RenderTemplate(env.Logger, configName, variablesMap, envName)
+	params := ConfigParams(env, envName, r.URL.Query())
+	contentType, body, err := RenderConfig(env, envName, configName, params)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
-	} else {
-		io.WriteString(w, configString)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	if r.Method != http.MethodHead {
+		io.WriteString(w, body)
+	}
+}
+
+// ConfigParams returns the parameters a config is rendered with: the
+// variables of the host identified by the query, overridden by the query
+// parameters, and the base URL of the environment.
+func ConfigParams(env *environment.Environment, envName string, query url.Values) map[string]interface{} {
+	params := map[string]interface{}{}
+	if host, ok := env.Hosts.Find(query.Get("mac"), query.Get("hostname"), query.Get("serial"), query.Get("uuid")); ok {
+		env.Logger.Debug("host file found", "component", "template", "file", host.File)
+		params = utils.MergeMaps(params, host.Params)
+	}
+
+	for key, val := range query {
+		params[key] = val[0]
+	}
+
+	params["baseURL"] = env.Overrides.BaseURL(env.BaseURL, envName)
+	return params
+}
+
+// RenderConfig renders a config template and returns its content type and
+// output, as described in templates.ContentType. Butane templates are
+// transpiled to Ignition. Ignition configs are validated, and the local
+// configs they merge are merged in.
+func RenderConfig(env *environment.Environment, envName, configName string, params map[string]interface{}) (string, string, error) {
+	contentType, body, err := renderConfig(env, envName, configName, params)
+	if err != nil {
+		return "", "", err
+	}
+	if IsIgnition(env, configName, envName) {
+		if body, err = resolveIgnition(env, envName, configName, params, body); err != nil {
+			return "", "", err
+		}
+	}
+	return contentType, body, nil
+}
+
+// renderConfig renders a config template, transpiling Butane templates,
+// without resolving Ignition configs.
+func renderConfig(env *environment.Environment, envName, configName string, params map[string]interface{}) (string, string, error) {
+	rendered, err := env.Templates.RenderTemplate(env.Logger, configName, params, envName)
+	if err != nil {
+		return "", "", err
+	}
+	// Templates not named after a file get the content type of the file
+	// they're defined in.
+	format := configFormat(env, configName, envName)
+	typeName := configName
+	if path.Ext(configName) == "" {
+		typeName += format
+	}
+	contentType, body, err := templates.ContentType(typeName, rendered)
+	if err != nil {
+		env.Logger.Info("invalid content type", "component", "template", "template", configName, "err", err)
+		return "", "", err
+	}
+	if format == ".bu" {
+		// The directive is a YAML comment, keep it so lines match.
+		if body, err = transpileButane(env, configName, rendered); err != nil {
+			return "", "", err
+		}
 	}
+	return contentType, body, nil
 }
 
 // TemplateHandler returns a TemplateHandler instance implementing http.Handler
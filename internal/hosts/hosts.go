@@ -0,0 +1,183 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hosts
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/thousandeyes/shoelaces/internal/utils"
+)
+
+// Host holds the variables of a single host, read from a file in the hosts
+// directory. A host is identified by any of its MAC, hostname, serial
+// number or SMBIOS UUID. It can optionally set the script to boot.
+type Host struct {
+	File        string                 `yaml:"-"`
+	Mac         string                 `yaml:"mac"`
+	Hostname    string                 `yaml:"hostname"`
+	Serial      string                 `yaml:"serial"`
+	UUID        string                 `yaml:"uuid"`
+	Script      string                 `yaml:"script"`
+	Environment string                 `yaml:"environment"`
+	Params      map[string]interface{} `yaml:"params"`
+}
+
+// Hosts holds all the host files, indexed by their keys.
+type Hosts struct {
+	hosts []*Host
+	keys  map[string]*Host
+}
+
+// CheckFunc reports whether the script and environment set by a host file
+// can be booted. Either of them may be empty.
+type CheckFunc func(script, environment string) error
+
+// Load reads every YAML file in dir as a Host. Files not declaring any key
+// are identified by their name without extension, which is used as MAC if
+// it's a valid one, or as hostname otherwise. A missing dir results in an
+// empty Hosts. Two files sharing a key, or a script or environment rejected
+// by check, if not nil, result in an error.
+func Load(dir string, check CheckFunc) (*Hosts, error) {
+	h := &Hosts{keys: make(map[string]*Host)}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return h, nil
+		}
+		return nil, err
+	}
+
+	for _, f := range files {
+		ext := filepath.Ext(f.Name())
+		if f.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+
+		host := &Host{File: f.Name()}
+		contents, err := os.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(contents, host); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name(), err)
+		}
+		if host.Mac == "" && host.Hostname == "" && host.Serial == "" && host.UUID == "" {
+			name := strings.TrimSuffix(f.Name(), ext)
+			if utils.IsValidMAC(utils.MacDashToColon(name)) {
+				host.Mac = name
+			} else {
+				host.Hostname = name
+			}
+		}
+		if host.Params == nil {
+			host.Params = make(map[string]interface{})
+		}
+		if check != nil && (host.Script != "" || host.Environment != "") {
+			if err := check(host.Script, host.Environment); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Name(), err)
+			}
+		}
+
+		if err := h.add(host); err != nil {
+			return nil, err
+		}
+	}
+
+	return h, nil
+}
+
+func (h *Hosts) add(host *Host) error {
+	if host.Mac != "" {
+		if !utils.IsValidMAC(utils.MacDashToColon(host.Mac)) {
+			return fmt.Errorf("%s: invalid MAC %q", host.File, host.Mac)
+		}
+		host.Mac = normalizeMac(host.Mac)
+	}
+
+	for _, k := range hostKeys(host.Mac, host.Hostname, host.Serial, host.UUID) {
+		if other, ok := h.keys[k]; ok {
+			return fmt.Errorf("%s: duplicate key %s, already used by %s", host.File, k, other.File)
+		}
+		h.keys[k] = host
+	}
+	h.hosts = append(h.hosts, host)
+	return nil
+}
+
+// Find returns the host matching any of the received identifiers. Empty
+// identifiers are ignored. The MAC takes precedence over the UUID, the
+// serial number and the hostname, in that order.
+func (h *Hosts) Find(mac, hostname, serial, uuid string) (*Host, bool) {
+	if h == nil {
+		return nil, false
+	}
+	if mac != "" {
+		mac = normalizeMac(mac)
+	}
+	for _, k := range hostKeys(mac, hostname, serial, uuid) {
+		if host, ok := h.keys[k]; ok {
+			return host, true
+		}
+	}
+	return nil, false
+}
+
+// List returns all the hosts sorted by file name.
+func (h *Hosts) List() []Host {
+	ret := make([]Host, 0)
+	if h == nil {
+		return ret
+	}
+	for _, host := range h.hosts {
+		ret = append(ret, *host)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].File < ret[j].File })
+	return ret
+}
+
+// Keys returns a human readable list of the identifiers of the host.
+func (h Host) Keys() string {
+	return strings.Join(hostKeys(h.Mac, h.Hostname, h.Serial, h.UUID), ", ")
+}
+
+// hostKeys returns the index keys for the received identifiers, in order of
+// precedence.
+func hostKeys(mac, hostname, serial, uuid string) []string {
+	var keys []string
+	if mac != "" {
+		keys = append(keys, "mac:"+mac)
+	}
+	if uuid != "" {
+		keys = append(keys, "uuid:"+strings.ToLower(uuid))
+	}
+	if serial != "" {
+		keys = append(keys, "serial:"+serial)
+	}
+	if hostname != "" {
+		keys = append(keys, "hostname:"+strings.TrimSuffix(strings.ToLower(hostname), "."))
+	}
+	return keys
+}
+
+func normalizeMac(mac string) string {
+	return strings.ToLower(utils.MacDashToColon(mac))
+}
@@ -0,0 +1,128 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hosts
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeHostFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadAndFind(t *testing.T) {
+	dir := writeHostFiles(t, map[string]string{
+		"web01.yaml":             "mac: 52-54-00-AA-BB-CC\nserial: SN123\nparams:\n  role: web\n",
+		"db01.example.com.yml":   "params:\n  role: db\n",
+		"52-54-00-11-22-33.yaml": "params:\n  role: cache\n",
+		"uuid.yaml":              "uuid: 4C4C4544-0000-1000-8000-000000000000\n",
+		"notes.txt":              "not a host file",
+	})
+
+	h, err := Load(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.List()) != 4 {
+		t.Errorf("Expected: 4 hosts\nGot: %d", len(h.List()))
+	}
+
+	tests := []struct {
+		mac, hostname, serial, uuid string
+		file                        string
+	}{
+		{mac: "52:54:00:aa:bb:cc", file: "web01.yaml"},
+		{serial: "SN123", file: "web01.yaml"},
+		{hostname: "db01.example.com.", file: "db01.example.com.yml"},
+		{mac: "52-54-00-11-22-33", hostname: "db01.example.com", file: "52-54-00-11-22-33.yaml"},
+		{uuid: "4c4c4544-0000-1000-8000-000000000000", file: "uuid.yaml"},
+	}
+	for _, tt := range tests {
+		host, ok := h.Find(tt.mac, tt.hostname, tt.serial, tt.uuid)
+		if !ok {
+			t.Errorf("Expected %s to be found", tt.file)
+			continue
+		}
+		if host.File != tt.file {
+			t.Errorf("Expected: %s\nGot: %s", tt.file, host.File)
+		}
+	}
+
+	if _, ok := h.Find("52:54:00:00:00:00", "unknown", "", ""); ok {
+		t.Error("Expected no host to be found")
+	}
+}
+
+func TestLoadDuplicateKeys(t *testing.T) {
+	dir := writeHostFiles(t, map[string]string{
+		"a.yaml": "mac: 52:54:00:aa:bb:cc\n",
+		"b.yaml": "mac: 52-54-00-AA-BB-CC\n",
+	})
+
+	if _, err := Load(dir, nil); err == nil {
+		t.Fatal("Expected error")
+	}
+}
+
+func TestLoadMissingDir(t *testing.T) {
+	h, err := Load(filepath.Join(t.TempDir(), "missing"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := h.Find("52:54:00:aa:bb:cc", "", "", ""); ok {
+		t.Error("Expected no host to be found")
+	}
+}
+
+func TestLoadCheck(t *testing.T) {
+	check := func(script, environment string) error {
+		if script != "" && script != "flatcar.ipxe" {
+			return fmt.Errorf("unknown script %q", script)
+		}
+		if environment != "" && environment != "production" {
+			return fmt.Errorf("unknown environment %q", environment)
+		}
+		return nil
+	}
+
+	dir := writeHostFiles(t, map[string]string{
+		"web01.yaml": "script: flatcar.ipxe\nenvironment: production\n",
+		"web02.yaml": "params:\n  role: web\n",
+	})
+	if _, err := Load(dir, check); err != nil {
+		t.Errorf("Expected: no error\nGot: %v", err)
+	}
+
+	for contents, expected := range map[string]string{
+		"script: typo.ipxe\n":                          `web03.yaml: unknown script "typo.ipxe"`,
+		"script: flatcar.ipxe\nenvironment: staging\n": `web03.yaml: unknown environment "staging"`,
+	} {
+		dir := writeHostFiles(t, map[string]string{"web03.yaml": contents})
+		if _, err := Load(dir, check); err == nil || err.Error() != expected {
+			t.Errorf("Expected: %s\nGot: %v", expected, err)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ignition
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	valid := []string{
+		`{"ignition": {"version": "3.0.0"}}`,
+		`{"ignition": {"version": "3.4.0"}, "storage": {"files": [{"path": "/etc/hostname", "mode": 420, "contents": {"source": "data:,a"}}]}, "kernelArguments": {"shouldExist": ["quiet"]}}`,
+		`{"ignition": {"version": "3.2.0"}, "systemd": {"units": [{"name": "etcd.service", "enabled": true, "dropins": [{"name": "10-a.conf"}]}]}, "passwd": {"users": [{"name": "core", "sshAuthorizedKeys": ["ssh-ed25519 AAAA"]}]}}`,
+		`{"ignition": {"version": "3.1.0", "config": {"merge": [{"source": "https://a/b.ign", "verification": {"hash": "sha512-` + strings.Repeat("0", 128) + `"}}]}}}`,
+		`{"ignition": {"version": "3.3.0"}, "storage": {"files": [{"path": "/a", "contents": null}]}}`,
+	}
+	for _, c := range valid {
+		if _, err := Validate([]byte(c)); err != nil {
+			t.Errorf("Expected: no error for %s\nGot: %v", c, err)
+		}
+	}
+
+	for _, c := range []struct {
+		config string
+		errors []string
+	}{
+		{`{"ignition": {"version": "3.0.0"},`, []string{"line 1, column 35: unexpected end of the config"}},
+		{"{\n  \"ignition\": {\"version\": \"3.0.0\"}\n  \"storage\": {}\n}", []string{"line 3, column 3: invalid character '\"' after object key:value pair"}},
+		{`{"ignition": {"version": "3.0.0"}} x`, []string{"line 1, column 36: unexpected data after the config"}},
+		{`[]`, []string{"the config must be a JSON object"}},
+		{`{}`, []string{"ignition.version: required"}},
+		{`{"ignition": {"version": "2.3.0"}}`, []string{`ignition.version: unsupported spec version "2.3.0", must be 3.0.0 to 3.5.0`}},
+		{`{"ignition": {"version": "3.0.0"}, "storage": {"files": [{"path": "etc/a", "mode": "420", "user": {"id": 1.5}}], "filesystems": [{"device": "/dev/sda", "format": "ntfs"}]}, "extra": 1}`, []string{
+			"storage.files[0].mode: must be an integer",
+			"storage.files[0].path: must be an absolute path",
+			"storage.files[0].user.id: must be an integer",
+			`storage.filesystems[0].format: must be one of "ext4", "btrfs", "xfs", "vfat", "swap", "none"`,
+		}},
+		{`{"ignition": {"version": "3.0.0", "proxy": {}}, "kernelArguments": {}}`, []string{
+			"ignition.proxy: requires spec version 3.1.0 or later",
+			"kernelArguments: requires spec version 3.3.0 or later",
+		}},
+		{`{"ignition": {"version": "3.0.0"}, "systemd": {"units": [{"enabled": true}]}, "ignition": {"version": "3.0.0", "config": {"merge": [{"source": "ftp://a"}]}}}`, []string{
+			`ignition.config.merge[0].source: unsupported URL scheme "ftp"`,
+			"systemd.units[0].name: required",
+		}},
+		{`{"ignition": {"version": "3.0.0"}, "storage": {"files": [{"path": "/a"}], "links": [{"path": "/a", "target": "/b"}]}, "systemd": {"units": [{"name": "a.service"}, {"name": "a.service"}]}}`, []string{
+			"storage.links[0].path: duplicate of storage.files[0]",
+			"systemd.units[1]: duplicate of systemd.units[0]",
+		}},
+	} {
+		_, err := Validate([]byte(c.config))
+		var vErr *ValidationError
+		if !errors.As(err, &vErr) || !reflect.DeepEqual(vErr.Errors, c.errors) {
+			t.Errorf("Expected: %q for %s\nGot: %v", c.errors, c.config, err)
+		}
+	}
+
+	config := `{"ignition": {"version": "3.0.0", "extra": 1}, "storage": {"files": [{"path": "/a", "mod": 420}]}}`
+	warns, err := Validate([]byte(config))
+	if want := []string{"ignition.extra: unknown field", "storage.files[0].mod: unknown field"}; err != nil || !reflect.DeepEqual(warns, want) {
+		t.Errorf("Expected: %q\nGot: %q %v", want, warns, err)
+	}
+}
+
+func decode(t *testing.T, config string) map[string]interface{} {
+	c, err := parse([]byte(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestMerge(t *testing.T) {
+	parent := decode(t, `{
+		"ignition": {"version": "3.3.0"},
+		"storage": {
+			"files": [{"path": "/etc/hostname", "mode": 420}, {"path": "/etc/motd"}],
+			"links": [{"path": "/etc/a", "target": "/b"}]
+		},
+		"systemd": {"units": [{"name": "a.service", "enabled": true, "dropins": [{"name": "a.conf", "contents": "a"}]}]},
+		"passwd": {"users": [{"name": "core", "sshAuthorizedKeys": ["key1"], "groups": ["wheel"]}]}
+	}`)
+	child := decode(t, `{
+		"ignition": {"version": "3.0.0"},
+		"storage": {
+			"files": [{"path": "/etc/hostname", "mode": 384, "overwrite": null}, {"path": "/etc/a"}],
+			"directories": [{"path": "/etc/motd"}]
+		},
+		"systemd": {"units": [{"name": "a.service", "dropins": [{"name": "b.conf"}]}, {"name": "b.service"}]},
+		"passwd": {"users": [{"name": "core", "sshAuthorizedKeys": ["key1", "key2"], "shell": "/bin/zsh"}]}
+	}`)
+	want := decode(t, `{
+		"ignition": {"version": "3.3.0"},
+		"storage": {
+			"files": [{"path": "/etc/hostname", "mode": 384, "overwrite": null}, {"path": "/etc/a"}],
+			"directories": [{"path": "/etc/motd"}],
+			"links": []
+		},
+		"systemd": {"units": [{"name": "a.service", "enabled": true, "dropins": [{"name": "a.conf", "contents": "a"}, {"name": "b.conf"}]}, {"name": "b.service"}]},
+		"passwd": {"users": [{"name": "core", "sshAuthorizedKeys": ["key1", "key2"], "groups": ["wheel"], "shell": "/bin/zsh"}]}
+	}`)
+
+	if got := Merge(parent, child); !reflect.DeepEqual(got, want) {
+		g, _ := json.Marshal(got)
+		w, _ := json.Marshal(want)
+		t.Errorf("Expected: %s\nGot: %s", w, g)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	const prefix = "http://localhost:8081/configs/"
+	configs := map[string]string{
+		"base.ign": `{"ignition": {"version": "3.0.0"}, "passwd": {"users": [{"name": "core", "sshAuthorizedKeys": ["key1"]}]}}`,
+		"etcd.ign": `{"ignition": {"version": "3.2.0"}, "systemd": {"units": [{"name": "etcd.service", "enabled": true}]}}`,
+		"role.ign": `{"ignition": {"version": "3.0.0", "config": {"merge": [{"source": "http://localhost:8081/configs/{{role}}.ign"}]}}}`,
+		"a.ign":    `{"ignition": {"version": "3.0.0", "config": {"merge": [{"source": "http://localhost:8081/configs/b.ign"}]}}}`,
+		"b.ign":    `{"ignition": {"version": "3.0.0", "config": {"replace": {"source": "http://localhost:8081/configs/a.ign"}}}}`,
+		"bad.ign":  `{"ignition": {"version": "3.0.0"}, "storage": {"files": [{"path": "a"}]}}`,
+		"odd.ign":  `{"ignition": {"version": "3.0.0"}, "extra": 1}`,
+	}
+	var rendered []string
+	render := func(name string, params url.Values) (string, error) {
+		rendered = append(rendered, name+"?"+params.Encode())
+		c, ok := configs[name]
+		if !ok {
+			return "", fmt.Errorf("no template %s", name)
+		}
+		return strings.ReplaceAll(c, "{{role}}", params.Get("role")), nil
+	}
+
+	host := `{
+		"ignition": {"version": "3.0.0", "config": {"merge": [
+			{"source": "http://localhost:8081/configs/base.ign"},
+			{"source": "https://example.com/remote.ign"},
+			{"source": "http://localhost:8081/configs/role.ign?role=etcd"}
+		]}},
+		"passwd": {"users": [{"name": "core", "sshAuthorizedKeys": ["key2"]}]}
+	}`
+	out, warns, err := Resolve("host.ign", []byte(host), prefix, render)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := decode(t, `{
+		"ignition": {"version": "3.2.0", "config": {"merge": [{"source": "https://example.com/remote.ign"}]}},
+		"passwd": {"users": [{"name": "core", "sshAuthorizedKeys": ["key2", "key1"]}]},
+		"systemd": {"units": [{"name": "etcd.service", "enabled": true}]}
+	}`)
+	if got := decode(t, string(out)); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected: %v\nGot: %s", want, out)
+	}
+	if want := []string{"base.ign?", "role.ign?role=etcd", "etcd.ign?"}; !reflect.DeepEqual(rendered, want) {
+		t.Errorf("Expected: %q\nGot: %q", want, rendered)
+	}
+	if len(warns) > 0 {
+		t.Errorf("Expected: no warnings\nGot: %q", warns)
+	}
+
+	odd := `{"ignition": {"version": "3.0.0", "config": {"merge": [{"source": "http://localhost:8081/configs/odd.ign"}]}}, "extra": 2}`
+	if _, warns, err := Resolve("host.ign", []byte(odd), prefix, render); err != nil || !reflect.DeepEqual(warns, []string{"extra: unknown field", "odd.ign: extra: unknown field"}) {
+		t.Errorf("Expected: warnings for host.ign and odd.ign\nGot: %q %v", warns, err)
+	}
+
+	unchanged := `{"ignition": {"version": "3.0.0", "config": {"merge": [{"source": "http://localhost:8081/configs/static/a.ign"}]}}}`
+	if out, _, err := Resolve("host.ign", []byte(unchanged), prefix, render); err != nil || string(out) != unchanged {
+		t.Errorf("Expected: %s\nGot: %s %v", unchanged, out, err)
+	}
+
+	for _, c := range []struct{ source, err string }{
+		{"a.ign", "config merge cycle: host.ign -> a.ign -> b.ign -> a.ign"},
+		{"bad.ign", "invalid Ignition config:\nbad.ign: storage.files[0].path: must be an absolute path"},
+		{"missing.ign", "config missing.ign: no template missing.ign"},
+	} {
+		config := `{"ignition": {"version": "3.0.0", "config": {"merge": [{"source": "` + prefix + c.source + `"}]}}}`
+		if _, _, err := Resolve("host.ign", []byte(config), prefix, render); err == nil || err.Error() != c.err {
+			t.Errorf("Expected: %s\nGot: %v", c.err, err)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ignition
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// nodeLists are the lists of storage entries sharing the path namespace.
+var nodeLists = []string{"files", "directories", "links"}
+
+func isNodeList(p string) bool {
+	for _, l := range nodeLists {
+		if p == "storage."+l {
+			return true
+		}
+	}
+	return false
+}
+
+// listKeys holds the fields identifying the entries of the keyed lists,
+// by path without indexes.
+var listKeys = map[string]string{
+	"ignition.config.merge":                        "source",
+	"ignition.security.tls.certificateAuthorities": "source",
+	"storage.disks":                                "device",
+	"storage.raid":                                 "name",
+	"storage.filesystems":                          "device",
+	"storage.files":                                "path",
+	"storage.directories":                          "path",
+	"storage.links":                                "path",
+	"storage.luks":                                 "name",
+	"storage.luks.clevis.tang":                     "url",
+	"systemd.units":                                "name",
+	"systemd.units.dropins":                        "name",
+	"passwd.users":                                 "name",
+	"passwd.groups":                                "name",
+}
+
+// listKey returns the function giving the key of the entries of a keyed
+// list, or nil if the list isn't keyed.
+func listKey(p string) func(map[string]interface{}) (string, bool) {
+	field, ok := listKeys[p]
+	switch {
+	case p == "storage.disks.partitions":
+		// Partitions are identified by number, or by label if it's 0.
+		return func(m map[string]interface{}) (string, bool) {
+			if n, ok := m["number"].(json.Number); ok && n.String() != "0" {
+				return "number:" + n.String(), true
+			}
+			label, ok := m["label"].(string)
+			return "label:" + label, ok
+		}
+	case strings.HasSuffix(p, "httpHeaders"):
+		field, ok = "name", true
+	}
+	if !ok {
+		return nil
+	}
+	return func(m map[string]interface{}) (string, bool) {
+		k, ok := m[field].(string)
+		return k, ok
+	}
+}
+
+// Merge returns the result of merging child into parent, as Ignition does
+// with the configs of ignition.config.merge:
+//
+//   - values of child fields override the ones of parent, if not null
+//   - objects are merged field by field
+//   - entries of keyed lists, such as the units keyed by name, are merged
+//     with the parent entry having the same key, or appended
+//   - files, directories and links of child replace the ones of parent
+//     with the same path, even in another list
+//   - other lists are appended, leaving out the strings already there
+//
+// The result has the highest spec version of both configs.
+func Merge(parent, child map[string]interface{}) map[string]interface{} {
+	merged := merge("", dropReplacedNodes(parent, child), child).(map[string]interface{})
+
+	pv, perr := specVersion(parent)
+	cv, cerr := specVersion(child)
+	if perr == nil && cerr == nil && pv > cv {
+		merged["ignition"].(map[string]interface{})["version"] = pv.String()
+	}
+	return merged
+}
+
+func specVersion(c map[string]interface{}) (version, error) {
+	ign, _ := c["ignition"].(map[string]interface{})
+	s, _ := ign["version"].(string)
+	return parseVersion(s)
+}
+
+func merge(p string, parent, child interface{}) interface{} {
+	switch c := child.(type) {
+	case nil:
+		return parent
+	case map[string]interface{}:
+		pm, _ := parent.(map[string]interface{})
+		out := make(map[string]interface{}, len(pm)+len(c))
+		for k, v := range pm {
+			out[k] = v
+		}
+		for k, v := range c {
+			out[k] = merge(join(p, k), pm[k], v)
+		}
+		return out
+	case []interface{}:
+		pl, _ := parent.([]interface{})
+		out := append([]interface{}{}, pl...)
+		keyOf := listKey(p)
+		for _, item := range c {
+			m, isObject := item.(map[string]interface{})
+			if keyOf != nil && isObject {
+				if k, ok := keyOf(m); ok {
+					if i := indexOf(out, keyOf, k); i >= 0 {
+						out[i] = merge(p, out[i], m)
+						continue
+					}
+				}
+			} else if !isObject && contains(out, item) {
+				continue
+			}
+			out = append(out, item)
+		}
+		return out
+	default:
+		return child
+	}
+}
+
+func indexOf(items []interface{}, keyOf func(map[string]interface{}) (string, bool), key string) int {
+	for i, item := range items {
+		if m, ok := item.(map[string]interface{}); ok {
+			if k, ok := keyOf(m); ok && k == key {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func contains(items []interface{}, value interface{}) bool {
+	for _, item := range items {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// dropReplacedNodes returns parent without the files, directories and
+// links whose path is used by another kind of entry in child.
+func dropReplacedNodes(parent, child map[string]interface{}) map[string]interface{} {
+	cs, _ := child["storage"].(map[string]interface{})
+	ps, _ := parent["storage"].(map[string]interface{})
+	if cs == nil || ps == nil {
+		return parent
+	}
+
+	childPaths := make(map[string]string) // Path to list
+	for _, l := range nodeLists {
+		items, _ := cs[l].([]interface{})
+		for _, item := range items {
+			m, _ := item.(map[string]interface{})
+			if path, ok := m["path"].(string); ok {
+				childPaths[path] = l
+			}
+		}
+	}
+
+	storage := make(map[string]interface{}, len(ps))
+	for k, v := range ps {
+		storage[k] = v
+	}
+	for _, l := range nodeLists {
+		items, ok := ps[l].([]interface{})
+		if !ok {
+			continue
+		}
+		kept := []interface{}{}
+		for _, item := range items {
+			m, _ := item.(map[string]interface{})
+			path, _ := m["path"].(string)
+			if cl, ok := childPaths[path]; ok && cl != l {
+				continue
+			}
+			kept = append(kept, item)
+		}
+		storage[l] = kept
+	}
+
+	out := make(map[string]interface{}, len(parent))
+	for k, v := range parent {
+		out[k] = v
+	}
+	out["storage"] = storage
+	return out
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
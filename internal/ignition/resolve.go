@@ -0,0 +1,233 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ignition
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// maxDepth is the maximum number of nested local configs.
+const maxDepth = 10
+
+// RenderFunc renders the config with the given name, the path after the
+// configs endpoint, with the parameters of its URL.
+type RenderFunc func(name string, params url.Values) (string, error)
+
+// Resolve validates the config with the given name, and merges into it the configs of its
+// ignition.config.merge list served by Shoelaces, the ones whose source
+// starts with prefix, rendering them with render. A local config in
+// ignition.config.replace is used instead of the config. Other sources are
+// left for Ignition to fetch, after the local configs are merged.
+//
+// Local configs are validated and resolved the same way. The config is
+// returned unchanged if it doesn't use any local config. The warnings of
+// every config are returned, as in Validate.
+func Resolve(name string, config []byte, prefix string, render RenderFunc) ([]byte, []string, error) {
+	c, err := parse(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	r := &resolver{prefix: prefix, render: render}
+	resolved, changed, err := r.resolve(c, []string{name})
+	if err != nil {
+		return nil, r.warns, err
+	}
+	if !changed {
+		return config, r.warns, nil
+	}
+	// The fields of the merged config were all found in the ones merged,
+	// which already warned about them.
+	if _, err := validate(resolved); err != nil {
+		if vErr, ok := err.(*ValidationError); ok {
+			vErr.Config = "merged config"
+		}
+		return nil, r.warns, err
+	}
+	out, err := json.MarshalIndent(resolved, "", "  ")
+	if err != nil {
+		return nil, r.warns, err
+	}
+	return append(out, '\n'), r.warns, nil
+}
+
+type resolver struct {
+	prefix string
+	render RenderFunc
+	warns  []string
+}
+
+// resolve validates a config and merges its local configs. stack holds the
+// names, with their parameters, of the configs being resolved, from the
+// top one.
+func (r *resolver) resolve(c map[string]interface{}, stack []string) (map[string]interface{}, bool, error) {
+	warns, err := validate(c)
+	for _, w := range warns {
+		if len(stack) > 1 {
+			w = stack[len(stack)-1] + ": " + w
+		}
+		r.warns = append(r.warns, w)
+	}
+	if err != nil {
+		if vErr, ok := err.(*ValidationError); ok && len(stack) > 1 {
+			vErr.Config = stack[len(stack)-1]
+		}
+		return nil, false, err
+	}
+
+	ign := c["ignition"].(map[string]interface{})
+	cfg, _ := ign["config"].(map[string]interface{})
+	if cfg == nil {
+		return c, false, nil
+	}
+
+	if replace, ok := cfg["replace"].(map[string]interface{}); ok {
+		if name, params, ok := r.local(replace); ok {
+			replacement, err := r.load(name, params, replace, stack)
+			return replacement, true, err
+		}
+	}
+
+	merges, _ := cfg["merge"].([]interface{})
+	var locals []map[string]interface{}
+	remote := []interface{}{}
+	for _, m := range merges {
+		m, _ := m.(map[string]interface{})
+		if _, _, ok := r.local(m); ok {
+			locals = append(locals, m)
+		} else {
+			remote = append(remote, m)
+		}
+	}
+	if len(locals) == 0 {
+		return c, false, nil
+	}
+
+	// Keep the remote sources only, the local ones are merged here.
+	result := copyMap(c)
+	ign = copyMap(ign)
+	cfg = copyMap(cfg)
+	result["ignition"] = ign
+	ign["config"] = cfg
+	cfg["merge"] = remote
+	if len(remote) == 0 {
+		delete(cfg, "merge")
+	}
+	if len(cfg) == 0 {
+		delete(ign, "config")
+	}
+
+	for _, m := range locals {
+		name, params, _ := r.local(m)
+		child, err := r.load(name, params, m, stack)
+		if err != nil {
+			return nil, false, err
+		}
+		result = Merge(result, child)
+	}
+	return result, true, nil
+}
+
+// local returns the config name and parameters of a resource served by
+// Shoelaces. Static files are left for Ignition to fetch.
+func (r *resolver) local(resource map[string]interface{}) (string, url.Values, bool) {
+	source, _ := resource["source"].(string)
+	if !strings.HasPrefix(source, r.prefix) {
+		return "", nil, false
+	}
+	rest, rawQuery, _ := strings.Cut(strings.TrimPrefix(source, r.prefix), "?")
+	name, err := url.PathUnescape(rest)
+	if err != nil || name == "" || strings.HasPrefix(name, "static/") {
+		return "", nil, false
+	}
+	params, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", nil, false
+	}
+	return name, params, true
+}
+
+// load renders a local config, checks it against the verification hash
+// of its resource and resolves it.
+func (r *resolver) load(name string, params url.Values, resource map[string]interface{}, stack []string) (map[string]interface{}, error) {
+	id := name
+	if len(params) > 0 {
+		id += "?" + params.Encode()
+	}
+	for _, n := range stack {
+		if n == id {
+			return nil, fmt.Errorf("config merge cycle: %s -> %s", strings.Join(stack, " -> "), id)
+		}
+	}
+	if len(stack) >= maxDepth {
+		return nil, fmt.Errorf("config %s: more than %d nested configs", name, maxDepth)
+	}
+	if resource["compression"] != nil && resource["compression"] != "" {
+		return nil, fmt.Errorf("config %s: compression isn't supported for configs served by Shoelaces", name)
+	}
+
+	rendered, err := r.render(name, params)
+	if err != nil {
+		return nil, fmt.Errorf("config %s: %w", name, err)
+	}
+	if err := verify(resource, []byte(rendered)); err != nil {
+		return nil, fmt.Errorf("config %s: %w", name, err)
+	}
+	c, err := parse([]byte(rendered))
+	if err != nil {
+		if vErr, ok := err.(*ValidationError); ok {
+			vErr.Config = id
+		}
+		return nil, err
+	}
+	resolved, _, err := r.resolve(c, append(stack[:len(stack):len(stack)], id))
+	return resolved, err
+}
+
+// verify checks data against the verification hash of a resource, if any.
+func verify(resource map[string]interface{}, data []byte) error {
+	verification, _ := resource["verification"].(map[string]interface{})
+	h, _ := verification["hash"].(string)
+	if h == "" {
+		return nil
+	}
+	function, want, _ := strings.Cut(h, "-")
+	var sum []byte
+	switch function {
+	case "sha512":
+		s := sha512.Sum512(data)
+		sum = s[:]
+	case "sha256":
+		s := sha256.Sum256(data)
+		sum = s[:]
+	}
+	if got := hex.EncodeToString(sum); got != want {
+		return fmt.Errorf("verification hash mismatch, the config hash is %s-%s", function, got)
+	}
+	return nil
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,326 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ignition
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// kind is the JSON type of a field.
+type kind int
+
+const (
+	stringKind kind = iota
+	intKind
+	boolKind
+	objectKind
+	listKind
+)
+
+func (k kind) String() string {
+	return [...]string{"a string", "an integer", "a boolean", "an object", "a list"}[k]
+}
+
+// field describes a field of the Ignition config.
+type field struct {
+	kind     kind
+	fields   map[string]*field // Of objects
+	elem     *field            // Of lists
+	required []string          // Fields objects must have
+	since    version           // Spec version introducing the field
+	check    func(v interface{}) error
+}
+
+func str(check ...func(interface{}) error) *field {
+	f := &field{kind: stringKind}
+	if len(check) > 0 {
+		f.check = check[0]
+	}
+	return f
+}
+
+func integer(check ...func(interface{}) error) *field {
+	f := &field{kind: intKind}
+	if len(check) > 0 {
+		f.check = check[0]
+	}
+	return f
+}
+
+func boolean() *field {
+	return &field{kind: boolKind}
+}
+
+func object(fields map[string]*field, required ...string) *field {
+	return &field{kind: objectKind, fields: fields, required: required}
+}
+
+func list(elem *field) *field {
+	return &field{kind: listKind, elem: elem}
+}
+
+func since(v version, f *field) *field {
+	f.since = v
+	return f
+}
+
+func oneOf(values ...string) func(interface{}) error {
+	return func(v interface{}) error {
+		for _, value := range values {
+			if v == value {
+				return nil
+			}
+		}
+		var quoted []string
+		for _, value := range values {
+			if value != "" {
+				quoted = append(quoted, strconv.Quote(value))
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(quoted, ", "))
+	}
+}
+
+var (
+	hashRegex   = regexp.MustCompile(`^(sha512-[0-9a-f]{128}|sha256-[0-9a-f]{64})$`)
+	sourceRegex = regexp.MustCompile(`^(http|https|tftp|s3|gs|arn|data)$`)
+	unitRegex   = regexp.MustCompile(`\.(service|socket|device|mount|automount|swap|target|path|timer|snapshot|slice|scope)$`)
+)
+
+func absolutePath(v interface{}) error {
+	if !strings.HasPrefix(v.(string), "/") {
+		return fmt.Errorf("must be an absolute path")
+	}
+	return nil
+}
+
+func sourceURL(v interface{}) error {
+	s := v.(string)
+	if s == "" {
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %v", err)
+	}
+	if !sourceRegex.MatchString(u.Scheme) {
+		return fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+	if u.Scheme == "data" && !strings.Contains(u.Opaque, ",") {
+		return fmt.Errorf("invalid data URL")
+	}
+	return nil
+}
+
+func hash(v interface{}) error {
+	if !hashRegex.MatchString(v.(string)) {
+		return fmt.Errorf("must be sha512-<hex> or sha256-<hex>")
+	}
+	return nil
+}
+
+func mode(v interface{}) error {
+	n, _ := v.(json.Number).Int64()
+	if n < 0 || n > 07777 {
+		return fmt.Errorf("must be between 0 and 07777")
+	}
+	return nil
+}
+
+func unitName(v interface{}) error {
+	if !unitRegex.MatchString(v.(string)) {
+		return fmt.Errorf("invalid systemd unit extension")
+	}
+	return nil
+}
+
+func resource() *field {
+	return object(map[string]*field{
+		"source":      str(sourceURL),
+		"compression": str(oneOf("", "gzip")),
+		"httpHeaders": since(v3_1, list(object(map[string]*field{
+			"name":  str(),
+			"value": str(),
+		}, "name"))),
+		"verification": object(map[string]*field{
+			"hash": str(hash),
+		}),
+	})
+}
+
+func mergedResource() *field {
+	r := resource()
+	r.required = []string{"source"}
+	return r
+}
+
+func node(fields map[string]*field) *field {
+	id := func() *field {
+		return object(map[string]*field{"id": integer(), "name": str()})
+	}
+	f := map[string]*field{
+		"path":      str(absolutePath),
+		"overwrite": boolean(),
+		"user":      id(),
+		"group":     id(),
+	}
+	for k, v := range fields {
+		f[k] = v
+	}
+	return object(f, "path")
+}
+
+// schema describes the Ignition v3 configs, up to the last supported
+// version. Fields are checked against the version of the config.
+var schema = object(map[string]*field{
+	"ignition": object(map[string]*field{
+		"version": str(),
+		"config": object(map[string]*field{
+			"merge":   list(mergedResource()),
+			"replace": resource(),
+		}),
+		"timeouts": object(map[string]*field{
+			"httpResponseHeaders": integer(),
+			"httpTotal":           integer(),
+		}),
+		"security": object(map[string]*field{
+			"tls": object(map[string]*field{
+				"certificateAuthorities": list(mergedResource()),
+			}),
+		}),
+		"proxy": since(v3_1, object(map[string]*field{
+			"httpProxy":  str(),
+			"httpsProxy": str(),
+			"noProxy":    list(str()),
+		})),
+	}, "version"),
+	"storage": object(map[string]*field{
+		"disks": list(object(map[string]*field{
+			"device":    str(absolutePath),
+			"wipeTable": boolean(),
+			"partitions": list(object(map[string]*field{
+				"label":              str(),
+				"number":             integer(),
+				"sizeMiB":            integer(),
+				"startMiB":           integer(),
+				"typeGuid":           str(),
+				"guid":               str(),
+				"wipePartitionEntry": boolean(),
+				"shouldExist":        boolean(),
+				"resize":             since(v3_2, boolean()),
+			})),
+		}, "device")),
+		"raid": list(object(map[string]*field{
+			"name":    str(),
+			"level":   str(oneOf("linear", "raid0", "0", "stripe", "raid1", "1", "mirror", "raid4", "4", "raid5", "5", "raid6", "6", "raid10", "10")),
+			"devices": list(str(absolutePath)),
+			"spares":  integer(),
+			"options": list(str()),
+		}, "name")),
+		"filesystems": list(object(map[string]*field{
+			"device":         str(absolutePath),
+			"format":         str(oneOf("", "ext4", "btrfs", "xfs", "vfat", "swap", "none")),
+			"wipeFilesystem": boolean(),
+			"label":          str(),
+			"uuid":           str(),
+			"options":        list(str()),
+			"path":           str(absolutePath),
+			"mountOptions":   since(v3_1, list(str())),
+		}, "device")),
+		"files": list(node(map[string]*field{
+			"mode":     integer(mode),
+			"contents": resource(),
+			"append":   list(resource()),
+		})),
+		"directories": list(node(map[string]*field{
+			"mode": integer(mode),
+		})),
+		"links": list(node(map[string]*field{
+			"target": str(),
+			"hard":   boolean(),
+		})),
+		"luks": since(v3_2, list(object(map[string]*field{
+			"name":        str(),
+			"device":      str(absolutePath),
+			"keyFile":     resource(),
+			"label":       str(),
+			"uuid":        str(),
+			"options":     list(str()),
+			"wipeVolume":  boolean(),
+			"discard":     since(v3_4, boolean()),
+			"openOptions": since(v3_4, list(str())),
+			"clevis": object(map[string]*field{
+				"custom": object(map[string]*field{
+					"config":       str(),
+					"needsNetwork": boolean(),
+					"pin":          str(oneOf("tpm2", "tang", "sss")),
+				}),
+				"tang": list(object(map[string]*field{
+					"url":           str(),
+					"thumbprint":    str(),
+					"advertisement": since(v3_4, str()),
+				}, "url")),
+				"tpm2":      boolean(),
+				"threshold": integer(),
+			}),
+		}, "name"))),
+	}),
+	"systemd": object(map[string]*field{
+		"units": list(object(map[string]*field{
+			"name":     str(unitName),
+			"enabled":  boolean(),
+			"mask":     boolean(),
+			"contents": str(),
+			"dropins": list(object(map[string]*field{
+				"name":     str(),
+				"contents": str(),
+			}, "name")),
+		}, "name")),
+	}),
+	"passwd": object(map[string]*field{
+		"users": list(object(map[string]*field{
+			"name":              str(),
+			"passwordHash":      str(),
+			"sshAuthorizedKeys": list(str()),
+			"uid":               integer(),
+			"gecos":             str(),
+			"homeDir":           str(absolutePath),
+			"noCreateHome":      boolean(),
+			"primaryGroup":      str(),
+			"groups":            list(str()),
+			"noUserGroup":       boolean(),
+			"noLogInit":         boolean(),
+			"shell":             str(),
+			"system":            boolean(),
+			"shouldExist":       since(v3_2, boolean()),
+		}, "name")),
+		"groups": list(object(map[string]*field{
+			"name":         str(),
+			"gid":          integer(),
+			"passwordHash": str(),
+			"system":       boolean(),
+			"shouldExist":  since(v3_2, boolean()),
+		}, "name")),
+	}),
+	"kernelArguments": since(v3_3, object(map[string]*field{
+		"shouldExist":    list(str()),
+		"shouldNotExist": list(str()),
+	})),
+})
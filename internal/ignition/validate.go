@@ -0,0 +1,284 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ignition
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// version is the minor version of an Ignition v3 spec.
+type version int
+
+const (
+	v3_0 version = iota
+	v3_1
+	v3_2
+	v3_3
+	v3_4
+	v3_5
+
+	latest = v3_5
+)
+
+func (v version) String() string {
+	return fmt.Sprintf("3.%d.0", v)
+}
+
+var versionRegex = regexp.MustCompile(`^3\.(\d+)\.0$`)
+
+func parseVersion(s string) (version, error) {
+	m := versionRegex.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("unsupported spec version %q, must be 3.0.0 to %s", s, latest)
+	}
+	minor, err := strconv.Atoi(m[1])
+	if err != nil || version(minor) > latest {
+		return 0, fmt.Errorf("unsupported spec version %q, must be 3.0.0 to %s", s, latest)
+	}
+	return version(minor), nil
+}
+
+// ValidationError lists the problems found in a config.
+type ValidationError struct {
+	Config string // Name of the config, if it's a merged one
+	Errors []string
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		lines[i] = err
+		if e.Config != "" {
+			lines[i] = e.Config + ": " + err
+		}
+	}
+	return "invalid Ignition config:\n" + strings.Join(lines, "\n")
+}
+
+// parse decodes a config, keeping its numbers as json.Number.
+func parse(config []byte) (map[string]interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(config))
+	d.UseNumber()
+	var c interface{}
+	if err := d.Decode(&c); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			line, col := position(config, int64(len(config)))
+			return nil, &ValidationError{Errors: []string{fmt.Sprintf("line %d, column %d: unexpected end of the config", line, col)}}
+		}
+		if errors.As(err, &syntaxErr) {
+			line, col := position(config, syntaxErr.Offset-1)
+			return nil, &ValidationError{Errors: []string{fmt.Sprintf("line %d, column %d: %v", line, col, err)}}
+		}
+		return nil, &ValidationError{Errors: []string{err.Error()}}
+	}
+	end := d.InputOffset()
+	if _, err := d.Token(); err != io.EOF {
+		end += int64(len(config[end:]) - len(bytes.TrimLeft(config[end:], " \t\r\n")))
+		line, col := position(config, end)
+		return nil, &ValidationError{Errors: []string{fmt.Sprintf("line %d, column %d: unexpected data after the config", line, col)}}
+	}
+	obj, ok := c.(map[string]interface{})
+	if !ok {
+		return nil, &ValidationError{Errors: []string{"the config must be a JSON object"}}
+	}
+	return obj, nil
+}
+
+// position returns the line and column of the byte of data at offset.
+func position(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
+
+// Validate parses a config and checks it against the Ignition v3 spec
+// version it declares. Errors are *ValidationError, listing every problem
+// found with the path of the field. Unknown fields are returned as
+// warnings, Ignition ignores them.
+func Validate(config []byte) ([]string, error) {
+	c, err := parse(config)
+	if err != nil {
+		return nil, err
+	}
+	return validate(c)
+}
+
+func validate(c map[string]interface{}) ([]string, error) {
+	v := &validator{}
+	ign, _ := c["ignition"].(map[string]interface{})
+	s, ok := ign["version"].(string)
+	if !ok {
+		return nil, &ValidationError{Errors: []string{"ignition.version: required"}}
+	}
+	var err error
+	if v.version, err = parseVersion(s); err != nil {
+		return nil, &ValidationError{Errors: []string{"ignition.version: " + err.Error()}}
+	}
+
+	v.check("", schema, c)
+	v.checkDuplicates("", c)
+	if len(v.errs) > 0 {
+		return v.warns, &ValidationError{Errors: v.errs}
+	}
+	return v.warns, nil
+}
+
+type validator struct {
+	version version
+	errs    []string
+	warns   []string
+}
+
+func (v *validator) errorf(p string, format string, args ...interface{}) {
+	v.errs = append(v.errs, p+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *validator) warnf(p string, format string, args ...interface{}) {
+	v.warns = append(v.warns, p+": "+fmt.Sprintf(format, args...))
+}
+
+func join(p, key string) string {
+	if p == "" {
+		return key
+	}
+	return p + "." + key
+}
+
+// check checks a value of the config against its field description.
+// Null values are the same as missing ones.
+func (v *validator) check(p string, f *field, value interface{}) {
+	if value == nil {
+		return
+	}
+	if f.since > v.version {
+		v.errorf(p, "requires spec version %s or later", f.since)
+		return
+	}
+
+	var ok bool
+	switch f.kind {
+	case stringKind:
+		_, ok = value.(string)
+	case intKind:
+		var n json.Number
+		if n, ok = value.(json.Number); ok {
+			_, err := n.Int64()
+			ok = err == nil
+		}
+	case boolKind:
+		_, ok = value.(bool)
+	case objectKind:
+		_, ok = value.(map[string]interface{})
+	case listKind:
+		_, ok = value.([]interface{})
+	}
+	if !ok {
+		v.errorf(p, "must be %s", f.kind)
+		return
+	}
+
+	switch f.kind {
+	case objectKind:
+		obj := value.(map[string]interface{})
+		for _, key := range sortedKeys(obj) {
+			sub, ok := f.fields[key]
+			if !ok {
+				v.warnf(join(p, key), "unknown field")
+				continue
+			}
+			v.check(join(p, key), sub, obj[key])
+		}
+		for _, key := range f.required {
+			if obj[key] == nil || obj[key] == "" {
+				v.errorf(join(p, key), "required")
+			}
+		}
+	case listKind:
+		for i, item := range value.([]interface{}) {
+			v.check(fmt.Sprintf("%s[%d]", p, i), f.elem, item)
+		}
+	default:
+		if f.check != nil {
+			if err := f.check(value); err != nil {
+				v.errorf(p, "%v", err)
+			}
+		}
+	}
+}
+
+// checkDuplicates reports the entries of keyed lists sharing their key,
+// and the files, directories and links sharing a path.
+func (v *validator) checkDuplicates(p string, value interface{}) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if p == "storage" {
+			paths := make(map[string]string)
+			for _, l := range nodeLists {
+				items, _ := value[l].([]interface{})
+				for i, item := range items {
+					m, _ := item.(map[string]interface{})
+					path, ok := m["path"].(string)
+					if !ok || path == "" {
+						continue
+					}
+					entry := fmt.Sprintf("storage.%s[%d]", l, i)
+					if first, ok := paths[path]; ok {
+						v.errorf(entry+".path", "duplicate of %s", first)
+						continue
+					}
+					paths[path] = entry
+				}
+			}
+		}
+		for _, key := range sortedKeys(value) {
+			v.checkDuplicates(join(p, key), value[key])
+		}
+	case []interface{}:
+		keyOf := listKey(normalize(p))
+		keys := make(map[string]int)
+		for i, item := range value {
+			m, _ := item.(map[string]interface{})
+			if keyOf != nil && m != nil && !isNodeList(normalize(p)) {
+				if k, ok := keyOf(m); ok {
+					if first, ok := keys[k]; ok {
+						v.errorf(fmt.Sprintf("%s[%d]", p, i), "duplicate of %s[%d]", p, first)
+					} else {
+						keys[k] = i
+					}
+				}
+			}
+			v.checkDuplicates(fmt.Sprintf("%s[%d]", p, i), item)
+		}
+	}
+}
+
+// normalize removes the list indexes of a path.
+func normalize(p string) string {
+	return indexRegex.ReplaceAllString(p, "")
+}
+
+var indexRegex = regexp.MustCompile(`\[\d+\]`)
@@ -0,0 +1,146 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/thousandeyes/shoelaces/internal/event"
+	"github.com/thousandeyes/shoelaces/internal/mappings"
+	"github.com/thousandeyes/shoelaces/internal/server"
+	"github.com/thousandeyes/shoelaces/internal/ttlcache"
+)
+
+// cacheSize is the maximum number of answers cached.
+const cacheSize = 10000
+
+// httpAnswer is the JSON document returned by an inventory service.
+type httpAnswer struct {
+	Script      string                 `json:"script"`
+	Environment string                 `json:"environment"`
+	Params      map[string]interface{} `json:"params"`
+}
+
+// HTTP is a HostSource backed by an inventory service speaking JSON over
+// HTTP. The service is queried with a GET request to its URL, with the mac,
+// ip, hostname, serial and uuid query parameters, and it must answer either
+// 404 for unknown hosts or 200 with a JSON document like:
+//
+//	{"script": "ubuntu.ipxe", "environment": "prod", "params": {"release": "noble"}}
+//
+// Answers, including unknown hosts, are cached for a while, up to
+// cacheSize of them. Errors are not.
+type HTTP struct {
+	url    string
+	client *http.Client
+	ttl    time.Duration
+	cache  *ttlcache.Cache[*httpAnswer]
+}
+
+// NewHTTP returns a HostSource querying the inventory service at rawURL.
+// Requests taking longer than timeout fail, and answers are cached for ttl.
+func NewHTTP(rawURL string, timeout time.Duration, ttl time.Duration) (*HTTP, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid inventory URL %q", rawURL)
+	}
+	return &HTTP{
+		url:    rawURL,
+		client: &http.Client{Timeout: timeout},
+		ttl:    ttl,
+		cache:  ttlcache.New[*httpAnswer](cacheSize),
+	}, nil
+}
+
+// Name implements HostSource.
+func (h *HTTP) Name() string {
+	return "inventory"
+}
+
+// Lookup implements HostSource.
+func (h *HTTP) Lookup(srv server.Server) (*Match, error) {
+	query := url.Values{}
+	query.Set("mac", srv.Mac)
+	query.Set("ip", srv.IP)
+	query.Set("hostname", srv.Hostname)
+	query.Set("serial", srv.Serial)
+	query.Set("uuid", srv.UUID)
+	key := query.Encode()
+
+	answer, ok := h.cache.Get(key, time.Now())
+	if !ok {
+		var err error
+		answer, err = h.query(key)
+		if err != nil {
+			return nil, err
+		}
+		h.cache.Set(key, answer, h.ttl, time.Now())
+	}
+
+	if answer == nil || answer.Script == "" {
+		return nil, nil
+	}
+	return &Match{
+		Script: copyScript(&mappings.Script{
+			Name:        answer.Script,
+			Environment: answer.Environment,
+			Params:      answer.Params,
+		}),
+		BootType: event.InventoryBoot,
+	}, nil
+}
+
+// query asks the inventory service about a host. It returns a nil answer
+// for unknown hosts.
+func (h *HTTP) query(rawQuery string) (*httpAnswer, error) {
+	u, _ := url.Parse(h.url)
+	if u.RawQuery != "" {
+		rawQuery = u.RawQuery + "&" + rawQuery
+	}
+	u.RawQuery = rawQuery
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("inventory answered %s", resp.Status)
+	}
+
+	var answer httpAnswer
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return nil, fmt.Errorf("invalid inventory answer: %w", err)
+	}
+	return &answer, nil
+}
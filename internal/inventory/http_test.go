@@ -0,0 +1,138 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inventory
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/thousandeyes/shoelaces/internal/event"
+	"github.com/thousandeyes/shoelaces/internal/server"
+)
+
+func inventoryStub(t *testing.T, requests *int32) *httptest.Server {
+	t.Helper()
+
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		switch r.URL.Query().Get("mac") {
+		case "52:54:00:aa:bb:cc":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"script": "ubuntu.ipxe", "environment": "prod", "params": {"release": "noble"}}`))
+		case "52:54:00:00:00:01":
+			time.Sleep(200 * time.Millisecond)
+		case "52:54:00:00:00:02":
+			http.Error(w, "broken", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+func TestHTTPLookup(t *testing.T) {
+	var requests int32
+	stub := inventoryStub(t, &requests)
+
+	inv, err := NewHTTP(stub.URL, time.Second, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := server.New("52:54:00:aa:bb:cc", "10.0.0.1", "web01")
+	match, err := inv.Lookup(srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match == nil {
+		t.Fatal("Expected a match")
+	}
+	if match.Script.Name != "ubuntu.ipxe" || match.Script.Environment != "prod" {
+		t.Errorf("Expected: ubuntu.ipxe [prod]\nGot: %s [%s]", match.Script.Name, match.Script.Environment)
+	}
+	if match.Script.Params["release"] != "noble" {
+		t.Errorf("Expected: noble\nGot: %v", match.Script.Params["release"])
+	}
+	if match.BootType != event.InventoryBoot {
+		t.Errorf("Expected: %s\nGot: %s", event.InventoryBoot, match.BootType)
+	}
+
+	// Modifying the returned script must not alter the cached answer.
+	match.Script.Params["release"] = "changed"
+	match, err = inv.Lookup(srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match.Script.Params["release"] != "noble" {
+		t.Errorf("Expected: noble\nGot: %v", match.Script.Params["release"])
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("Expected: 1 request\nGot: %d", n)
+	}
+}
+
+func TestHTTPLookupUnknownHost(t *testing.T) {
+	var requests int32
+	stub := inventoryStub(t, &requests)
+
+	inv, err := NewHTTP(stub.URL, time.Second, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		match, err := inv.Lookup(server.New("52:54:00:11:22:33", "10.0.0.2", ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if match != nil {
+			t.Error("Expected no match")
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("Expected unknown hosts to be cached, got %d requests", n)
+	}
+}
+
+func TestHTTPLookupErrors(t *testing.T) {
+	var requests int32
+	stub := inventoryStub(t, &requests)
+
+	inv, err := NewHTTP(stub.URL, 50*time.Millisecond, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mac := range []string{"52:54:00:00:00:01", "52:54:00:00:00:02"} {
+		if _, err := inv.Lookup(server.New(mac, "10.0.0.3", "")); err == nil {
+			t.Errorf("Expected error for %s", mac)
+		}
+	}
+
+	stub.Close()
+	if _, err := inv.Lookup(server.New("52:54:00:aa:bb:cc", "10.0.0.1", "")); err == nil {
+		t.Error("Expected error for unreachable inventory")
+	}
+}
+
+func TestNewHTTPInvalidURL(t *testing.T) {
+	if _, err := NewHTTP("ftp://inventory", time.Second, time.Minute); err == nil {
+		t.Error("Expected error")
+	}
+}
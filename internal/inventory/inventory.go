@@ -0,0 +1,112 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inventory
+
+import (
+	"github.com/thousandeyes/shoelaces/internal/event"
+	"github.com/thousandeyes/shoelaces/internal/hosts"
+	"github.com/thousandeyes/shoelaces/internal/mappings"
+	"github.com/thousandeyes/shoelaces/internal/server"
+)
+
+// Match holds the answer of a HostSource for a host.
+type Match struct {
+	Script   *mappings.Script
+	BootType string
+}
+
+// HostSource is asked by the polling logic what a host should boot, and with
+// what params. Lookup returns a nil Match if the source doesn't know the
+// host. The returned Script is owned by the caller, which can modify it.
+type HostSource interface {
+	Name() string
+	Lookup(srv server.Server) (*Match, error)
+}
+
+// Mappings is a HostSource backed by the hostname and network maps of the
+// mappings YAML file.
+type Mappings struct {
+	hostnameMaps []mappings.HostnameMap
+	networkMaps  []mappings.NetworkMap
+}
+
+// NewMappings returns a HostSource answering with the received maps.
+func NewMappings(hostnameMaps []mappings.HostnameMap, networkMaps []mappings.NetworkMap) *Mappings {
+	return &Mappings{hostnameMaps: hostnameMaps, networkMaps: networkMaps}
+}
+
+// Name implements HostSource.
+func (m *Mappings) Name() string {
+	return "mappings"
+}
+
+// Lookup implements HostSource. The hostname maps are matched with the
+// hostname of the host, and take precedence over the network maps, which
+// are matched with its IP.
+func (m *Mappings) Lookup(srv server.Server) (*Match, error) {
+	if script, found := mappings.FindScriptForHostname(m.hostnameMaps, srv.Hostname); found {
+		s := copyScript(script)
+		s.Params["hostname"] = srv.Hostname
+		return &Match{Script: s, BootType: event.PtrMatchBoot}, nil
+	}
+	if script, found := mappings.FindScriptForNetwork(m.networkMaps, srv.IP); found {
+		return &Match{Script: copyScript(script), BootType: event.SubnetMatchBoot}, nil
+	}
+	return nil, nil
+}
+
+// HostFiles is a HostSource backed by the host files setting a script.
+type HostFiles struct {
+	hosts *hosts.Hosts
+}
+
+// NewHostFiles returns a HostSource answering with the received host files.
+func NewHostFiles(h *hosts.Hosts) *HostFiles {
+	return &HostFiles{hosts: h}
+}
+
+// Name implements HostSource.
+func (h *HostFiles) Name() string {
+	return "host-files"
+}
+
+// Lookup implements HostSource. Host files without a script are ignored.
+func (h *HostFiles) Lookup(srv server.Server) (*Match, error) {
+	host, ok := h.hosts.Find(srv.Mac, srv.Hostname, srv.Serial, srv.UUID)
+	if !ok || host.Script == "" {
+		return nil, nil
+	}
+	s := copyScript(&mappings.Script{
+		Name:        host.Script,
+		Environment: host.Environment,
+		Params:      host.Params,
+	})
+	if _, ok := s.Params["hostname"]; !ok && host.Hostname != "" {
+		s.Params["hostname"] = host.Hostname
+	}
+	return &Match{Script: s, BootType: event.HostFileBoot}, nil
+}
+
+func copyScript(script *mappings.Script) *mappings.Script {
+	params := make(map[string]interface{}, len(script.Params))
+	for k, v := range script.Params {
+		params[k] = v
+	}
+	return &mappings.Script{
+		Name:        script.Name,
+		Environment: script.Environment,
+		Params:      params,
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inventory
+
+import (
+	"net"
+	"regexp"
+	"testing"
+
+	"github.com/thousandeyes/shoelaces/internal/event"
+	"github.com/thousandeyes/shoelaces/internal/mappings"
+	"github.com/thousandeyes/shoelaces/internal/server"
+)
+
+func TestMappingsLookup(t *testing.T) {
+	_, network, _ := net.ParseCIDR("10.0.0.0/8")
+	hostScript := &mappings.Script{Name: "debian.ipxe", Params: map[string]interface{}{"release": "bookworm"}}
+	netScript := &mappings.Script{Name: "ubuntu.ipxe", Params: map[string]interface{}{"release": "noble"}}
+	m := NewMappings(
+		[]mappings.HostnameMap{{Hostname: regexp.MustCompile(`^web\d+$`), Script: hostScript}},
+		[]mappings.NetworkMap{{Network: network, Script: netScript}},
+	)
+
+	match, err := m.Lookup(server.New("52:54:00:aa:bb:cc", "10.0.0.1", "web01"))
+	if err != nil || match == nil {
+		t.Fatal("Expected a hostname match")
+	}
+	if match.BootType != event.PtrMatchBoot || match.Script.Params["hostname"] != "web01" {
+		t.Errorf("Unexpected match: %v %v", match.BootType, match.Script)
+	}
+	if _, ok := hostScript.Params["hostname"]; ok {
+		t.Error("Expected the mapping script to be left untouched")
+	}
+
+	match, err = m.Lookup(server.New("52:54:00:aa:bb:cc", "10.0.0.1", "db01"))
+	if err != nil || match == nil {
+		t.Fatal("Expected a network match")
+	}
+	if match.BootType != event.SubnetMatchBoot || match.Script.Name != "ubuntu.ipxe" {
+		t.Errorf("Unexpected match: %v %v", match.BootType, match.Script)
+	}
+
+	match, err = m.Lookup(server.New("52:54:00:aa:bb:cc", "192.168.0.1", "db01"))
+	if err != nil || match != nil {
+		t.Error("Expected no match")
+	}
+}
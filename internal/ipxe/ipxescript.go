@@ -21,6 +21,7 @@ import (
 
 	"github.com/thousandeyes/shoelaces/internal/environment"
 	"github.com/thousandeyes/shoelaces/internal/log"
+	"github.com/thousandeyes/shoelaces/internal/overrides"
 )
 
 // ScriptName keeps the name of a script
@@ -40,26 +41,61 @@ type Script struct {
 }
 
 // ScriptList receives the global environment and return a list of IPXE
-// scripts.
+// scripts. Environments list the scripts found through their inheritance
+// chain, without including the ones of the default environment.
 func ScriptList(env *environment.Environment) []Script {
 	ipxeScripts := make([]Script, 0)
 	// Collect scripts from the main config dir.
 	ipxeScripts = appendScriptsFromDir(env.Logger, ipxeScripts, env.TemplateExtension,
-		filepath.Join(env.DataDir, "ipxe"), "", "/configs/")
+		filepath.Join(env.DataDir, "ipxe"), "", "/configs/", nil)
 
 	// Collect scripts from the config environments if any
-	if len(env.Environments) > 0 {
-		for _, e := range env.Environments {
-			ep := filepath.Join(env.DataDir, env.EnvDir, e, "ipxe")
+	for _, e := range env.Environments {
+		seen := make(map[ScriptName]bool)
+		for _, c := range env.Overrides.Chain(e) {
+			if c == overrides.Default {
+				break
+			}
+			ep := filepath.Join(env.DataDir, env.EnvDir, c, "ipxe")
 			ipxeScripts = appendScriptsFromDir(env.Logger, ipxeScripts, env.TemplateExtension, ep,
-				EnvName(e), ScriptPath("/env/"+e+"/configs/"))
+				EnvName(e), ScriptPath("/env/"+e+"/configs/"), seen)
 		}
 	}
 	return ipxeScripts
 }
 
-func appendScriptsFromDir(logger log.Logger, scripts []Script, templateExtension string, dir string, e EnvName, p ScriptPath) []Script {
+// EnvScriptList returns the IPXE scripts available in an environment, the
+// ones inherited from the default environment included, with the paths of
+// the environment.
+func EnvScriptList(env *environment.Environment, name string) []Script {
+	if name == "" || name == overrides.Default {
+		return appendScriptsFromDir(env.Logger, nil, env.TemplateExtension,
+			filepath.Join(env.DataDir, "ipxe"), "", "/configs/", nil)
+	}
+
+	var ipxeScripts []Script
+	seen := make(map[ScriptName]bool)
+	for _, c := range env.Overrides.Chain(name) {
+		dir := filepath.Join(env.DataDir, env.EnvDir, c, "ipxe")
+		if c == overrides.Default {
+			dir = filepath.Join(env.DataDir, "ipxe")
+		}
+		ipxeScripts = appendScriptsFromDir(env.Logger, ipxeScripts, env.TemplateExtension, dir,
+			EnvName(name), ScriptPath("/env/"+name+"/configs/"), seen)
+	}
+	return ipxeScripts
+}
+
+// appendScriptsFromDir appends the scripts found in dir, skipping the ones
+// already in seen, if not nil.
+func appendScriptsFromDir(logger log.Logger, scripts []Script, templateExtension string, dir string, e EnvName, p ScriptPath, seen map[ScriptName]bool) []Script {
 	for _, s := range scriptDirList(logger, templateExtension, dir) {
+		if seen != nil {
+			if seen[s] {
+				continue
+			}
+			seen[s] = true
+		}
 		scripts = append(scripts, Script{Name: s, Env: e, Path: p})
 	}
 	return scripts
@@ -0,0 +1,439 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipxe
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/thousandeyes/shoelaces/internal/environment"
+	"github.com/thousandeyes/shoelaces/internal/overrides"
+	"github.com/thousandeyes/shoelaces/internal/utils"
+)
+
+// MenuFile is the file, in the data dir or in an environment directory,
+// defining the iPXE menu. Environments use the closest one in their
+// inheritance chain.
+const MenuFile = "menu.yaml"
+
+// MenuTemplate is the name of the template that, when defined, renders the
+// iPXE menu instead of the built-in one. It gets the menu as the menu
+// variable.
+const MenuTemplate = "ipxemenu"
+
+const (
+	defaultMenuTitle  = "Choose target to boot"
+	defaultMenuPrompt = "Enter hostname or none:"
+	localLabel        = "Boot from local disk"
+	shellLabel        = "iPXE shell"
+
+	// fieldPrefix keeps the iPXE settings of the form fields apart from the
+	// ones of iPXE, such as hostname.
+	fieldPrefix = "slc_"
+)
+
+// fieldNameRegex matches the variables that can be asked in iPXE and passed
+// as query parameters as they are.
+var fieldNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// MenuConfig is the contents of a menu file.
+type MenuConfig struct {
+	Title   string      `yaml:"title"`
+	Default string      `yaml:"default"`
+	Timeout string      `yaml:"timeout"`
+	Prompt  *string     `yaml:"prompt"`
+	Forms   bool        `yaml:"forms"`
+	Hidden  []string    `yaml:"hidden"`
+	Groups  []MenuGroup `yaml:"groups"`
+}
+
+// MenuGroup is a section of the menu. Without items, it lists the scripts
+// of its environment, or the one of the menu if empty.
+type MenuGroup struct {
+	Title       string     `yaml:"title"`
+	Environment string     `yaml:"environment"`
+	Items       []MenuItem `yaml:"items"`
+}
+
+// MenuItem is an entry of a group: a script, a separator, or the entries
+// booting from the local disk or opening the iPXE shell.
+type MenuItem struct {
+	Script    string `yaml:"script"`
+	Label     string `yaml:"label"`
+	Separator bool   `yaml:"separator"`
+	Local     bool   `yaml:"local"`
+	Shell     bool   `yaml:"shell"`
+}
+
+// Menu is an iPXE menu ready to be rendered.
+type Menu struct {
+	Title   string
+	Default string // ID of the default entry, if any
+	Timeout int    // Milliseconds before choosing the default entry
+	Prompt  string // Asks for the hostname if not empty
+	Forms   bool   // Asks the variables with form and present, not read
+	BaseURL string
+	Entries []MenuEntry
+}
+
+// MenuEntry is a line of an iPXE menu. The ID of scripts is the URL they are
+// chained from.
+type MenuEntry struct {
+	ID     string
+	Text   string
+	Script string
+	Env    string // Environment of the script, empty for the default one
+	Gap    bool
+	Fields []MenuField
+}
+
+// MenuField is a variable of a script asked before chaining it, and passed
+// as a query parameter.
+type MenuField struct {
+	Name    string
+	Setting string // iPXE setting holding the answer
+	Default string
+	Secret  bool
+}
+
+// Query returns the query string passing the answers of the fields of the
+// entry.
+func (e MenuEntry) Query() string {
+	var b bytes.Buffer
+	for i, f := range e.Fields {
+		if i > 0 {
+			b.WriteString("&")
+		}
+		fmt.Fprintf(&b, "%s=${%s:uristring}", f.Name, f.Setting)
+	}
+	return b.String()
+}
+
+// HasEntry reports whether the menu has an entry with the received ID.
+func (m *Menu) HasEntry(id string) bool {
+	for _, e := range m.Entries {
+		if !e.Gap && e.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// TimesOut reports whether the menu boots its default entry when nothing is
+// pressed before its timeout.
+func (m *Menu) TimesOut() bool {
+	return m.Default != "" && m.Timeout > 0
+}
+
+// DefaultEntry returns the default entry of the menu, or nil if there is
+// none.
+func (m *Menu) DefaultEntry() *MenuEntry {
+	for i, e := range m.Entries {
+		if !e.Gap && e.ID == m.Default {
+			return &m.Entries[i]
+		}
+	}
+	return nil
+}
+
+// menuTemplate renders the built-in menu. iPXE's choose can't tell a
+// timeout from a choice, so timing out menus wait for a key with prompt
+// first and, if there is none, boot the default entry with the default
+// answers of its fields, without asking anything.
+var menuTemplate = template.Must(template.New("menu").Parse(`#!ipxe
+{{if .TimesOut}}prompt --timeout {{.Timeout}} Press any key for the menu || goto timeout
+{{end}}{{if or .Forms .TimesOut}}:menu
+{{end}}menu {{.Title}}
+{{range .Entries}}{{if .Gap}}item --gap{{if .Text}} {{.Text}}{{end}}{{else}}item {{.ID}} {{.Text}}{{end}}
+{{end}}
+choose{{if .Default}} --default {{.Default}}{{end}} target
+{{if .HasEntry "local"}}iseq ${target} local && goto local ||
+{{end}}{{if .HasEntry "shell"}}iseq ${target} shell && goto shell ||
+{{end}}{{range $i, $e := .Entries}}{{if .Fields}}iseq ${target} {{.ID}} && goto form{{$i}} ||
+{{end}}{{end}}{{if .Prompt}}echo -n {{.Prompt}}
+read hostname
+{{end}}set baseurl {{.BaseURL}}
+# Boot it as intended.
+chain ${target}
+{{if .TimesOut}}{{with .DefaultEntry}}
+:timeout
+{{if eq .ID "local" "shell"}}goto {{.ID}}
+{{else}}{{template "defaults" .}}set baseurl {{$.BaseURL}}
+chain {{.ID}}{{if .Fields}}?{{.Query}}{{end}}
+{{end}}{{end}}{{end}}{{if .HasEntry "local"}}
+:local
+echo Booting from local disk
+exit
+{{end}}{{if .HasEntry "shell"}}
+:shell
+shell
+{{end}}{{range $i, $e := .Entries}}{{if .Fields}}
+:form{{$i}}
+{{template "defaults" .}}{{if $.Forms}}form {{.Text}}
+{{range .Fields}}item{{if .Secret}} --secret{{end}} {{.Setting}} {{.Name}}
+{{end}}present || goto menu
+{{else}}echo {{.Text}}
+{{range .Fields}}echo -n {{.Name}}:
+read {{.Setting}}
+{{end}}{{end}}set baseurl {{$.BaseURL}}
+chain {{.ID}}?{{.Query}}
+{{end}}{{end}}
+{{- define "defaults"}}{{range .Fields}}{{if .Default}}set {{.Setting}} {{.Default}}{{else}}clear {{.Setting}}{{end}}
+{{end}}{{end}}`))
+
+// Render returns the built-in iPXE script of the menu.
+func (m *Menu) Render() (string, error) {
+	var b bytes.Buffer
+	if err := menuTemplate.Execute(&b, m); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// LoadMenuConfig returns the menu file of an environment, the closest one
+// in its inheritance chain, or nil if there is none.
+func LoadMenuConfig(env *environment.Environment, name string) (*MenuConfig, error) {
+	for _, e := range env.Overrides.Chain(name) {
+		file := filepath.Join(env.DataDir, env.EnvDir, e, MenuFile)
+		if e == overrides.Default {
+			file = filepath.Join(env.DataDir, MenuFile)
+		}
+		contents, err := os.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		config := &MenuConfig{}
+		if err := yaml.Unmarshal(contents, config); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		return config, nil
+	}
+	return nil, nil
+}
+
+// BuildMenu returns the iPXE menu of an environment, the main one if name
+// is empty. Without menu file, the main menu lists every script and the
+// menu of an environment the ones available in it.
+func BuildMenu(env *environment.Environment, name string) (*Menu, error) {
+	if !env.Overrides.Has(name) {
+		return nil, fmt.Errorf("unknown environment %q", name)
+	}
+	config, err := LoadMenuConfig(env, name)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &MenuConfig{}
+	}
+
+	menu := &Menu{
+		Title:   defaultMenuTitle,
+		Prompt:  defaultMenuPrompt,
+		BaseURL: env.Overrides.BaseURL(env.BaseURL, name),
+	}
+	if config.Title != "" {
+		menu.Title = config.Title
+	}
+	if config.Prompt != nil {
+		menu.Prompt = *config.Prompt
+	}
+	menu.Forms = config.Forms
+	for _, pattern := range config.Hidden {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid hidden pattern %q: %w", pattern, err)
+		}
+	}
+
+	if len(config.Groups) == 0 {
+		scripts := EnvScriptList(env, name)
+		if name == "" {
+			scripts = ScriptList(env)
+		}
+		menu.Entries = scriptEntries(scripts, config.Hidden)
+	}
+	for _, g := range config.Groups {
+		entries, err := groupEntries(env, name, g, config.Hidden)
+		if err != nil {
+			return nil, err
+		}
+		menu.Entries = append(menu.Entries, entries...)
+	}
+
+	for i := range menu.Entries {
+		menu.Entries[i].Fields = entryFields(env, menu.Entries[i])
+	}
+
+	if config.Default != "" {
+		for _, e := range menu.Entries {
+			if !e.Gap && (e.ID == config.Default || e.Script == config.Default) {
+				menu.Default = e.ID
+				break
+			}
+		}
+		if menu.Default == "" {
+			return nil, fmt.Errorf("default menu item %q not found", config.Default)
+		}
+	}
+	if config.Timeout != "" {
+		timeout, err := time.ParseDuration(config.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid menu timeout %q: %w", config.Timeout, err)
+		}
+		menu.Timeout = int(timeout / time.Millisecond)
+	}
+	return menu, nil
+}
+
+// entryFields returns the variables of the script of an entry that aren't
+// set by Shoelaces, with the default parameters of its environment as
+// default values, and the hostname of iPXE for the hostname. Sensitive
+// variables with a default are left out, so their values don't show in the
+// menu.
+func entryFields(env *environment.Environment, e MenuEntry) []MenuField {
+	if e.Gap || e.Script == "" || env.Templates == nil {
+		return nil
+	}
+	name := e.Env
+	if name == "" {
+		name = overrides.Default
+	}
+	params := env.Overrides.Params(name)
+
+	var fields []MenuField
+	for _, v := range env.Templates.ListVariables(e.Script, name) {
+		if !fieldNameRegex.MatchString(v) || utils.StringInSlice(v, env.ParamsBlacklist) {
+			continue
+		}
+		field := MenuField{Name: v, Setting: fieldPrefix + v, Secret: env.Redactor.IsSensitive(v)}
+		if value, ok := params[v]; ok {
+			if field.Secret {
+				continue
+			}
+			field.Default = strings.ReplaceAll(fmt.Sprint(value), "\n", " ")
+		} else if v == "hostname" {
+			// The one given by DHCP, if any.
+			field.Default = "${hostname}"
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+func groupEntries(env *environment.Environment, name string, g MenuGroup, hidden []string) ([]MenuEntry, error) {
+	e := g.Environment
+	if e == "" {
+		e = name
+	}
+	if !env.Overrides.Has(e) {
+		return nil, fmt.Errorf("menu group %q has unknown environment %q", g.Title, e)
+	}
+	if e == overrides.Default {
+		e = ""
+	}
+	scripts := EnvScriptList(env, e)
+
+	var entries []MenuEntry
+	if g.Title != "" {
+		entries = append(entries, MenuEntry{Text: g.Title, Gap: true})
+	}
+	if len(g.Items) == 0 {
+		return append(entries, scriptEntries(scripts, hidden)...), nil
+	}
+
+	for _, item := range g.Items {
+		entry, err := itemEntry(item, scripts)
+		if err != nil {
+			return nil, fmt.Errorf("menu group %q: %w", g.Title, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func itemEntry(item MenuItem, scripts []Script) (MenuEntry, error) {
+	kinds := 0
+	for _, set := range []bool{item.Script != "", item.Separator, item.Local, item.Shell} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return MenuEntry{}, errors.New("menu items must be one of script, separator, local or shell")
+	}
+
+	switch {
+	case item.Separator:
+		return MenuEntry{Text: item.Label, Gap: true}, nil
+	case item.Local:
+		return MenuEntry{ID: "local", Text: labelOr(item.Label, localLabel)}, nil
+	case item.Shell:
+		return MenuEntry{ID: "shell", Text: labelOr(item.Label, shellLabel)}, nil
+	}
+	for _, s := range scripts {
+		if string(s.Name) == item.Script {
+			entry := scriptEntry(s)
+			entry.Text = labelOr(item.Label, entry.Text)
+			return entry, nil
+		}
+	}
+	return MenuEntry{}, fmt.Errorf("unknown script %q", item.Script)
+}
+
+func scriptEntries(scripts []Script, hidden []string) []MenuEntry {
+	var entries []MenuEntry
+	for _, s := range scripts {
+		if !isHidden(string(s.Name), hidden) {
+			entries = append(entries, scriptEntry(s))
+		}
+	}
+	return entries
+}
+
+func scriptEntry(s Script) MenuEntry {
+	text := string(s.Name)
+	if len(s.Env) > 0 {
+		text = fmt.Sprintf("%s [%s]", s.Name, s.Env)
+	}
+	return MenuEntry{ID: string(s.Path) + string(s.Name), Text: text, Script: string(s.Name), Env: string(s.Env)}
+}
+
+func isHidden(name string, hidden []string) bool {
+	for _, pattern := range hidden {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func labelOr(label, fallback string) string {
+	if label != "" {
+		return label
+	}
+	return fallback
+}
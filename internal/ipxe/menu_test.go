@@ -0,0 +1,352 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipxe
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thousandeyes/shoelaces/internal/environment"
+	"github.com/thousandeyes/shoelaces/internal/log"
+	"github.com/thousandeyes/shoelaces/internal/overrides"
+	"github.com/thousandeyes/shoelaces/internal/redact"
+	"github.com/thousandeyes/shoelaces/internal/templates"
+)
+
+func testEnvironment(t *testing.T, files map[string]string) *environment.Environment {
+	dir := t.TempDir()
+	for name, contents := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tree, err := overrides.New([]overrides.Override{{Name: "production"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &environment.Environment{
+		DataDir:           dir,
+		EnvDir:            "env_overrides",
+		TemplateExtension: ".slc",
+		BaseURL:           "localhost:8081",
+		Overrides:         tree,
+		Environments:      tree.Names(),
+		Logger:            log.MakeLogger(io.Discard),
+	}
+}
+
+var testScripts = map[string]string{
+	"ipxe/flatcar.ipxe.slc":                          "",
+	"ipxe/ubuntu.ipxe.slc":                           "",
+	"ipxe/debug.ipxe.slc":                            "",
+	"env_overrides/production/ipxe/flatcar.ipxe.slc": "",
+}
+
+func TestDefaultMenu(t *testing.T) {
+	env := testEnvironment(t, testScripts)
+
+	menu, err := BuildMenu(env, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err := menu.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "#!ipxe\n" +
+		"menu Choose target to boot\n" +
+		"item /configs/debug.ipxe debug.ipxe\n" +
+		"item /configs/flatcar.ipxe flatcar.ipxe\n" +
+		"item /configs/ubuntu.ipxe ubuntu.ipxe\n" +
+		"item /env/production/configs/flatcar.ipxe flatcar.ipxe [production]\n" +
+		"\n" +
+		"choose target\n" +
+		"echo -n Enter hostname or none:\n" +
+		"read hostname\n" +
+		"set baseurl localhost:8081\n" +
+		"# Boot it as intended.\n" +
+		"chain ${target}\n"
+	if script != expected {
+		t.Errorf("Expected: %q\nGot: %q", expected, script)
+	}
+
+	menu, err = BuildMenu(env, "production")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, e := range menu.Entries {
+		ids = append(ids, e.ID)
+	}
+	expectedIDs := "/env/production/configs/flatcar.ipxe /env/production/configs/debug.ipxe /env/production/configs/ubuntu.ipxe"
+	if strings.Join(ids, " ") != expectedIDs || menu.BaseURL != "localhost:8081/env/production" {
+		t.Errorf("Expected: %s\nGot: %v %s", expectedIDs, ids, menu.BaseURL)
+	}
+
+	if _, err := BuildMenu(env, "staging"); err == nil {
+		t.Error("Expected: error for unknown environment\nGot: nil")
+	}
+}
+
+func TestMenuFile(t *testing.T) {
+	files := map[string]string{
+		"menu.yaml": `title: Boot menu
+default: ubuntu.ipxe
+timeout: 10s
+prompt: ""
+hidden: ["debug*"]
+groups:
+  - title: Production
+    environment: production
+    items:
+      - script: flatcar.ipxe
+        label: Flatcar stable
+  - title: Default
+    environment: default
+  - items:
+      - separator: true
+      - local: true
+      - shell: true
+        label: Shell
+`,
+		"env_overrides/production/menu.yaml": "default: local\ngroups:\n  - items:\n      - local: true\n",
+	}
+	for name, contents := range testScripts {
+		files[name] = contents
+	}
+	env := testEnvironment(t, files)
+
+	menu, err := BuildMenu(env, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err := menu.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "#!ipxe\n" +
+		"prompt --timeout 10000 Press any key for the menu || goto timeout\n" +
+		":menu\n" +
+		"menu Boot menu\n" +
+		"item --gap Production\n" +
+		"item /env/production/configs/flatcar.ipxe Flatcar stable\n" +
+		"item --gap Default\n" +
+		"item /configs/flatcar.ipxe flatcar.ipxe\n" +
+		"item /configs/ubuntu.ipxe ubuntu.ipxe\n" +
+		"item --gap\n" +
+		"item local Boot from local disk\n" +
+		"item shell Shell\n" +
+		"\n" +
+		"choose --default /configs/ubuntu.ipxe target\n" +
+		"iseq ${target} local && goto local ||\n" +
+		"iseq ${target} shell && goto shell ||\n" +
+		"set baseurl localhost:8081\n" +
+		"# Boot it as intended.\n" +
+		"chain ${target}\n" +
+		"\n" +
+		":timeout\n" +
+		"set baseurl localhost:8081\n" +
+		"chain /configs/ubuntu.ipxe\n" +
+		"\n" +
+		":local\n" +
+		"echo Booting from local disk\n" +
+		"exit\n" +
+		"\n" +
+		":shell\n" +
+		"shell\n"
+	if script != expected {
+		t.Errorf("Expected: %q\nGot: %q", expected, script)
+	}
+
+	// Environments use the closest menu file in their chain.
+	menu, err = BuildMenu(env, "production")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if menu.Default != "local" || len(menu.Entries) != 1 || menu.Title != defaultMenuTitle {
+		t.Errorf("Expected: the production menu\nGot: %+v", menu)
+	}
+}
+
+func TestInvalidMenuFile(t *testing.T) {
+	cases := map[string]string{
+		"unknown default":     "default: nothing.ipxe\n",
+		"invalid timeout":     "timeout: soon\n",
+		"unknown script":      "groups:\n  - items:\n      - script: nothing.ipxe\n",
+		"unknown environment": "groups:\n  - environment: staging\n",
+		"ambiguous item":      "groups:\n  - items:\n      - local: true\n        shell: true\n",
+		"empty item":          "groups:\n  - items:\n      - label: nothing\n",
+		"invalid hidden":      "hidden: ['[']\n",
+		"invalid yaml":        "groups: {\n",
+	}
+	for name, contents := range cases {
+		files := map[string]string{"menu.yaml": contents}
+		for n, c := range testScripts {
+			files[n] = c
+		}
+		if _, err := BuildMenu(testEnvironment(t, files), ""); err == nil {
+			t.Errorf("Expected: error for %s\nGot: nil", name)
+		}
+	}
+}
+
+func TestMenuFields(t *testing.T) {
+	files := map[string]string{
+		"ipxe/ubuntu.ipxe.slc": `{{define "ubuntu.ipxe"}}#!ipxe
+kernel http://{{.baseURL}}/{{.release}} hostname={{.hostname}} password={{.root_password}} token={{.token}}
+{{end}}`,
+		"ipxe/rescue.ipxe.slc": `{{define "rescue.ipxe"}}#!ipxe
+chain http://{{.baseURL}}/rescue
+{{end}}`,
+	}
+	env := testEnvironment(t, files)
+	tree, err := overrides.New([]overrides.Override{
+		{Name: "production", Params: map[string]interface{}{"release": "noble", "token": "s3cr3t"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.Overrides = tree
+	env.Environments = tree.Names()
+	env.ParamsBlacklist = []string{"baseURL"}
+	env.Redactor = redact.New()
+	env.Redactor.SetNames([]string{"*password*", "*token*"})
+	env.Templates = templates.New()
+	env.Templates.ParseTemplates(env.Logger, env.DataDir, env.EnvDir, tree, env.TemplateExtension)
+
+	menu, err := BuildMenu(env, "production")
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err := menu.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "#!ipxe\n" +
+		"menu Choose target to boot\n" +
+		"item /env/production/configs/rescue.ipxe rescue.ipxe [production]\n" +
+		"item /env/production/configs/ubuntu.ipxe ubuntu.ipxe [production]\n" +
+		"\n" +
+		"choose target\n" +
+		"iseq ${target} /env/production/configs/ubuntu.ipxe && goto form1 ||\n" +
+		"echo -n Enter hostname or none:\n" +
+		"read hostname\n" +
+		"set baseurl localhost:8081/env/production\n" +
+		"# Boot it as intended.\n" +
+		"chain ${target}\n" +
+		"\n" +
+		":form1\n" +
+		"set slc_release noble\n" +
+		"set slc_hostname ${hostname}\n" +
+		"clear slc_root_password\n" +
+		"echo ubuntu.ipxe [production]\n" +
+		"echo -n release:\n" +
+		"read slc_release\n" +
+		"echo -n hostname:\n" +
+		"read slc_hostname\n" +
+		"echo -n root_password:\n" +
+		"read slc_root_password\n" +
+		"set baseurl localhost:8081/env/production\n" +
+		"chain /env/production/configs/ubuntu.ipxe?release=${slc_release:uristring}&hostname=${slc_hostname:uristring}&root_password=${slc_root_password:uristring}\n"
+	if script != expected {
+		t.Errorf("Expected: %q\nGot: %q", expected, script)
+	}
+
+	menu.Forms = true
+	script, err = menu.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{":menu\nmenu ", "form ubuntu.ipxe [production]\n", "item slc_release release\n",
+		"item --secret slc_root_password root_password\n", "present || goto menu\n"} {
+		if !strings.Contains(script, line) {
+			t.Errorf("Expected: %q in the form\nGot: %q", line, script)
+		}
+	}
+}
+
+func TestMenuTimeoutFields(t *testing.T) {
+	files := map[string]string{
+		"menu.yaml": "default: ubuntu.ipxe\ntimeout: 5s\ngroups:\n  - items:\n      - script: ubuntu.ipxe\n      - local: true\n",
+		"ipxe/ubuntu.ipxe.slc": `{{define "ubuntu.ipxe"}}#!ipxe
+kernel http://{{.baseURL}}/ubuntu hostname={{.hostname}}
+{{end}}`,
+	}
+	env := testEnvironment(t, files)
+	env.ParamsBlacklist = []string{"baseURL"}
+	env.Templates = templates.New()
+	env.Templates.ParseTemplates(env.Logger, env.DataDir, env.EnvDir, env.Overrides, env.TemplateExtension)
+
+	menu, err := BuildMenu(env, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err := menu.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "#!ipxe\n" +
+		"prompt --timeout 5000 Press any key for the menu || goto timeout\n" +
+		":menu\n" +
+		"menu Choose target to boot\n" +
+		"item /configs/ubuntu.ipxe ubuntu.ipxe\n" +
+		"item local Boot from local disk\n" +
+		"\n" +
+		"choose --default /configs/ubuntu.ipxe target\n" +
+		"iseq ${target} local && goto local ||\n" +
+		"iseq ${target} /configs/ubuntu.ipxe && goto form0 ||\n" +
+		"echo -n Enter hostname or none:\n" +
+		"read hostname\n" +
+		"set baseurl localhost:8081\n" +
+		"# Boot it as intended.\n" +
+		"chain ${target}\n" +
+		"\n" +
+		":timeout\n" +
+		"set slc_hostname ${hostname}\n" +
+		"set baseurl localhost:8081\n" +
+		"chain /configs/ubuntu.ipxe?hostname=${slc_hostname:uristring}\n" +
+		"\n" +
+		":local\n" +
+		"echo Booting from local disk\n" +
+		"exit\n" +
+		"\n" +
+		":form0\n" +
+		"set slc_hostname ${hostname}\n" +
+		"echo ubuntu.ipxe\n" +
+		"echo -n hostname:\n" +
+		"read slc_hostname\n" +
+		"set baseurl localhost:8081\n" +
+		"chain /configs/ubuntu.ipxe?hostname=${slc_hostname:uristring}\n"
+	if script != expected {
+		t.Errorf("Expected: %q\nGot: %q", expected, script)
+	}
+
+	// A timed out local default boots from the local disk.
+	menu.Default = "local"
+	script, err = menu.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(script, "\n:timeout\ngoto local\n") {
+		t.Errorf("Expected: the timeout going to local\nGot: %q", script)
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipxebin
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Binaries are the iPXE binaries listed first, in this order, as the ones
+// hosts usually chainload: undionly.kpxe for BIOS, ipxe.efi and snponly.efi
+// for UEFI. Any other file of the iPXE dir is served as well.
+var Binaries = []string{"undionly.kpxe", "ipxe.efi", "snponly.efi"}
+
+// DefaultEFI is the binary the boot images are built from by default.
+const DefaultEFI = "ipxe.efi"
+
+// PlaceholderSize is the size of the embedded script placeholder, and so
+// the maximum size of the scripts embedded in binaries.
+const PlaceholderSize = 1024
+
+const placeholderHeader = "#!ipxe\n# shoelaces embedded script placeholder\n"
+
+// Binary is a file of the iPXE dir.
+type Binary struct {
+	Name       string
+	Size       int64
+	Embeddable bool // Has the embedded script placeholder
+}
+
+// Placeholder returns the script iPXE binaries have to be built with, as in
+// make bin-x86_64-efi/ipxe.efi EMBED=placeholder.ipxe, to get a script
+// embedded later by Embed. It does nothing by itself.
+func Placeholder() []byte {
+	p := make([]byte, 0, PlaceholderSize)
+	p = append(p, placeholderHeader...)
+	for len(p) < PlaceholderSize {
+		line := bytes.Repeat([]byte("#"), 63)
+		if n := PlaceholderSize - len(p); n < 64 {
+			line = line[:n-1]
+		}
+		p = append(append(p, line...), '\n')
+	}
+	return p
+}
+
+// StartScript returns the script booting from the Shoelaces instance at
+// baseURL, retrying until it can be reached.
+func StartScript(baseURL string) string {
+	return "#!ipxe\n" +
+		":retry\n" +
+		"dhcp && chain --autofree http://" + baseURL + "/start ||\n" +
+		"echo Booting from Shoelaces failed, retrying in 10 seconds\n" +
+		"sleep 10\n" +
+		"goto retry\n"
+}
+
+// Embed returns a copy of bin, an iPXE binary built with the placeholder
+// script, with script embedded in place of the placeholder. iPXE only
+// keeps the placeholder as is in uncompressed binaries, such as the EFI
+// ones. Signatures of the binary, if any, are no longer valid.
+func Embed(bin []byte, script string) ([]byte, error) {
+	placeholder := Placeholder()
+	i := bytes.Index(bin, placeholder)
+	if i < 0 {
+		return nil, errors.New("binary has no embedded script placeholder")
+	}
+	if len(script) > PlaceholderSize {
+		return nil, fmt.Errorf("script longer than %d bytes", PlaceholderSize)
+	}
+
+	out := append([]byte(nil), bin...)
+	region := out[i : i+PlaceholderSize]
+	n := copy(region, script)
+	for j := n; j < len(region); j++ {
+		region[j] = '\n'
+	}
+	return out, nil
+}
+
+// scan is whether a version of a binary has the placeholder.
+type scan struct {
+	size       int64
+	modTime    time.Time
+	embeddable bool
+}
+
+// scans holds the last scan of each binary listed, by path, so binaries are
+// only read again when they change.
+var scans = struct {
+	sync.Mutex
+	m map[string]scan
+}{m: make(map[string]scan)}
+
+// List returns the binaries of the iPXE dir, the usual ones first and then
+// the rest by name.
+func List(dir string) ([]Binary, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var binaries []Binary
+	for _, e := range entries {
+		if !e.Type().IsRegular() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		embeddable, err := hasPlaceholder(filepath.Join(dir, e.Name()), info)
+		if err != nil {
+			return nil, err
+		}
+		binaries = append(binaries, Binary{
+			Name:       e.Name(),
+			Size:       info.Size(),
+			Embeddable: embeddable,
+		})
+	}
+	sort.SliceStable(binaries, func(i, j int) bool {
+		return rank(binaries[i].Name) < rank(binaries[j].Name)
+	})
+	return binaries, nil
+}
+
+// hasPlaceholder reports whether the binary at file, described by info,
+// has the placeholder, reading it only if it changed since the last time.
+func hasPlaceholder(file string, info os.FileInfo) (bool, error) {
+	scans.Lock()
+	s, ok := scans.m[file]
+	scans.Unlock()
+	if ok && s.size == info.Size() && s.modTime.Equal(info.ModTime()) {
+		return s.embeddable, nil
+	}
+
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return false, err
+	}
+	s = scan{size: info.Size(), modTime: info.ModTime(), embeddable: bytes.Contains(contents, Placeholder())}
+	scans.Lock()
+	scans.m[file] = s
+	scans.Unlock()
+	return s.embeddable, nil
+}
+
+func rank(name string) int {
+	for i, b := range Binaries {
+		if b == name {
+			return i
+		}
+	}
+	return len(Binaries)
+}
+
+// Read returns the contents of a binary of the iPXE dir. Only the regular
+// files right in the directory can be read.
+func Read(dir, name string) ([]byte, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return nil, os.ErrNotExist
+	}
+	file := filepath.Join(dir, name)
+	info, err := os.Lstat(file)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, os.ErrNotExist
+	}
+	return os.ReadFile(file)
+}
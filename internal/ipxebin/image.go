@@ -0,0 +1,486 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipxebin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// ISOName and USBName are the names the boot images are served as.
+const (
+	ISOName = "shoelaces.iso"
+	USBName = "shoelaces.img"
+)
+
+// AutoexecName is the script iPXE runs from the filesystem it was loaded
+// from, when it has no embedded script.
+const AutoexecName = "autoexec.ipxe"
+
+const (
+	sectorSize    = 512
+	isoSectorSize = 2048
+	rootEntries   = 512
+	dirEntrySize  = 32
+
+	// FAT16 needs at least 4085 clusters, and at most 65524.
+	minClusters = 4085
+	maxClusters = 65524
+
+	// partitionStart is the first sector of the USB image partition.
+	partitionStart = 2048
+)
+
+// efiBootNames are the removable media boot paths of UEFI, by the machine
+// type of the PE header.
+var efiBootNames = map[uint16]string{
+	0x014c: "BOOTIA32.EFI",
+	0x01c2: "BOOTARM.EFI",
+	0x8664: "BOOTX64.EFI",
+	0xaa64: "BOOTAA64.EFI",
+	0x5064: "BOOTRISCV64.EFI",
+}
+
+// EFIBootName returns the name UEFI firmware boots removable media from for
+// the architecture of an EFI binary.
+func EFIBootName(efi []byte) (string, error) {
+	if len(efi) < 0x40 || string(efi[:2]) != "MZ" {
+		return "", errors.New("not an EFI binary")
+	}
+	pe := int(binary.LittleEndian.Uint32(efi[0x3c:]))
+	if pe < 0 || pe+6 > len(efi) || string(efi[pe:pe+4]) != "PE\x00\x00" {
+		return "", errors.New("not an EFI binary")
+	}
+	machine := binary.LittleEndian.Uint16(efi[pe+4:])
+	name, ok := efiBootNames[machine]
+	if !ok {
+		return "", fmt.Errorf("unsupported EFI machine type %#04x", machine)
+	}
+	return name, nil
+}
+
+// USBImage returns a disk image, to be written to a USB drive, booting efi
+// on UEFI machines. It has a single EFI system partition with the binary,
+// and the script as autoexec.ipxe.
+func USBImage(efi []byte, script string) ([]byte, error) {
+	fat, err := FATImage(efi, script, partitionStart)
+	if err != nil {
+		return nil, err
+	}
+	img := make([]byte, partitionStart*sectorSize+len(fat))
+	copy(img[partitionStart*sectorSize:], fat)
+
+	// A protective MBR would require a GPT, the MBR partition table is
+	// enough for UEFI firmware.
+	entry := img[446:462]
+	entry[0] = 0x00
+	copy(entry[1:4], []byte{0xfe, 0xff, 0xff}) // CHS not used
+	entry[4] = 0xef                            // EFI system partition
+	copy(entry[5:8], []byte{0xfe, 0xff, 0xff})
+	binary.LittleEndian.PutUint32(entry[8:], partitionStart)
+	binary.LittleEndian.PutUint32(entry[12:], uint32(len(fat)/sectorSize))
+	img[510], img[511] = 0x55, 0xaa
+	return img, nil
+}
+
+// ISOImage returns a CD image booting efi on UEFI machines through El
+// Torito, with the FAT image of FATImage as boot image.
+func ISOImage(efi []byte, script string) ([]byte, error) {
+	fat, err := FATImage(efi, script, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	const (
+		pvdSector      = 16
+		bootSector     = 17
+		termSector     = 18
+		lPathSector    = 19
+		mPathSector    = 20
+		rootSector     = 21
+		catalogSector  = 22
+		fatImageSector = 23
+	)
+	fatSectors := (len(fat) + isoSectorSize - 1) / isoSectorSize
+	total := fatImageSector + fatSectors
+	iso := make([]byte, total*isoSectorSize)
+	sector := func(n int) []byte {
+		return iso[n*isoSectorSize : (n+1)*isoSectorSize]
+	}
+
+	root := isoDirRecord(rootSector, isoSectorSize, true, "\x00")
+
+	pvd := sector(pvdSector)
+	pvd[0] = 1
+	copy(pvd[1:], "CD001")
+	pvd[6] = 1
+	copy(pvd[8:40], padRight("", 32))
+	copy(pvd[40:72], padRight("SHOELACES", 32))
+	putBoth32(pvd[80:], uint32(total))
+	putBoth16(pvd[120:], 1)
+	putBoth16(pvd[124:], 1)
+	putBoth16(pvd[128:], isoSectorSize)
+	putBoth32(pvd[132:], 10)
+	binary.LittleEndian.PutUint32(pvd[140:], lPathSector)
+	binary.BigEndian.PutUint32(pvd[148:], mPathSector)
+	copy(pvd[156:190], root)
+	copy(pvd[190:813], padRight("", 623))
+	copy(pvd[574:702], padRight("SHOELACES", 128))
+	for _, off := range []int{813, 830, 847, 864} {
+		copy(pvd[off:off+16], strings.Repeat("0", 16))
+	}
+	pvd[881] = 1
+
+	boot := sector(bootSector)
+	copy(boot[1:], "CD001")
+	boot[6] = 1
+	copy(boot[7:], "EL TORITO SPECIFICATION")
+	binary.LittleEndian.PutUint32(boot[71:], catalogSector)
+
+	term := sector(termSector)
+	term[0] = 255
+	copy(term[1:], "CD001")
+	term[6] = 1
+
+	lPath := sector(lPathSector)
+	lPath[0] = 1
+	binary.LittleEndian.PutUint32(lPath[2:], rootSector)
+	binary.LittleEndian.PutUint16(lPath[6:], 1)
+	mPath := sector(mPathSector)
+	mPath[0] = 1
+	binary.BigEndian.PutUint32(mPath[2:], rootSector)
+	binary.BigEndian.PutUint16(mPath[6:], 1)
+
+	var dir bytes.Buffer
+	dir.Write(isoDirRecord(rootSector, isoSectorSize, true, "\x00"))
+	dir.Write(isoDirRecord(rootSector, isoSectorSize, true, "\x01"))
+	dir.Write(isoDirRecord(catalogSector, isoSectorSize, false, "BOOT.CAT;1"))
+	dir.Write(isoDirRecord(fatImageSector, uint32(len(fat)), false, "EFIBOOT.IMG;1"))
+	copy(sector(rootSector), dir.Bytes())
+
+	// The validation entry, for the EFI platform, and the default entry
+	// loading the FAT image without emulation.
+	catalog := sector(catalogSector)
+	catalog[0] = 1
+	catalog[1] = 0xef
+	copy(catalog[4:28], "SHOELACES")
+	catalog[30], catalog[31] = 0x55, 0xaa
+	var sum uint16
+	for i := 0; i < 32; i += 2 {
+		sum += binary.LittleEndian.Uint16(catalog[i:])
+	}
+	binary.LittleEndian.PutUint16(catalog[28:], -sum)
+	entry := catalog[32:64]
+	entry[0] = 0x88
+	count := len(fat) / sectorSize
+	if count > 0xffff {
+		count = 0xffff
+	}
+	binary.LittleEndian.PutUint16(entry[6:], uint16(count))
+	binary.LittleEndian.PutUint32(entry[8:], fatImageSector)
+
+	copy(iso[fatImageSector*isoSectorSize:], fat)
+	return iso, nil
+}
+
+func isoDirRecord(extent, size uint32, dir bool, name string) []byte {
+	length := 33 + len(name)
+	if length%2 != 0 {
+		length++
+	}
+	r := make([]byte, length)
+	r[0] = byte(length)
+	putBoth32(r[2:], extent)
+	putBoth32(r[10:], size)
+	r[18], r[19], r[20] = 80, 1, 1 // 1980-01-01
+	if dir {
+		r[25] = 0x02
+	}
+	putBoth16(r[28:], 1)
+	r[32] = byte(len(name))
+	copy(r[33:], name)
+	return r
+}
+
+func putBoth16(b []byte, v uint16) {
+	binary.LittleEndian.PutUint16(b, v)
+	binary.BigEndian.PutUint16(b[2:], v)
+}
+
+func putBoth32(b []byte, v uint32) {
+	binary.LittleEndian.PutUint32(b, v)
+	binary.BigEndian.PutUint32(b[4:], v)
+}
+
+func padRight(s string, n int) string {
+	return s + strings.Repeat(" ", n-len(s))
+}
+
+// fatFile is a file or directory of a FAT image.
+type fatFile struct {
+	name     string
+	contents []byte
+	children []*fatFile // Not nil for directories
+	cluster  int
+}
+
+func (f *fatFile) isDir() bool {
+	return f.children != nil
+}
+
+// FATImage returns a FAT16 filesystem with efi as the removable media boot
+// binary of its architecture, and script, if any, as autoexec.ipxe. The
+// script is embedded as well if efi has the placeholder. hidden is the
+// number of sectors before the filesystem in its disk.
+func FATImage(efi []byte, script string, hidden int) ([]byte, error) {
+	bootName, err := EFIBootName(efi)
+	if err != nil {
+		return nil, err
+	}
+	if embedded, err := Embed(efi, script); err == nil && script != "" {
+		efi = embedded
+	}
+	bootDir := &fatFile{name: "BOOT", children: []*fatFile{{name: bootName, contents: efi}}}
+	root := []*fatFile{{name: "EFI", children: []*fatFile{bootDir}}}
+	if script != "" {
+		root = append(root, &fatFile{name: AutoexecName, contents: []byte(script)})
+	}
+
+	// Clusters are a sector, so directories fit in one as long as they
+	// have a few entries.
+	next := 2
+	var allocate func(files []*fatFile)
+	allocate = func(files []*fatFile) {
+		for _, f := range files {
+			switch {
+			case f.isDir():
+				f.cluster = next
+				next++
+				allocate(f.children)
+			case len(f.contents) > 0:
+				f.cluster = next
+				next += clustersOf(len(f.contents))
+			}
+		}
+	}
+	allocate(root)
+
+	clusters := next - 2
+	if clusters < minClusters {
+		clusters = minClusters
+	}
+	if clusters > maxClusters {
+		return nil, errors.New("EFI binary too big for the boot image")
+	}
+	fatSectors := ((clusters+2)*2 + sectorSize - 1) / sectorSize
+	rootSectors := rootEntries * dirEntrySize / sectorSize
+	dataStart := 1 + 2*fatSectors + rootSectors
+	total := dataStart + clusters
+
+	img := make([]byte, total*sectorSize)
+	writeBootSector(img[:sectorSize], total, fatSectors, hidden)
+
+	fat := make([]uint16, fatSectors*sectorSize/2)
+	fat[0], fat[1] = 0xfff8, 0xffff
+	clusterData := func(c int) []byte {
+		off := (dataStart + c - 2) * sectorSize
+		return img[off:]
+	}
+	var write func(files []*fatFile, parent int) error
+	write = func(files []*fatFile, parent int) error {
+		for _, f := range files {
+			n := 1
+			if f.isDir() {
+				var dir bytes.Buffer
+				dir.Write(shortEntry(".          ", 0x10, f.cluster, 0))
+				dir.Write(shortEntry("..         ", 0x10, parent, 0))
+				if err := writeEntries(&dir, f.children); err != nil {
+					return err
+				}
+				if dir.Len() > sectorSize {
+					return errors.New("too many files in a directory")
+				}
+				copy(clusterData(f.cluster), dir.Bytes())
+				if err := write(f.children, f.cluster); err != nil {
+					return err
+				}
+			} else {
+				n = clustersOf(len(f.contents))
+				copy(clusterData(f.cluster), f.contents)
+			}
+			for c := f.cluster; c < f.cluster+n-1; c++ {
+				fat[c] = uint16(c + 1)
+			}
+			if n > 0 {
+				fat[f.cluster+n-1] = 0xffff
+			}
+		}
+		return nil
+	}
+	if err := write(root, 0); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < 2; i++ {
+		off := (1 + i*fatSectors) * sectorSize
+		for j, v := range fat {
+			binary.LittleEndian.PutUint16(img[off+2*j:], v)
+		}
+	}
+	var rootDir bytes.Buffer
+	rootDir.Write(shortEntry("SHOELACES  ", 0x08, 0, 0))
+	if err := writeEntries(&rootDir, root); err != nil {
+		return nil, err
+	}
+	copy(img[(1+2*fatSectors)*sectorSize:dataStart*sectorSize], rootDir.Bytes())
+	return img, nil
+}
+
+func clustersOf(size int) int {
+	return (size + sectorSize - 1) / sectorSize
+}
+
+func writeBootSector(b []byte, total, fatSectors, hidden int) {
+	copy(b, []byte{0xeb, 0x3c, 0x90})
+	copy(b[3:11], "SHOELACE")
+	binary.LittleEndian.PutUint16(b[11:], sectorSize)
+	b[13] = 1 // Sectors per cluster
+	binary.LittleEndian.PutUint16(b[14:], 1)
+	b[16] = 2 // FATs
+	binary.LittleEndian.PutUint16(b[17:], rootEntries)
+	if total < 0x10000 {
+		binary.LittleEndian.PutUint16(b[19:], uint16(total))
+	} else {
+		binary.LittleEndian.PutUint32(b[32:], uint32(total))
+	}
+	b[21] = 0xf8
+	binary.LittleEndian.PutUint16(b[22:], uint16(fatSectors))
+	binary.LittleEndian.PutUint16(b[24:], 32)
+	binary.LittleEndian.PutUint16(b[26:], 64)
+	binary.LittleEndian.PutUint32(b[28:], uint32(hidden))
+	b[36] = 0x80
+	b[38] = 0x29
+	binary.LittleEndian.PutUint32(b[39:], 0x5e0e1ace)
+	copy(b[43:54], "SHOELACES  ")
+	copy(b[54:62], "FAT16   ")
+	b[510], b[511] = 0x55, 0xaa
+}
+
+// writeEntries writes the directory entries of files, with long name
+// entries for the names that don't fit in 8.3.
+func writeEntries(dir *bytes.Buffer, files []*fatFile) error {
+	for i, f := range files {
+		attr := byte(0x20)
+		size := len(f.contents)
+		if f.isDir() {
+			attr, size = 0x10, 0
+		}
+		short, ok := shortName(f.name)
+		if !ok {
+			short = aliasName(f.name, i+1)
+			if err := writeLongName(dir, f.name, short); err != nil {
+				return err
+			}
+		}
+		dir.Write(shortEntry(short, attr, f.cluster, size))
+	}
+	return nil
+}
+
+func shortEntry(name string, attr byte, cluster, size int) []byte {
+	e := make([]byte, dirEntrySize)
+	copy(e, name)
+	e[11] = attr
+	binary.LittleEndian.PutUint16(e[24:], 0x0021) // 1980-01-01
+	binary.LittleEndian.PutUint16(e[26:], uint16(cluster))
+	binary.LittleEndian.PutUint32(e[28:], uint32(size))
+	return e
+}
+
+// shortName returns the 8.3 directory entry name of name, if it has one.
+func shortName(name string) (string, bool) {
+	base, ext, _ := strings.Cut(name, ".")
+	if base == "" || len(base) > 8 || len(ext) > 3 || strings.Contains(ext, ".") ||
+		name != strings.ToUpper(name) {
+		return "", false
+	}
+	return padRight(base, 8) + padRight(ext, 3), true
+}
+
+// aliasName returns the 8.3 alias of a long name, unique in its directory
+// thanks to n.
+func aliasName(name string, n int) string {
+	base, ext := name, ""
+	if i := strings.LastIndex(name, "."); i > 0 {
+		base, ext = name[:i], name[i+1:]
+	}
+	clean := func(s string, max int) string {
+		var b strings.Builder
+		for _, r := range strings.ToUpper(s) {
+			if b.Len() == max {
+				break
+			}
+			if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+				b.WriteRune(r)
+			}
+		}
+		return b.String()
+	}
+	tail := fmt.Sprintf("~%d", n)
+	return padRight(clean(base, 8-len(tail))+tail, 8) + padRight(clean(ext, 3), 3)
+}
+
+func writeLongName(dir *bytes.Buffer, name, short string) error {
+	chars := utf16.Encode([]rune(name))
+	if len(chars) > 255 {
+		return fmt.Errorf("name %q too long", name)
+	}
+	var sum byte
+	for i := 0; i < 11; i++ {
+		sum = (sum&1)<<7 + sum>>1 + short[i]
+	}
+
+	count := (len(chars) + 12) / 13
+	padded := make([]uint16, count*13)
+	for i := range padded {
+		switch {
+		case i < len(chars):
+			padded[i] = chars[i]
+		case i == len(chars):
+			padded[i] = 0
+		default:
+			padded[i] = 0xffff
+		}
+	}
+	offsets := []int{1, 3, 5, 7, 9, 14, 16, 18, 20, 22, 24, 28, 30}
+	for n := count; n >= 1; n-- {
+		e := make([]byte, dirEntrySize)
+		e[0] = byte(n)
+		if n == count {
+			e[0] |= 0x40
+		}
+		e[11] = 0x0f
+		e[13] = sum
+		for i, off := range offsets {
+			binary.LittleEndian.PutUint16(e[off:], padded[(n-1)*13+i])
+		}
+		dir.Write(e)
+	}
+	return nil
+}
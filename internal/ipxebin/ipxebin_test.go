@@ -0,0 +1,258 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipxebin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// testEFI returns a fake x86_64 EFI binary with the placeholder.
+func testEFI() []byte {
+	efi := make([]byte, 0x40)
+	copy(efi, "MZ")
+	binary.LittleEndian.PutUint32(efi[0x3c:], 0x40)
+	efi = append(efi, "PE\x00\x00\x64\x86"...)
+	efi = append(efi, bytes.Repeat([]byte("code"), 1000)...)
+	efi = append(efi, Placeholder()...)
+	return append(efi, bytes.Repeat([]byte("data"), 1000)...)
+}
+
+func TestEmbed(t *testing.T) {
+	if len(Placeholder()) != PlaceholderSize {
+		t.Errorf("Expected: %d bytes placeholder\nGot: %d", PlaceholderSize, len(Placeholder()))
+	}
+
+	efi := testEFI()
+	script := StartScript("[2001:db8::1]:8081")
+	out, err := Embed(efi, script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != len(efi) || !bytes.Contains(out, []byte(script+"\n\n")) || bytes.Contains(out, Placeholder()) {
+		t.Error("Expected: the script in place of the placeholder")
+	}
+	if !bytes.Contains(efi, Placeholder()) {
+		t.Error("Expected: the original binary unchanged")
+	}
+
+	if _, err := Embed(out, script); err == nil {
+		t.Error("Expected: error for a binary without placeholder\nGot: nil")
+	}
+	if _, err := Embed(efi, strings.Repeat("#", PlaceholderSize+1)); err == nil {
+		t.Error("Expected: error for a long script\nGot: nil")
+	}
+}
+
+func TestList(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"snponly.efi":   []byte("snp"),
+		"undionly.kpxe": []byte("undi"),
+		"custom.efi":    testEFI(),
+		".hidden":       []byte("hidden"),
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), contents, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+
+	binaries, err := List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, b := range binaries {
+		names = append(names, b.Name)
+	}
+	if strings.Join(names, " ") != "undionly.kpxe snponly.efi custom.efi" {
+		t.Errorf("Expected: undionly.kpxe snponly.efi custom.efi\nGot: %v", names)
+	}
+	if binaries[0].Size != 4 || binaries[0].Embeddable || !binaries[2].Embeddable {
+		t.Errorf("Expected: sizes and placeholders\nGot: %+v", binaries)
+	}
+
+	// Changed binaries are read again.
+	if err := os.WriteFile(filepath.Join(dir, "undionly.kpxe"), append([]byte("undi"), Placeholder()...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if binaries, err = List(dir); err != nil || !binaries[0].Embeddable {
+		t.Errorf("Expected: undionly.kpxe with the placeholder\nGot: %+v %v", binaries, err)
+	}
+
+	if _, err := Read(dir, "undionly.kpxe"); err != nil {
+		t.Errorf("Expected: no error\nGot: %v", err)
+	}
+	for _, name := range []string{"", ".hidden", "sub", "../" + filepath.Base(dir) + "/snponly.efi", "missing.efi"} {
+		if _, err := Read(dir, name); err == nil {
+			t.Errorf("Expected: error reading %q\nGot: nil", name)
+		}
+	}
+}
+
+// readFATFile returns the contents of a file of a FAT16 image, following
+// its path from the root directory.
+func readFATFile(t *testing.T, img []byte, path ...string) []byte {
+	bytesPerSector := int(binary.LittleEndian.Uint16(img[11:]))
+	fatStart := int(binary.LittleEndian.Uint16(img[14:])) * bytesPerSector
+	fatSize := int(binary.LittleEndian.Uint16(img[22:])) * bytesPerSector
+	rootStart := fatStart + int(img[16])*fatSize
+	dataStart := rootStart + int(binary.LittleEndian.Uint16(img[17:]))*dirEntrySize
+
+	chain := func(cluster, size int) []byte {
+		var out []byte
+		for cluster >= 2 && cluster < 0xfff8 {
+			off := dataStart + (cluster-2)*bytesPerSector
+			out = append(out, img[off:off+bytesPerSector]...)
+			cluster = int(binary.LittleEndian.Uint16(img[fatStart+2*cluster:]))
+		}
+		if size >= 0 {
+			out = out[:size]
+		}
+		return out
+	}
+
+	dir := img[rootStart:dataStart]
+	var long []uint16
+	for i, name := range path {
+		found := false
+		for off := 0; off+dirEntrySize <= len(dir) && dir[off] != 0; off += dirEntrySize {
+			e := dir[off : off+dirEntrySize]
+			if e[11] == 0x0f {
+				var part []uint16
+				for _, o := range []int{1, 3, 5, 7, 9, 14, 16, 18, 20, 22, 24, 28, 30} {
+					if c := binary.LittleEndian.Uint16(e[o:]); c != 0 && c != 0xffff {
+						part = append(part, c)
+					}
+				}
+				long = append(part, long...)
+				continue
+			}
+			entryName := strings.TrimSpace(string(e[:8]))
+			if ext := strings.TrimSpace(string(e[8:11])); ext != "" {
+				entryName += "." + ext
+			}
+			if len(long) > 0 {
+				entryName = string(utf16.Decode(long))
+			}
+			long = nil
+			if entryName != name {
+				continue
+			}
+			cluster := int(binary.LittleEndian.Uint16(e[26:]))
+			if i == len(path)-1 {
+				return chain(cluster, int(binary.LittleEndian.Uint32(e[28:])))
+			}
+			dir = chain(cluster, -1)
+			found = true
+			break
+		}
+		if !found {
+			t.Fatalf("Expected: %s in the FAT image\nGot: nothing", strings.Join(path[:i+1], "/"))
+		}
+	}
+	return nil
+}
+
+func TestFATImage(t *testing.T) {
+	efi := testEFI()
+	script := StartScript("localhost:8081")
+	img, err := FATImage(efi, script, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(img[54:62]) != "FAT16   " || img[510] != 0x55 || img[511] != 0xaa {
+		t.Error("Expected: a FAT16 boot sector")
+	}
+	embedded, _ := Embed(efi, script)
+	if got := readFATFile(t, img, "EFI", "BOOT", "BOOTX64.EFI"); !bytes.Equal(got, embedded) {
+		t.Errorf("Expected: the EFI binary with the script embedded\nGot: %d bytes", len(got))
+	}
+	if got := readFATFile(t, img, AutoexecName); string(got) != script {
+		t.Errorf("Expected: %q\nGot: %q", script, got)
+	}
+
+	// RISC-V names need a long name entry.
+	binary.LittleEndian.PutUint16(efi[0x44:], 0x5064)
+	img, err = FATImage(efi, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readFATFile(t, img, "EFI", "BOOT", "BOOTRISCV64.EFI"); !bytes.Equal(got, efi) {
+		t.Errorf("Expected: the EFI binary\nGot: %d bytes", len(got))
+	}
+
+	if _, err := FATImage([]byte("not an EFI binary"), "", 0); err == nil {
+		t.Error("Expected: error for an invalid binary\nGot: nil")
+	}
+}
+
+func TestISOImage(t *testing.T) {
+	efi := testEFI()
+	iso, err := ISOImage(efi, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(iso[16*isoSectorSize+1:16*isoSectorSize+6]) != "CD001" {
+		t.Error("Expected: a primary volume descriptor")
+	}
+	boot := iso[17*isoSectorSize:]
+	if !strings.HasPrefix(string(boot[7:]), "EL TORITO SPECIFICATION") {
+		t.Error("Expected: an El Torito boot record")
+	}
+	catalog := iso[int(binary.LittleEndian.Uint32(boot[71:]))*isoSectorSize:]
+	var sum uint16
+	for i := 0; i < 32; i += 2 {
+		sum += binary.LittleEndian.Uint16(catalog[i:])
+	}
+	if catalog[0] != 1 || catalog[1] != 0xef || sum != 0 || catalog[32] != 0x88 {
+		t.Errorf("Expected: a valid EFI boot catalog\nGot: %x", catalog[:64])
+	}
+	img := iso[int(binary.LittleEndian.Uint32(catalog[40:]))*isoSectorSize:]
+	if got := readFATFile(t, img, "EFI", "BOOT", "BOOTX64.EFI"); !bytes.Equal(got, efi) {
+		t.Errorf("Expected: the EFI binary in the boot image\nGot: %d bytes", len(got))
+	}
+	if len(iso)%isoSectorSize != 0 {
+		t.Errorf("Expected: whole sectors\nGot: %d bytes", len(iso))
+	}
+}
+
+func TestUSBImage(t *testing.T) {
+	efi := testEFI()
+	img, err := USBImage(efi, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := img[446:462]
+	start := int(binary.LittleEndian.Uint32(entry[8:]))
+	size := int(binary.LittleEndian.Uint32(entry[12:]))
+	if entry[4] != 0xef || img[510] != 0x55 || (start+size)*sectorSize != len(img) {
+		t.Errorf("Expected: a single EFI system partition\nGot: %x", entry)
+	}
+	part := img[start*sectorSize:]
+	if got := binary.LittleEndian.Uint32(part[28:]); int(got) != start {
+		t.Errorf("Expected: %d hidden sectors\nGot: %d", start, got)
+	}
+	if got := readFATFile(t, part, "EFI", "BOOT", "BOOTX64.EFI"); !bytes.Equal(got, efi) {
+		t.Errorf("Expected: the EFI binary in the partition\nGot: %d bytes", len(got))
+	}
+}
@@ -15,27 +15,37 @@
 package log
 
 import (
+	"fmt"
 	"io"
 	"log/slog"
+	"net/url"
+	"reflect"
+	"sync/atomic"
+
+	"github.com/thousandeyes/shoelaces/internal/redact"
 )
 
 // Logger wraps slog with the level switch Shoelaces uses for debug mode.
 type Logger struct {
 	*slog.Logger
-	level *slog.LevelVar
+	level    *slog.LevelVar
+	redactor *atomic.Pointer[redact.Redactor]
 }
 
 // MakeLogger receives a io.Writer and return a Logger struct.
 func MakeLogger(w io.Writer) Logger {
 	level := &slog.LevelVar{}
 	level.Set(slog.LevelInfo)
+	redactor := &atomic.Pointer[redact.Redactor]{}
 
 	return Logger{
 		Logger: slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{
-			AddSource: true,
-			Level:     level,
+			AddSource:   true,
+			Level:       level,
+			ReplaceAttr: redactAttr(redactor),
 		})),
-		level: level,
+		level:    level,
+		redactor: redactor,
 	}
 }
 
@@ -44,3 +54,45 @@ func AllowDebug(l Logger) Logger {
 	l.level.Set(slog.LevelDebug)
 	return l
 }
+
+// SetRedactor receives a Logger and masks with r the string, stringer and
+// parameter values of its records from now on.
+func SetRedactor(l Logger, r *redact.Redactor) Logger {
+	l.redactor.Store(r)
+	return l
+}
+
+// Redactor returns the redactor of the Logger, nil if it has none.
+func (l Logger) Redactor() *redact.Redactor {
+	if l.redactor == nil {
+		return nil
+	}
+	return l.redactor.Load()
+}
+
+func redactAttr(redactor *atomic.Pointer[redact.Redactor]) func([]string, slog.Attr) slog.Attr {
+	return func(groups []string, a slog.Attr) slog.Attr {
+		r := redactor.Load()
+		if r == nil {
+			return a
+		}
+		switch a.Value.Kind() {
+		case slog.KindString:
+			a.Value = slog.StringValue(r.String(a.Value.String()))
+		case slog.KindAny:
+			switch v := a.Value.Any().(type) {
+			case map[string]interface{}:
+				a.Value = slog.AnyValue(r.Params(v))
+			case *url.URL:
+				if v != nil {
+					a.Value = slog.StringValue(r.URL(v))
+				}
+			case fmt.Stringer:
+				if rv := reflect.ValueOf(v); rv.Kind() != reflect.Pointer || !rv.IsNil() {
+					a.Value = slog.StringValue(r.String(v.String()))
+				}
+			}
+		}
+		return a
+	}
+}
@@ -18,6 +18,8 @@ import (
 	"net"
 	"regexp"
 	"strings"
+
+	"github.com/thousandeyes/shoelaces/internal/redact"
 )
 
 // Script holds information related to a booting script.
@@ -41,6 +43,15 @@ type HostnameMap struct {
 	Script   *Script
 }
 
+// Redacted returns a copy of the script with the sensitive parameters and
+// secret values masked by r, to be logged or shown in the web frontend.
+func (s *Script) Redacted(r *redact.Redactor) *Script {
+	if s == nil {
+		return nil
+	}
+	return &Script{Name: s.Name, Environment: s.Environment, Params: r.Params(s.Params)}
+}
+
 // FindScriptForHostname receives a HostnameMap and a string (that can be a
 // regular expression), and tries to find a match in that map. If it finds
 // a match, it returns the associated script.
@@ -98,3 +98,21 @@ func TestScriptForNetwork(t *testing.T) {
 		t.Error("IP shouildn't have matched the network map")
 	}
 }
+
+func TestScriptForIPv6Network(t *testing.T) {
+	_, network, _ := net.ParseCIDR("2001:db8:12::/48")
+	maps := []NetworkMap{mockNetworkMap1, {Network: network, Script: &mockScript2}}
+
+	script, success := FindScriptForNetwork(maps, "2001:db8:12:3::5")
+	if !(success && script.Name == "mock_script2") {
+		t.Error("IPv6 address should have matched the IPv6 network map")
+	}
+	script, success = FindScriptForNetwork(maps, "::ffff:10.0.0.1")
+	if !(success && script.Name == "mock_script1") {
+		t.Error("IPv4-mapped address should have matched the IPv4 network map")
+	}
+	script, success = FindScriptForNetwork(maps, "2001:db8:13::5")
+	if !(script == nil && !success) {
+		t.Error("IPv6 address shouldn't have matched the network map")
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package overlay
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrEscape is returned when a symlink leads out of the root of a Dir.
+var ErrEscape = fmt.Errorf("symlink escapes from the root: %w", fs.ErrPermission)
+
+// dirFS is a directory tree whose symlinks must stay inside it.
+type dirFS struct {
+	root string
+}
+
+// Dir returns the file system of the tree rooted at dir. Unlike os.DirFS,
+// symlinks are only followed if they lead to files inside the tree.
+func Dir(dir string) fs.FS {
+	return dirFS{root: dir}
+}
+
+// resolve returns the path of name with the symlinks resolved, checking
+// it's inside the root.
+func (d dirFS) resolve(op, name string) (string, error) {
+	if !fs.ValidPath(name) || strings.Contains(name, `\`) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	root, err := filepath.EvalSymlinks(d.root)
+	if err != nil {
+		return "", &fs.PathError{Op: op, Path: name, Err: unwrap(err)}
+	}
+	p, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(name)))
+	if err != nil {
+		return "", &fs.PathError{Op: op, Path: name, Err: unwrap(err)}
+	}
+	if p != root && !strings.HasPrefix(p, root+string(filepath.Separator)) {
+		return "", &fs.PathError{Op: op, Path: name, Err: ErrEscape}
+	}
+	return p, nil
+}
+
+// unwrap returns the underlying error of a path error, so errors don't
+// show the real paths.
+func unwrap(err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err
+	}
+	return err
+}
+
+func (d dirFS) Open(name string) (fs.File, error) {
+	p, err := d.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+func (d dirFS) Stat(name string) (fs.FileInfo, error) {
+	p, err := d.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(p)
+}
@@ -0,0 +1,226 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package overlay
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+const indexPage = "index.html"
+
+// FileServer serves the files of a stack of file systems. A file is served
+// from the first layer having it, and directories list the entries of
+// every layer allowing it, unless an upper layer has a file with the same
+// name.
+type FileServer struct {
+	Layers []Layer // The first layer has the highest precedence
+}
+
+// Layer is a file system of a FileServer.
+type Layer struct {
+	FS      fs.FS
+	Listing bool // List its entries in the directories without an index.html
+}
+
+// stat returns the info of name in the first layer having it, and the
+// index of that layer.
+func (s *FileServer) stat(name string) (fs.FileInfo, int, error) {
+	for i, layer := range s.Layers {
+		info, err := fs.Stat(layer.FS, name)
+		if notExist(err) {
+			continue
+		}
+		return info, i, err
+	}
+	return nil, -1, fs.ErrNotExist
+}
+
+// notExist tells if err means the file doesn't exist, including when one
+// of its parents is a file.
+func notExist(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR)
+}
+
+func (s *FileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	upath := r.URL.Path
+	if !strings.HasPrefix(upath, "/") {
+		upath = "/" + upath
+	}
+	if containsDotDot(upath) {
+		http.Error(w, "Invalid URL path", http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimPrefix(path.Clean(upath), "/")
+	if name == "" {
+		name = "."
+	}
+
+	info, layer, err := s.stat(name)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	if info.IsDir() {
+		if !strings.HasSuffix(upath, "/") {
+			localRedirect(w, r, path.Base(upath)+"/")
+			return
+		}
+		index := path.Join(name, indexPage)
+		if info, layer, err := s.stat(index); err == nil && info.Mode().IsRegular() {
+			s.serveFile(w, r, layer, index, info)
+			return
+		}
+		if !s.serveListing(w, layer, name) {
+			http.NotFound(w, r)
+		}
+		return
+	}
+
+	if !info.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	if strings.HasSuffix(upath, "/") {
+		localRedirect(w, r, "../"+path.Base(upath))
+		return
+	}
+	s.serveFile(w, r, layer, name, info)
+}
+
+// serveFile serves a regular file, with an ETag made of its modification
+// time and size, and answers Range and conditional requests.
+func (s *FileServer) serveFile(w http.ResponseWriter, r *http.Request, layer int, name string, info fs.FileInfo) {
+	f, err := s.Layers[layer].FS.Open(name)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	defer f.Close()
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		http.Error(w, "File not seekable", http.StatusInternalServerError)
+		return
+	}
+
+	if w.Header().Get("ETag") == "" {
+		w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), content)
+}
+
+// serveListing lists the entries of a directory in every layer from the
+// first one having it. Entries of the layers not allowing it are left out,
+// and so are the ones they shadow. It returns false, without writing
+// anything, if no layer having the directory allows listing it.
+func (s *FileServer) serveListing(w http.ResponseWriter, first int, name string) bool {
+	entries := make(map[string]bool) // Names, and if they're directories
+	hidden := make(map[string]bool)
+	listed := false
+	for _, layer := range s.Layers[first:] {
+		dirEntries, err := fs.ReadDir(layer.FS, name)
+		if err != nil {
+			// The layer has no directory with this name.
+			continue
+		}
+		listed = listed || layer.Listing
+		for _, e := range dirEntries {
+			if _, ok := entries[e.Name()]; ok || hidden[e.Name()] {
+				continue
+			}
+			if !layer.Listing {
+				hidden[e.Name()] = true
+				continue
+			}
+			isDir := e.IsDir()
+			if e.Type()&fs.ModeSymlink != 0 {
+				// Left out if broken or leading out of the layer.
+				info, err := fs.Stat(layer.FS, path.Join(name, e.Name()))
+				if err != nil {
+					continue
+				}
+				isDir = info.IsDir()
+			}
+			entries[e.Name()] = isDir
+		}
+	}
+
+	if !listed {
+		return false
+	}
+
+	names := make([]string, 0, len(entries))
+	for n := range entries {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!doctype html>\n")
+	fmt.Fprintf(w, "<meta name=\"viewport\" content=\"width=device-width\">\n")
+	fmt.Fprintf(w, "<pre>\n")
+	for _, n := range names {
+		if entries[n] {
+			n += "/"
+		}
+		// Names with a colon get a ./ prefix, not to look like a scheme.
+		link := url.URL{Path: n}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", html.EscapeString(link.String()), html.EscapeString(n))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+	return true
+}
+
+func serveError(w http.ResponseWriter, err error) {
+	switch {
+	case notExist(err):
+		http.Error(w, "404 page not found", http.StatusNotFound)
+	case errors.Is(err, fs.ErrPermission):
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+	case errors.Is(err, fs.ErrInvalid):
+		http.Error(w, "Invalid URL path", http.StatusBadRequest)
+	default:
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// localRedirect redirects to a path relative to the request, keeping its
+// query string.
+func localRedirect(w http.ResponseWriter, r *http.Request, newPath string) {
+	if q := r.URL.RawQuery; q != "" {
+		newPath += "?" + q
+	}
+	w.Header().Set("Location", newPath)
+	w.WriteHeader(http.StatusMovedPermanently)
+}
+
+func containsDotDot(p string) bool {
+	for _, segment := range strings.FieldsFunc(p, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if segment == ".." {
+			return true
+		}
+	}
+	return false
+}
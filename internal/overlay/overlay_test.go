@@ -0,0 +1,314 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package overlay
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var modTime = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func file(contents string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(contents), ModTime: modTime}
+}
+
+func dir() *fstest.MapFile {
+	return &fstest.MapFile{Mode: fs.ModeDir | 0755, ModTime: modTime}
+}
+
+func testServer(listing bool) *FileServer {
+	upper := fstest.MapFS{
+		"a.txt":       file("upper a"),
+		"dir/x.txt":   file("upper x"),
+		"shadow/y":    file("upper y"),
+		"index/a":     file("a"),
+		"index.txt/b": file("b"),
+	}
+	middle := fstest.MapFS{
+		"b.txt":            file("middle b"),
+		"shadow":           file("shadowed by a directory"),
+		"index/index.html": file("<p>index</p>"),
+	}
+	lower := fstest.MapFS{
+		"a.txt":     file("lower a"),
+		"c.txt":     file("lower c.txt"),
+		"dir/x.txt": file("lower x"),
+		"dir/z.txt": file("lower z"),
+		"shadow/w":  file("lower w"),
+		"empty":     dir(),
+	}
+	return &FileServer{Layers: []Layer{{FS: upper, Listing: listing}, {FS: middle, Listing: listing}, {FS: lower, Listing: listing}}}
+}
+
+func get(h http.Handler, target string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.URL.Path = target
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLayers(t *testing.T) {
+	s := testServer(true)
+	for p, expected := range map[string]string{
+		"/a.txt":       "upper a",
+		"/b.txt":       "middle b",
+		"/c.txt":       "lower c.txt",
+		"/dir/x.txt":   "upper x",
+		"/dir/z.txt":   "lower z",
+		"/shadow/y":    "upper y",
+		"/shadow/w":    "lower w",
+		"/index/":      "<p>index</p>",
+		"/index.txt/b": "b",
+	} {
+		rec := get(s, p)
+		if rec.Code != http.StatusOK || rec.Body.String() != expected {
+			t.Errorf("Expected: 200 %s for %s\nGot: %d %s", expected, p, rec.Code, rec.Body)
+		}
+	}
+	for _, p := range []string{"/missing", "/dir/missing", "/a.txt/x"} {
+		if rec := get(s, p); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected: 404 for %s\nGot: %d", p, rec.Code)
+		}
+	}
+}
+
+func TestServeFile(t *testing.T) {
+	s := testServer(true)
+	rec := get(s, "/a.txt")
+	etag := rec.Header().Get("ETag")
+	if etag == "" || rec.Header().Get("Last-Modified") != modTime.Format(http.TimeFormat) {
+		t.Errorf("Expected: ETag and Last-Modified headers\nGot: %v", rec.Header())
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Expected: text/plain\nGot: %s", ct)
+	}
+	if rec := get(s, "/c.txt"); rec.Header().Get("ETag") == etag {
+		t.Errorf("Expected: different ETags for different files\nGot: %s", etag)
+	}
+
+	if rec := get(s, "/a.txt", "If-None-Match", etag); rec.Code != http.StatusNotModified {
+		t.Errorf("Expected: 304 for a matching ETag\nGot: %d", rec.Code)
+	}
+	if rec := get(s, "/a.txt", "If-None-Match", `"other"`); rec.Code != http.StatusOK {
+		t.Errorf("Expected: 200 for another ETag\nGot: %d", rec.Code)
+	}
+	if rec := get(s, "/a.txt", "If-Modified-Since", modTime.Format(http.TimeFormat)); rec.Code != http.StatusNotModified {
+		t.Errorf("Expected: 304 if not modified\nGot: %d", rec.Code)
+	}
+	rec = get(s, "/a.txt", "Range", "bytes=2-4")
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "per" {
+		t.Errorf("Expected: 206 per\nGot: %d %s", rec.Code, rec.Body)
+	}
+	rec = get(s, "/a.txt", "Range", "bytes=2-4", "If-Range", `"other"`)
+	if rec.Code != http.StatusOK || rec.Body.String() != "upper a" {
+		t.Errorf("Expected: the whole file for another If-Range\nGot: %d %s", rec.Code, rec.Body)
+	}
+	if rec := get(s, "/a.txt", "Range", "bytes=100-"); rec.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("Expected: 416\nGot: %d", rec.Code)
+	}
+}
+
+func TestListing(t *testing.T) {
+	rec := get(testServer(true), "/")
+	expected := "<!doctype html>\n" +
+		"<meta name=\"viewport\" content=\"width=device-width\">\n" +
+		"<pre>\n" +
+		"<a href=\"a.txt\">a.txt</a>\n" +
+		"<a href=\"b.txt\">b.txt</a>\n" +
+		"<a href=\"c.txt\">c.txt</a>\n" +
+		"<a href=\"dir/\">dir/</a>\n" +
+		"<a href=\"empty/\">empty/</a>\n" +
+		"<a href=\"index/\">index/</a>\n" +
+		"<a href=\"index.txt/\">index.txt/</a>\n" +
+		"<a href=\"shadow/\">shadow/</a>\n" +
+		"</pre>\n"
+	if rec.Code != http.StatusOK || rec.Body.String() != expected {
+		t.Errorf("Expected: 200 %s\nGot: %d %s", expected, rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("Expected: text/html\nGot: %s", ct)
+	}
+
+	rec = get(testServer(true), "/shadow/")
+	if !strings.Contains(rec.Body.String(), `href="w"`) || !strings.Contains(rec.Body.String(), `href="y"`) {
+		t.Errorf("Expected: the files of the upper and lower directories\nGot: %s", rec.Body)
+	}
+
+	s := &FileServer{Layers: []Layer{{FS: fstest.MapFS{
+		`<b>&"x'.txt`: file("x"),
+		"a:b":         file("a"),
+		"%20.txt":     file("b"),
+	}, Listing: true}}}
+	body := get(s, "/").Body.String()
+	for _, e := range []string{
+		`<a href="%2520.txt">%20.txt</a>`,
+		`<a href="./a:b">a:b</a>`,
+		`<a href="%3Cb%3E&amp;%22x%27.txt">&lt;b&gt;&amp;&#34;x&#39;.txt</a>`,
+	} {
+		if !strings.Contains(body, e) {
+			t.Errorf("Expected: %s\nGot: %s", e, body)
+		}
+	}
+
+	s = testServer(false)
+	for _, p := range []string{"/", "/dir/", "/empty/"} {
+		if rec := get(s, p); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected: 404 for %s without listing\nGot: %d", p, rec.Code)
+		}
+	}
+	if rec := get(s, "/index/"); rec.Code != http.StatusOK || rec.Body.String() != "<p>index</p>" {
+		t.Errorf("Expected: the index page without listing\nGot: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestLayerListing(t *testing.T) {
+	s := testServer(true)
+	s.Layers[1].Listing = false
+	body := get(s, "/").Body.String()
+	if strings.Contains(body, "b.txt") || !strings.Contains(body, `href="a.txt"`) || !strings.Contains(body, `href="c.txt"`) {
+		t.Errorf("Expected: the files of the listed layers\nGot: %s", body)
+	}
+
+	// Entries of a layer not listed hide the ones they shadow.
+	s = testServer(true)
+	s.Layers[0].Listing = false
+	body = get(s, "/dir/").Body.String()
+	if strings.Contains(body, "x.txt") || !strings.Contains(body, `href="z.txt"`) {
+		t.Errorf("Expected: only z.txt\nGot: %s", body)
+	}
+	if rec := get(s, "/index.txt/"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected: 404 for a directory of a layer not listed\nGot: %d %s", rec.Code, rec.Body)
+	}
+	if rec := get(s, "/dir/x.txt"); rec.Code != http.StatusOK || rec.Body.String() != "upper x" {
+		t.Errorf("Expected: the files of layers not listed served\nGot: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestRedirects(t *testing.T) {
+	s := testServer(true)
+	for p, location := range map[string]string{
+		"/dir":      "dir/",
+		"/dir/sub/": "",
+		"/a.txt/":   "../a.txt",
+		"/shadow":   "shadow/",
+	} {
+		rec := get(s, p)
+		if location == "" {
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("Expected: 404 for %s\nGot: %d", p, rec.Code)
+			}
+			continue
+		}
+		if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != location {
+			t.Errorf("Expected: redirect to %s for %s\nGot: %d %s", location, p, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/dir?a=b", nil)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if l := rec.Header().Get("Location"); l != "dir/?a=b" {
+		t.Errorf("Expected: dir/?a=b\nGot: %s", l)
+	}
+}
+
+func TestTraversal(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "secret"), []byte("secret"), 0644)
+	os.MkdirAll(filepath.Join(root, "tree", "dir"), 0755)
+	os.WriteFile(filepath.Join(root, "tree", "dir", "file"), []byte("file"), 0644)
+	s := &FileServer{Layers: []Layer{{FS: Dir(filepath.Join(root, "tree")), Listing: true}}}
+
+	for _, p := range []string{"/../secret", "/dir/../../secret", "..", "/dir/..", `/dir\..\..\secret`} {
+		if rec := get(s, p); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected: 400 for %s\nGot: %d %s", p, rec.Code, rec.Body)
+		}
+	}
+	if rec := get(s, "/dir/file"); rec.Code != http.StatusOK || rec.Body.String() != "file" {
+		t.Errorf("Expected: 200 file\nGot: %d %s", rec.Code, rec.Body)
+	}
+	if _, err := Dir(filepath.Join(root, "tree")).Open("../secret"); err == nil {
+		t.Error("Expected an error opening ../secret")
+	}
+}
+
+func TestSymlinks(t *testing.T) {
+	root := t.TempDir()
+	outside := filepath.Join(root, "outside")
+	tree := filepath.Join(root, "tree")
+	os.MkdirAll(outside, 0755)
+	os.MkdirAll(filepath.Join(tree, "dir"), 0755)
+	os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0644)
+	os.WriteFile(filepath.Join(tree, "dir", "file"), []byte("file"), 0644)
+	for link, target := range map[string]string{
+		"inside":      "dir/file",
+		"inside-dir":  "dir",
+		"escape":      "../outside/secret",
+		"escape-abs":  filepath.Join(outside, "secret"),
+		"escape-dir":  "../outside",
+		"dir/escape":  "../../outside/secret",
+		"dangling":    "missing",
+		"dir/up-tree": "..",
+	} {
+		if err := os.Symlink(target, filepath.Join(tree, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The root itself may be a symlink.
+	if err := os.Symlink(tree, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	s := &FileServer{Layers: []Layer{{FS: Dir(filepath.Join(root, "link")), Listing: true}}}
+
+	for p, expected := range map[string]string{
+		"/inside":             "file",
+		"/inside-dir/file":    "file",
+		"/dir/up-tree/inside": "file",
+	} {
+		if rec := get(s, p); rec.Code != http.StatusOK || rec.Body.String() != expected {
+			t.Errorf("Expected: 200 %s for %s\nGot: %d %s", expected, p, rec.Code, rec.Body)
+		}
+	}
+	for _, p := range []string{"/escape", "/escape-abs", "/escape-dir/", "/escape-dir/secret", "/dir/escape"} {
+		if rec := get(s, p); rec.Code != http.StatusForbidden {
+			t.Errorf("Expected: 403 for %s\nGot: %d %s", p, rec.Code, rec.Body)
+		}
+	}
+	if rec := get(s, "/dangling"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected: 404 for a dangling symlink\nGot: %d", rec.Code)
+	}
+
+	body := get(s, "/").Body.String()
+	for _, e := range []string{"escape", "dangling"} {
+		if strings.Contains(body, e) {
+			t.Errorf("Expected: no %s in the listing\nGot: %s", e, body)
+		}
+	}
+	if !strings.Contains(body, `<a href="inside-dir/">inside-dir/</a>`) || !strings.Contains(body, `<a href="inside">inside</a>`) {
+		t.Errorf("Expected: the symlinks inside the tree in the listing\nGot: %s", body)
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package overrides
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/thousandeyes/shoelaces/internal/utils"
+)
+
+const (
+	// Default is the name of the environment served from the root of the
+	// data dir. Every inheritance chain ends with it.
+	Default = "default"
+	// ConfigFile is the optional file, inside an environment directory,
+	// that describes the environment.
+	ConfigFile = "env.yaml"
+	// ParamsFile is the optional file, inside the data dir or an
+	// environment directory, holding default template parameters.
+	ParamsFile = "params.yaml"
+)
+
+// Override holds the settings of an environment override.
+type Override struct {
+	Name          string                 `yaml:"-"`
+	Parent        string                 `yaml:"parent"`
+	BaseURL       string                 `yaml:"baseURL"`
+	StaticListing *bool                  `yaml:"staticListing"`
+	Params        map[string]interface{} `yaml:"-"`
+}
+
+// Tree holds the environment overrides and the inheritance relations
+// between them.
+type Tree struct {
+	overrides map[string]*Override
+	order     []string
+	defaults  map[string]interface{}
+}
+
+// Load reads every directory under dataDir/envDir as an environment
+// override, along with its optional env.yaml and params.yaml files. The
+// params.yaml file of the data dir holds the global default parameters. A
+// missing env dir results in a Tree without overrides.
+func Load(dataDir, envDir string) (*Tree, error) {
+	defaults, err := loadParams(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var overrides []Override
+	envPath := filepath.Join(dataDir, envDir)
+	files, err := os.ReadDir(envPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+		o, err := loadOverride(filepath.Join(envPath, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		o.Name = f.Name()
+		overrides = append(overrides, o)
+	}
+
+	t, err := New(overrides)
+	if err != nil {
+		return nil, err
+	}
+	t.defaults = defaults
+	return t, nil
+}
+
+func loadOverride(dir string) (Override, error) {
+	var o Override
+
+	if err := readYaml(filepath.Join(dir, ConfigFile), &o); err != nil {
+		return o, err
+	}
+	params, err := loadParams(dir)
+	if err != nil {
+		return o, err
+	}
+	o.Params = params
+	return o, nil
+}
+
+func loadParams(dir string) (map[string]interface{}, error) {
+	params := make(map[string]interface{})
+	if err := readYaml(filepath.Join(dir, ParamsFile), &params); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+// readYaml unmarshals a YAML file into out. Missing files are ignored.
+func readYaml(file string, out interface{}) error {
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err := yaml.Unmarshal(contents, out); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	return nil
+}
+
+// New receives a list of overrides and returns a Tree after checking that
+// every parent exists and that there are no inheritance cycles. Overrides
+// without parent inherit from the default environment.
+func New(overrides []Override) (*Tree, error) {
+	t := &Tree{overrides: make(map[string]*Override)}
+
+	for i := range overrides {
+		o := overrides[i]
+		if o.Name == Default {
+			return nil, fmt.Errorf("environment name %q is reserved", Default)
+		}
+		if o.Parent == "" {
+			o.Parent = Default
+		}
+		if o.BaseURL != "" {
+			baseURL, err := utils.NormalizeBaseURL(o.BaseURL)
+			if err != nil {
+				return nil, fmt.Errorf("environment %q: %w", o.Name, err)
+			}
+			o.BaseURL = baseURL
+		}
+		t.overrides[o.Name] = &o
+	}
+
+	for _, o := range t.overrides {
+		if _, ok := t.overrides[o.Parent]; !ok && o.Parent != Default {
+			return nil, fmt.Errorf("environment %q has unknown parent %q", o.Name, o.Parent)
+		}
+	}
+
+	names := make([]string, 0, len(t.overrides))
+	for name := range t.overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Depth-first traversal emitting parents before their children. The
+	// visiting set is used for detecting cycles.
+	visited := make(map[string]bool)
+	visiting := make(map[string]bool)
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		if name == Default || visited[name] {
+			return nil
+		}
+		path = append(path, name)
+		if visiting[name] {
+			return errors.New("environment inheritance cycle: " + strings.Join(path, " -> "))
+		}
+		visiting[name] = true
+		if err := visit(t.overrides[name].Parent, path); err != nil {
+			return err
+		}
+		visiting[name] = false
+		visited[name] = true
+		t.order = append(t.order, name)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// Names returns the names of all the environment overrides. Parents always
+// come before their children, otherwise the names are sorted alphabetically.
+func (t *Tree) Names() []string {
+	if t == nil {
+		return nil
+	}
+	return append([]string(nil), t.order...)
+}
+
+// Has returns whether an environment with the received name exists. The
+// default environment always exists.
+func (t *Tree) Has(name string) bool {
+	if name == "" || name == Default {
+		return true
+	}
+	if t == nil {
+		return false
+	}
+	_, ok := t.overrides[name]
+	return ok
+}
+
+// Parent returns the name of the environment the received one inherits
+// from.
+func (t *Tree) Parent(name string) string {
+	if t != nil {
+		if o, ok := t.overrides[name]; ok {
+			return o.Parent
+		}
+	}
+	return Default
+}
+
+// Chain returns the inheritance chain of an environment, starting with the
+// environment itself and ending with the default environment. Lookups
+// should go through the chain in order, stopping at the first match.
+func (t *Tree) Chain(name string) []string {
+	if name == "" || name == Default {
+		return []string{Default}
+	}
+	chain := []string{name}
+	for p := t.Parent(name); p != Default; p = t.Parent(p) {
+		chain = append(chain, p)
+	}
+	return append(chain, Default)
+}
+
+// Params returns the default template parameters of an environment. The
+// global defaults are overridden by the ones of every environment in the
+// chain, from the furthest parent to the environment itself. The returned
+// map is a copy that can be modified.
+func (t *Tree) Params(name string) map[string]interface{} {
+	params := make(map[string]interface{})
+	if t == nil {
+		return params
+	}
+	for k, v := range t.defaults {
+		params[k] = v
+	}
+	chain := t.Chain(name)
+	for i := len(chain) - 1; i >= 0; i-- {
+		if o, ok := t.overrides[chain[i]]; ok {
+			for k, v := range o.Params {
+				params[k] = v
+			}
+		}
+	}
+	return params
+}
+
+// BaseURL returns the base URL templates of an environment should use. It
+// is the base URL set by the closest environment in the chain, or the
+// received one if none sets it, followed by the environment path.
+func (t *Tree) BaseURL(baseURL, name string) string {
+	if t != nil {
+		for _, e := range t.Chain(name) {
+			if o, ok := t.overrides[e]; ok && o.BaseURL != "" {
+				baseURL = o.BaseURL
+				break
+			}
+		}
+	}
+	return utils.BaseURLforEnvName(baseURL, name)
+}
+
+// StaticListing returns whether the directories of the static files of an
+// environment, not including the ones of its parents, are listed. Without
+// a setting of its own, it returns the received default.
+func (t *Tree) StaticListing(name string, listing bool) bool {
+	if t != nil {
+		if o, ok := t.overrides[name]; ok && o.StaticListing != nil {
+			return *o.StaticListing
+		}
+	}
+	return listing
+}
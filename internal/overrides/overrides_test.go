@@ -0,0 +1,184 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package overrides
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNewOrdersParentsFirst(t *testing.T) {
+	tree, err := New([]Override{
+		{Name: "prod-eu", Parent: "prod"},
+		{Name: "dev"},
+		{Name: "prod-us", Parent: "prod"},
+		{Name: "prod"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"dev", "prod", "prod-eu", "prod-us"}
+	if names := tree.Names(); !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected: %v\nGot: %v", expected, names)
+	}
+}
+
+func TestChain(t *testing.T) {
+	tree, err := New([]Override{
+		{Name: "prod-eu", Parent: "prod"},
+		{Name: "prod", Parent: "default"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		env   string
+		chain []string
+	}{
+		{env: "", chain: []string{"default"}},
+		{env: "default", chain: []string{"default"}},
+		{env: "prod", chain: []string{"prod", "default"}},
+		{env: "prod-eu", chain: []string{"prod-eu", "prod", "default"}},
+		{env: "unknown", chain: []string{"unknown", "default"}},
+	}
+	for _, tt := range tests {
+		if chain := tree.Chain(tt.env); !reflect.DeepEqual(chain, tt.chain) {
+			t.Errorf("Expected: %v\nGot: %v", tt.chain, chain)
+		}
+	}
+}
+
+func TestNewReturnsErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides []Override
+	}{
+		{name: "unknown parent", overrides: []Override{{Name: "prod", Parent: "missing"}}},
+		{name: "reserved name", overrides: []Override{{Name: "default"}}},
+		{name: "self cycle", overrides: []Override{{Name: "prod", Parent: "prod"}}},
+		{name: "cycle", overrides: []Override{
+			{Name: "a", Parent: "c"},
+			{Name: "b", Parent: "a"},
+			{Name: "c", Parent: "b"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.overrides); err == nil {
+				t.Fatal("Expected error")
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	envPath := t.TempDir()
+	for _, d := range []string{"prod", "prod-eu", "staging"} {
+		if err := os.Mkdir(filepath.Join(envPath, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	envFile := filepath.Join(envPath, "prod-eu", ConfigFile)
+	if err := os.WriteFile(envFile, []byte("parent: prod\nstaticListing: false\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := Load(filepath.Dir(envPath), filepath.Base(envPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent := tree.Parent("prod-eu"); parent != "prod" {
+		t.Errorf("Expected: prod\nGot: %s", parent)
+	}
+	if parent := tree.Parent("staging"); parent != Default {
+		t.Errorf("Expected: %s\nGot: %s", Default, parent)
+	}
+	if tree.StaticListing("prod-eu", true) || !tree.StaticListing("prod", true) || tree.StaticListing(Default, false) {
+		t.Error("Expected: only prod-eu overriding the static listing default")
+	}
+
+	tree, err = Load(envPath, "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.Names()) != 0 {
+		t.Error("Expected no environments")
+	}
+}
+
+func TestParams(t *testing.T) {
+	tree, err := New([]Override{
+		{Name: "prod", Params: map[string]interface{}{"mirror": "prod-mirror", "ntp": "prod-ntp"}},
+		{Name: "prod-eu", Parent: "prod", Params: map[string]interface{}{"mirror": "eu-mirror"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree.defaults = map[string]interface{}{"mirror": "global-mirror", "proxy": "global-proxy"}
+
+	expected := map[string]interface{}{
+		"mirror": "eu-mirror",
+		"ntp":    "prod-ntp",
+		"proxy":  "global-proxy",
+	}
+	if params := tree.Params("prod-eu"); !reflect.DeepEqual(params, expected) {
+		t.Errorf("Expected: %v\nGot: %v", expected, params)
+	}
+
+	expected = map[string]interface{}{
+		"mirror": "global-mirror",
+		"proxy":  "global-proxy",
+	}
+	if params := tree.Params(""); !reflect.DeepEqual(params, expected) {
+		t.Errorf("Expected: %v\nGot: %v", expected, params)
+	}
+}
+
+func TestBaseURL(t *testing.T) {
+	tree, err := New([]Override{
+		{Name: "prod"},
+		{Name: "prod-eu", Parent: "prod", BaseURL: "eu.example.com:8081"},
+		{Name: "prod-eu-west", Parent: "prod-eu"},
+		{Name: "prod-v6", Parent: "prod", BaseURL: "2001:db8::1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		env     string
+		baseURL string
+	}{
+		{env: "", baseURL: "localhost:8081"},
+		{env: "prod", baseURL: "localhost:8081/env/prod"},
+		{env: "prod-eu", baseURL: "eu.example.com:8081/env/prod-eu"},
+		{env: "prod-eu-west", baseURL: "eu.example.com:8081/env/prod-eu-west"},
+		{env: "prod-v6", baseURL: "[2001:db8::1]/env/prod-v6"},
+	}
+	for _, tt := range tests {
+		if baseURL := tree.BaseURL("localhost:8081", tt.env); baseURL != tt.baseURL {
+			t.Errorf("Expected: %s\nGot: %s", tt.baseURL, baseURL)
+		}
+	}
+
+	if _, err := New([]Override{{Name: "broken", BaseURL: "[2001:db8::1:8081"}}); err == nil {
+		t.Error("Expected: error for invalid baseURL\nGot: nil")
+	}
+}
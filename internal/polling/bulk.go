@@ -0,0 +1,178 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package polling
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/thousandeyes/shoelaces/internal/event"
+	"github.com/thousandeyes/shoelaces/internal/hosts"
+	"github.com/thousandeyes/shoelaces/internal/log"
+	"github.com/thousandeyes/shoelaces/internal/overrides"
+	"github.com/thousandeyes/shoelaces/internal/server"
+	"github.com/thousandeyes/shoelaces/internal/templates"
+	"github.com/thousandeyes/shoelaces/internal/utils"
+)
+
+// Selection holds the criteria for choosing a group of waiting servers.
+// Servers must match every criterion that is set.
+type Selection struct {
+	Macs          []string
+	MacPrefix     string
+	Subnet        *net.IPNet
+	HostnameRegex *regexp.Regexp
+}
+
+// TargetResult holds the outcome of a bulk assignment for a single server.
+type TargetResult struct {
+	Server server.Server
+	Params map[string]interface{}
+	Error  string `json:",omitempty"`
+}
+
+// NewSelection parses the criteria for choosing a group of waiting servers.
+// Empty criteria are ignored, but at least one must be set.
+func NewSelection(macs []string, macPrefix, subnet, hostnameRegex string) (Selection, error) {
+	var s Selection
+	for _, mac := range macs {
+		if mac != "" {
+			s.Macs = append(s.Macs, strings.ToLower(utils.MacDashToColon(mac)))
+		}
+	}
+	s.MacPrefix = strings.ToLower(utils.MacDashToColon(macPrefix))
+	if subnet != "" {
+		_, ipNet, err := net.ParseCIDR(subnet)
+		if err != nil {
+			return s, fmt.Errorf("Invalid subnet: %w", err)
+		}
+		s.Subnet = ipNet
+	}
+	if hostnameRegex != "" {
+		re, err := regexp.Compile(hostnameRegex)
+		if err != nil {
+			return s, fmt.Errorf("Invalid hostname regex: %w", err)
+		}
+		s.HostnameRegex = re
+	}
+	if len(s.Macs) == 0 && s.MacPrefix == "" && s.Subnet == nil && s.HostnameRegex == nil {
+		return s, errors.New("No servers selected")
+	}
+	return s, nil
+}
+
+// Match returns true if srv matches all the criteria of the selection.
+func (s Selection) Match(srv server.Server) bool {
+	mac := strings.ToLower(srv.Mac)
+	if len(s.Macs) > 0 && !utils.StringInSlice(mac, s.Macs) {
+		return false
+	}
+	if s.MacPrefix != "" && !strings.HasPrefix(mac, s.MacPrefix) {
+		return false
+	}
+	if s.Subnet != nil && !s.Subnet.Contains(net.ParseIP(srv.IP)) {
+		return false
+	}
+	if s.HostnameRegex != nil && !s.HostnameRegex.MatchString(srv.Hostname) {
+		return false
+	}
+	return true
+}
+
+// UpdateTargets selects a script for every waiting server matching the
+// selection, sorted by MAC. Parameters are templates rendered for each
+// server with its index in the selection, starting at 1, along with its mac,
+// ip and hostname, e.g. "rack12-{{.index}}". The outcome for each server is
+// reported individually, and a failure doesn't prevent the rest of servers
+// from getting their script.
+func UpdateTargets(logger log.Logger, serverStates *server.States,
+	templateRenderer *templates.ShoelacesTemplates, envTree *overrides.Tree, hostVars *hosts.Hosts,
+	eventLog *event.Log, baseURL string, selection Selection,
+	scriptName string, envName string, params map[string]interface{}) []TargetResult {
+
+	results := make([]TargetResult, 0)
+	index := 0
+	for _, srv := range ListServers(serverStates) {
+		if !selection.Match(srv) {
+			continue
+		}
+		index++
+
+		result := TargetResult{Server: srv}
+		hostParams, err := renderParams(params, map[string]interface{}{
+			"index":    index,
+			"mac":      srv.Mac,
+			"ip":       srv.IP,
+			"hostname": srv.Hostname,
+		})
+		if err == nil {
+			result.Params = hostParams
+			_, err = UpdateTarget(logger, serverStates, templateRenderer, envTree, hostVars,
+				eventLog, baseURL, srv, scriptName, envName, hostParams)
+		}
+		if err != nil {
+			logger.Info("bulk target update failed", "component", "polling", "server", srv.Mac, "target", scriptName, "err", err)
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+
+	// Servers chosen explicitly but not waiting anymore are reported too.
+	for _, mac := range selection.Macs {
+		found := false
+		for _, r := range results {
+			if strings.ToLower(r.Server.Mac) == mac {
+				found = true
+				break
+			}
+		}
+		if !found {
+			results = append(results, TargetResult{
+				Server: server.New(mac, "", ""),
+				Error:  "MAC is not in the booting state",
+			})
+		}
+	}
+
+	return results
+}
+
+// renderParams returns a copy of params with every value rendered as a
+// template with vars.
+func renderParams(params map[string]interface{}, vars map[string]interface{}) (map[string]interface{}, error) {
+	ret := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		s, ok := v.(string)
+		if !ok || !strings.Contains(s, "{{") {
+			ret[k] = v
+			continue
+		}
+		tmpl, err := template.New(k).Option("missingkey=error").Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid template for %s: %w", k, err)
+		}
+		b := &bytes.Buffer{}
+		if err := tmpl.Execute(b, vars); err != nil {
+			return nil, fmt.Errorf("Invalid template for %s: %w", k, err)
+		}
+		ret[k] = b.String()
+	}
+	return ret, nil
+}
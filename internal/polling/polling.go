@@ -19,12 +19,16 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"strings"
 	"text/template"
 	"time"
 
 	"github.com/thousandeyes/shoelaces/internal/event"
+	"github.com/thousandeyes/shoelaces/internal/hosts"
+	"github.com/thousandeyes/shoelaces/internal/inventory"
 	"github.com/thousandeyes/shoelaces/internal/log"
 	"github.com/thousandeyes/shoelaces/internal/mappings"
+	"github.com/thousandeyes/shoelaces/internal/overrides"
 	"github.com/thousandeyes/shoelaces/internal/server"
 	"github.com/thousandeyes/shoelaces/internal/templates"
 	"github.com/thousandeyes/shoelaces/internal/utils"
@@ -37,7 +41,7 @@ const (
 	startScript = "#!ipxe\n" +
 		"echo Shoelaces starts polling\n" +
 		"chain --autofree --replace \\\n" +
-		"    http://{{.baseURL}}/poll/1/${netX/mac:hexhyp}\n" +
+		"    http://{{.baseURL}}/poll/1/${netX/mac:hexhyp}?uuid=${uuid}&serial=${serial:uristring}\n" +
 		"#\n" +
 		"#\n" +
 		"# Do\n" +
@@ -49,7 +53,7 @@ const (
 	retryScript = "#!ipxe\n" +
 		"prompt --key 0x02 --timeout 7000 shoelaces: Press Ctrl-B for manual override... \\\n" +
 		"  && chain -ar http://{{.baseURL}}/ipxemenu \\\n" +
-		"  || chain -ar http://{{.baseURL}}/poll/1/{{.macAddress}}\n\n" +
+		"  || chain -ar http://{{.baseURL}}/poll/1/{{.macAddress}}?uuid=${uuid}&serial=${serial:uristring}\n\n" +
 		"# Note: the iPXE client will see the above code as an endless loop.\n" +
 		"# However, Shoelaces server can break that loop to enable further booting.\n"
 
@@ -58,6 +62,15 @@ const (
 		"echo Shoelaces reached the maximum number of retries\n" +
 		"exit\n"
 
+	sleepScript = "#!ipxe\n" +
+		"echo Shoelaces is busy, retrying in {{.seconds}} seconds\n" +
+		"sleep {{.seconds}}\n" +
+		"chain --autofree --replace {{.url}}\n"
+
+	// busyRetry is how long hosts wait to poll again when there are too
+	// many waiting hosts.
+	busyRetry = 30 * time.Second
+
 	// BootAction is used when a user selects a script for the polling
 	// server. The server polls once again, so it gets the selected script
 	// as answer.
@@ -67,6 +80,9 @@ const (
 	RetryAction ManualAction = 1
 	// TimeoutAction is used when a server polling is timing out.
 	TimeoutAction ManualAction = 2
+	// BusyAction is used when a new server polls but there are too many
+	// servers waiting already, so it has to retry later.
+	BusyAction ManualAction = 3
 )
 
 // ListServers provides a list of the servers that tried to boot
@@ -91,20 +107,16 @@ func ListServers(serverStates *server.States) server.Servers {
 // put on hold. This method is called when something is finally chosen for
 // that host.
 func UpdateTarget(logger log.Logger, serverStates *server.States,
-	templateRenderer *templates.ShoelacesTemplates, eventLog *event.Log, baseURL string, srv server.Server,
+	templateRenderer *templates.ShoelacesTemplates, envTree *overrides.Tree, hostVars *hosts.Hosts,
+	eventLog *event.Log, baseURL string, srv server.Server,
 	scriptName string, envName string, params map[string]interface{}) (inputErr bool, err error) {
 
 	if !utils.IsValidMAC(srv.Mac) {
 		return true, errors.New("Invalid MAC")
 	}
 	// Test the template with user inputs
-	setHostName(params, srv.Mac)
-
-	params["baseURL"] = utils.BaseURLforEnvName(baseURL, envName)
-	_, err = templateRenderer.RenderTemplate(logger, scriptName, params, envName)
-	if err != nil {
-		inputErr = true
-		return
+	if err = testTemplate(logger, templateRenderer, envTree, hostVars, baseURL, srv, scriptName, envName, params); err != nil {
+		return true, err
 	}
 
 	serverStates.Lock()
@@ -123,62 +135,136 @@ func UpdateTarget(logger log.Logger, serverStates *server.States,
 	return false, nil
 }
 
-// Poll contains the main logic of Shoelaces. It uses several heuristics to find
-// the right script to return, as network maps, hostname maps and manual
-// selection.
-func Poll(logger log.Logger, serverStates *server.States,
-	hostnameMaps []mappings.HostnameMap, networkMaps []mappings.NetworkMap,
-	eventLog *event.Log, templateRenderer *templates.ShoelacesTemplates,
-	baseURL string, srv server.Server) (scriptText string, err error) {
+// ListPending provides a list of the assignments registered for hosts that
+// didn't poll yet.
+func ListPending(serverStates *server.States) server.Assignments {
+	ret := make([]server.Assignment, 0)
+
+	serverStates.RLock()
+	defer serverStates.RUnlock()
+	for _, a := range serverStates.Pending {
+		ret = append(ret, *a)
+	}
+	sort.Sort(server.Assignments(ret))
+
+	return ret
+}
+
+// AddPending registers the script a host boots the next time it polls,
+// before it does it for the first time. An assignment registered before for
+// the same host is replaced.
+func AddPending(logger log.Logger, serverStates *server.States,
+	templateRenderer *templates.ShoelacesTemplates, envTree *overrides.Tree, hostVars *hosts.Hosts,
+	eventLog *event.Log, baseURL string, srv server.Server,
+	scriptName string, envName string, params map[string]interface{}) (inputErr bool, err error) {
 
-	script, found := attemptAutomaticBoot(logger, hostnameMaps, networkMaps, templateRenderer, eventLog, baseURL, srv)
+	if !utils.IsValidMAC(srv.Mac) {
+		return true, errors.New("Invalid MAC")
+	}
+	srv.Mac = strings.ToLower(srv.Mac)
+	if err = testTemplate(logger, templateRenderer, envTree, hostVars, baseURL, srv, scriptName, envName, params); err != nil {
+		return true, err
+	}
+
+	serverStates.Lock()
+	defer serverStates.Unlock()
+	logger.Debug("adding pending assignment", "component", "polling", "server", srv.Mac, "target", scriptName, "environment", envName, "params", params)
+	eventLog.AddEvent(event.UserSelection, srv, "", scriptName, nil)
+	serverStates.AddPending(server.Assignment{
+		Mac:         srv.Mac,
+		Target:      scriptName,
+		Environment: envName,
+		Params:      params,
+	})
+	return false, nil
+}
+
+// CancelPending removes the assignment registered for a host.
+func CancelPending(logger log.Logger, serverStates *server.States, mac string) error {
+	mac = strings.ToLower(mac)
+
+	serverStates.Lock()
+	defer serverStates.Unlock()
+	if !serverStates.DeletePending(mac) {
+		return errors.New("MAC has no pending assignment")
+	}
+	logger.Debug("pending assignment cancelled", "component", "polling", "server", mac)
+	return nil
+}
+
+// Poll contains the main logic of Shoelaces. A pending assignment for the
+// host takes precedence. Otherwise it asks the host sources, in order, for
+// the right script to return, falling back to manual selection.
+func Poll(logger log.Logger, serverStates *server.States, sources []inventory.HostSource,
+	eventLog *event.Log, templateRenderer *templates.ShoelacesTemplates, envTree *overrides.Tree,
+	hostVars *hosts.Hosts, baseURL string, srv server.Server) (scriptText string, err error) {
+
+	if a, script, found := findPending(logger, serverStates, srv); found {
+		text, err := bootSelected(logger, templateRenderer, envTree, hostVars, eventLog, baseURL, srv, script, event.PendingBoot)
+		if err == nil {
+			consumePending(serverStates, srv, a)
+			return text, nil
+		}
+		// The templates may have changed since the assignment was
+		// registered. It's kept to be fixed or cancelled, and the host
+		// still boots through the other sources.
+		logger.Error("pending assignment render failed", "component", "polling", "mac", srv.Mac, "target", script.Name, "err", err)
+	}
+
+	script, found := attemptAutomaticBoot(logger, sources, templateRenderer, envTree, hostVars, eventLog, baseURL, srv)
 	if found {
 		return script, nil
 	}
 
-	return manualAction(logger, serverStates, templateRenderer, eventLog, baseURL, srv)
+	return manualAction(logger, serverStates, templateRenderer, envTree, hostVars, eventLog, baseURL, srv)
 }
 
-func attemptAutomaticBoot(logger log.Logger, hostnameMaps []mappings.HostnameMap, networkMaps []mappings.NetworkMap,
-	templateRenderer *templates.ShoelacesTemplates, eventLog *event.Log,
+func attemptAutomaticBoot(logger log.Logger, sources []inventory.HostSource,
+	templateRenderer *templates.ShoelacesTemplates, envTree *overrides.Tree, hostVars *hosts.Hosts, eventLog *event.Log,
 	baseURL string, srv server.Server) (scriptText string, found bool) {
 
-	// Find with reverse hostname matched with the hostname regexps
-	if script, found := mappings.FindScriptForHostname(hostnameMaps, srv.Hostname); found {
-		logger.Debug("host found", "component", "polling", "where", "hostname-mapping", "host", srv.Hostname)
-		eventLog.AddEvent(event.HostBoot, srv, event.PtrMatchBoot, script.Name, script.Params)
-		script.Params["hostname"] = srv.Hostname
-
-		return genBootScript(logger, templateRenderer, baseURL, script), found
-	}
-	logger.Debug("host not found", "component", "polling", "where", "hostname-mapping", "host", srv.Hostname)
+	for _, source := range sources {
+		match, err := source.Lookup(srv)
+		if err != nil {
+			// A failing source must not prevent the host from booting,
+			// the rest of sources and manual selection are still there.
+			logger.Error("host source lookup failed", "component", "polling", "source", source.Name(), "mac", srv.Mac, "err", err)
+			continue
+		}
+		if match == nil {
+			logger.Debug("host not found", "component", "polling", "where", source.Name(), "mac", srv.Mac, "ip", srv.IP, "host", srv.Hostname)
+			continue
+		}
 
-	// Find with IP belonging to a configured subnet
-	if script, found := mappings.FindScriptForNetwork(networkMaps, srv.IP); found {
-		logger.Debug("host found", "component", "polling", "where", "network-mapping", "ip", srv.IP)
+		logger.Debug("host found", "component", "polling", "where", source.Name(), "mac", srv.Mac, "ip", srv.IP, "host", srv.Hostname)
+		script, hostFile := applyHostVars(logger, hostVars, match.Script, srv)
 		setHostName(script.Params, srv.Mac)
-		srv.Hostname = script.Params["hostname"].(string)
-		eventLog.AddEvent(event.HostBoot, srv, event.SubnetMatchBoot, script.Name, script.Params)
+		text, err := genBootScript(logger, templateRenderer, envTree, baseURL, srv.Mac, script)
+		if err != nil {
+			// Sources such as the inventory may name unknown scripts or
+			// environments, or miss variables. The host is still
+			// given to the rest of sources and manual selection.
+			logger.Error("host source script render failed", "component", "polling", "source", source.Name(), "mac", srv.Mac, "script", script.Name, "environment", script.Environment, "err", err)
+			continue
+		}
+		srv.Hostname = fmt.Sprint(script.Params["hostname"])
+		eventLog.AddHostBootEvent(srv, match.BootType, script.Name, script.Params, hostFile)
 
-		return genBootScript(logger, templateRenderer, baseURL, script), found
+		return text, true
 	}
-	logger.Debug("host not found", "component", "polling", "where", "network-mapping", "ip", srv.IP)
 
 	return "", false
 }
 
 func manualAction(logger log.Logger, serverStates *server.States, templateRenderer *templates.ShoelacesTemplates,
-	eventLog *event.Log, baseURL string, srv server.Server) (scriptText string, err error) {
+	envTree *overrides.Tree, hostVars *hosts.Hosts, eventLog *event.Log, baseURL string, srv server.Server) (scriptText string, err error) {
 
 	script, action := chooseManualAction(logger, serverStates, eventLog, srv)
-	logger.Debug("manual action selected", "component", "polling", "target-script-name", script, "action", action)
+	logger.Debug("manual action selected", "component", "polling", "target-script-name", script.Redacted(logger.Redactor()), "action", action)
 
 	switch action {
 	case BootAction:
-		setHostName(script.Params, srv.Mac)
-		srv.Hostname = script.Params["hostname"].(string)
-		eventLog.AddEvent(event.HostBoot, srv, event.ManualBoot, script.Name, script.Params)
-		return genBootScript(logger, templateRenderer, baseURL, script), nil
+		return bootSelected(logger, templateRenderer, envTree, hostVars, eventLog, baseURL, srv, script, event.ManualBoot)
 
 	case RetryAction:
 		return genRetryScript(logger, baseURL, srv.Mac), nil
@@ -186,6 +272,10 @@ func manualAction(logger log.Logger, serverStates *server.States, templateRender
 	case TimeoutAction:
 		return timeoutScript, nil
 
+	case BusyAction:
+		retryURL := "http://" + baseURL + "/poll/1/" + utils.MacColonToDash(srv.Mac) + "?uuid=${uuid}&serial=${serial:uristring}"
+		return GenSleepScript(logger, retryURL, busyRetry), nil
+
 	default:
 		logger.Info("unknown action", "component", "polling")
 		return "", fmt.Errorf("%s", "Unknown action")
@@ -218,6 +308,11 @@ func chooseManualAction(logger log.Logger, serverStates *server.States,
 		}
 	}
 
+	if serverStates.Full() {
+		logger.Info("too many waiting servers", "component", "polling", "mac", srv.Mac, "max", serverStates.MaxServers)
+		return nil, BusyAction
+	}
+
 	serverStates.AddServer(srv)
 	logger.Debug("new server", "component", "polling", "mac", srv.Mac)
 	eventLog.AddEvent(event.HostPoll, srv, "", "", nil)
@@ -225,6 +320,98 @@ func chooseManualAction(logger log.Logger, serverStates *server.States,
 	return nil, RetryAction
 }
 
+// findPending returns the assignment registered for srv, and the script to
+// boot from it.
+func findPending(logger log.Logger, serverStates *server.States, srv server.Server) (*server.Assignment, *mappings.Script, bool) {
+	mac := strings.ToLower(srv.Mac)
+
+	serverStates.Lock()
+	defer serverStates.Unlock()
+	a, ok := serverStates.Pending[mac]
+	if !ok {
+		return nil, nil, false
+	}
+	logger.Debug("pending assignment found", "component", "polling", "mac", srv.Mac, "target", a.Target)
+
+	params := make(map[string]interface{}, len(a.Params))
+	for k, v := range a.Params {
+		params[k] = v
+	}
+	return a, &mappings.Script{Name: a.Target, Environment: a.Environment, Params: params}, true
+}
+
+// consumePending removes the assignment a once srv booted it, unless it was
+// replaced meanwhile, along with the state of srv if it was already waiting
+// for a manual selection.
+func consumePending(serverStates *server.States, srv server.Server, a *server.Assignment) {
+	mac := strings.ToLower(srv.Mac)
+
+	serverStates.Lock()
+	defer serverStates.Unlock()
+	if serverStates.Pending[mac] == a {
+		serverStates.DeletePending(mac)
+	}
+	serverStates.DeleteServer(srv.Mac)
+}
+
+// bootSelected renders the script selected by a user for srv. Parameters
+// chosen by the user take precedence over host variables.
+func bootSelected(logger log.Logger, templateRenderer *templates.ShoelacesTemplates, envTree *overrides.Tree,
+	hostVars *hosts.Hosts, eventLog *event.Log, baseURL string, srv server.Server,
+	script *mappings.Script, bootType string) (string, error) {
+
+	hostFile := ""
+	if host, ok := findHost(hostVars, srv); ok {
+		script.Params = utils.MergeMaps(host.Params, script.Params)
+		hostFile = host.File
+	}
+	setHostName(script.Params, srv.Mac)
+	text, err := genBootScript(logger, templateRenderer, envTree, baseURL, srv.Mac, script)
+	if err != nil {
+		return "", err
+	}
+	srv.Hostname = fmt.Sprint(script.Params["hostname"])
+	eventLog.AddHostBootEvent(srv, bootType, script.Name, script.Params, hostFile)
+	return text, nil
+}
+
+// testTemplate renders a script with the parameters chosen by a user, on
+// top of the host variables, to catch errors before the host boots it.
+func testTemplate(logger log.Logger, templateRenderer *templates.ShoelacesTemplates, envTree *overrides.Tree,
+	hostVars *hosts.Hosts, baseURL string, srv server.Server,
+	scriptName string, envName string, params map[string]interface{}) error {
+
+	testParams := utils.MergeMaps(nil, params)
+	if host, ok := findHost(hostVars, srv); ok {
+		testParams = utils.MergeMaps(host.Params, params)
+	}
+	setHostName(testParams, srv.Mac)
+	testParams["baseURL"] = envTree.BaseURL(baseURL, envName)
+	_, err := templateRenderer.RenderTemplate(logger, scriptName, testParams, envName)
+	return err
+}
+
+// findHost returns the host file matching the identifiers of srv, if any.
+func findHost(hostVars *hosts.Hosts, srv server.Server) (*hosts.Host, bool) {
+	return hostVars.Find(srv.Mac, srv.Hostname, srv.Serial, srv.UUID)
+}
+
+// applyHostVars returns a copy of script with the variables of the host file
+// matching srv applied on top of its parameters, along with the name of
+// that file. It returns script itself if there is no host file for srv.
+func applyHostVars(logger log.Logger, hostVars *hosts.Hosts, script *mappings.Script, srv server.Server) (*mappings.Script, string) {
+	host, ok := findHost(hostVars, srv)
+	if !ok {
+		return script, ""
+	}
+	logger.Debug("host file found", "component", "polling", "mac", srv.Mac, "file", host.File)
+	return &mappings.Script{
+		Name:        script.Name,
+		Environment: script.Environment,
+		Params:      utils.MergeMaps(script.Params, host.Params),
+	}, host.File
+}
+
 func setHostName(params map[string]interface{}, mac string) {
 	if _, ok := params["hostname"]; !ok {
 		hostname := utils.MacColonToDash(mac)
@@ -260,13 +447,43 @@ func GenStartScript(logger log.Logger, baseURL string) string {
 	return parsedTemplate.String()
 }
 
-func genBootScript(logger log.Logger, templateRenderer *templates.ShoelacesTemplates, baseURL string, script *mappings.Script) string {
-	script.Params["baseURL"] = utils.BaseURLforEnvName(baseURL, script.Environment)
-	text, err := templateRenderer.RenderTemplate(logger, script.Name, script.Params, script.Environment)
+// genBootScript renders the script to boot. The MAC of the host is available
+// as the mac variable, unless the script params set it already. Scripts
+// may come from outside, so unknown scripts or environments and missing
+// variables are errors.
+func genBootScript(logger log.Logger, templateRenderer *templates.ShoelacesTemplates, envTree *overrides.Tree, baseURL string, mac string, script *mappings.Script) (string, error) {
+	script.Params["baseURL"] = envTree.BaseURL(baseURL, script.Environment)
+	if _, ok := script.Params["mac"]; !ok {
+		script.Params["mac"] = mac
+	}
+	return templateRenderer.RenderTemplate(logger, script.Name, script.Params, script.Environment)
+}
+
+// GenSleepScript returns an iPXE script that waits for wait, rounded up to
+// seconds, and chains to retryURL.
+func GenSleepScript(logger log.Logger, retryURL string, wait time.Duration) string {
+	variablesMap := map[string]interface{}{}
+	parsedTemplate := &bytes.Buffer{}
+
+	tmpl, err := template.New("sleep").Parse(sleepScript)
+	if err != nil {
+		logger.Info("error parsing sleep template", "component", "polling")
+		panic(err)
+	}
+
+	seconds := int((wait + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	variablesMap["seconds"] = seconds
+	variablesMap["url"] = retryURL
+	err = tmpl.Execute(parsedTemplate, variablesMap)
 	if err != nil {
+		logger.Info("error executing sleep template", "component", "polling")
 		panic(err)
 	}
-	return text
+
+	return parsedTemplate.String()
 }
 
 func genRetryScript(logger log.Logger, baseURL string, mac string) string {
@@ -0,0 +1,282 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package polling
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thousandeyes/shoelaces/internal/event"
+	"github.com/thousandeyes/shoelaces/internal/inventory"
+	"github.com/thousandeyes/shoelaces/internal/log"
+	"github.com/thousandeyes/shoelaces/internal/mappings"
+	"github.com/thousandeyes/shoelaces/internal/server"
+	"github.com/thousandeyes/shoelaces/internal/templates"
+)
+
+const testMac = "06:66:de:ad:be:ef"
+
+func testRenderer(t *testing.T) *templates.ShoelacesTemplates {
+	dir := t.TempDir()
+	tpl := `{{define "test.ipxe"}}#!ipxe
+echo {{.hostname}} {{.release}}
+{{end}}`
+	if err := os.WriteFile(filepath.Join(dir, "test.ipxe.slc"), []byte(tpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := templates.New()
+	r.ParseTemplates(log.MakeLogger(io.Discard), dir, "env_overrides", nil, ".slc")
+	return r
+}
+
+func TestPendingAssignment(t *testing.T) {
+	logger := log.MakeLogger(io.Discard)
+	states := &server.States{Servers: make(map[string]*server.State)}
+	eventLog := &event.Log{}
+	renderer := testRenderer(t)
+	srv := server.New(testMac, "192.168.0.1", "")
+
+	inputErr, err := AddPending(logger, states, renderer, nil, nil, eventLog, "localhost", srv,
+		"test.ipxe", "", map[string]interface{}{})
+	if err == nil || !inputErr {
+		t.Errorf("Expected: input error for missing variables\nGot: %v", err)
+	}
+
+	_, err = AddPending(logger, states, renderer, nil, nil, eventLog, "localhost", server.New(strings.ToUpper(testMac), "", ""),
+		"test.ipxe", "", map[string]interface{}{"release": "focal"})
+	if err != nil {
+		t.Fatalf("Expected: no error\nGot: %v", err)
+	}
+	_, err = AddPending(logger, states, renderer, nil, nil, eventLog, "localhost", srv,
+		"test.ipxe", "", map[string]interface{}{"release": "noble"})
+	if err != nil {
+		t.Fatalf("Expected: no error\nGot: %v", err)
+	}
+	pending := ListPending(states)
+	if len(pending) != 1 || pending[0].Mac != testMac || pending[0].Params["release"] != "noble" {
+		t.Errorf("Expected: a single edited assignment\nGot: %v", pending)
+	}
+
+	script, err := Poll(logger, states, nil, eventLog, renderer, nil, nil, "localhost", srv)
+	if err != nil {
+		t.Fatalf("Expected: no error\nGot: %v", err)
+	}
+	if expected := "#!ipxe\necho 06-66-de-ad-be-ef noble\n"; script != expected {
+		t.Errorf("Expected: %q\nGot: %q", expected, script)
+	}
+	if len(ListPending(states)) != 0 {
+		t.Errorf("Expected: the assignment to be consumed\nGot: %v", ListPending(states))
+	}
+
+	script, _ = Poll(logger, states, nil, eventLog, renderer, nil, nil, "localhost", srv)
+	if !strings.Contains(script, "/poll/1/06-66-de-ad-be-ef") {
+		t.Errorf("Expected: retry script\nGot: %q", script)
+	}
+
+	// Assignments failing to render are kept.
+	states.AddPending(server.Assignment{Mac: testMac, Target: "test.ipxe", Params: map[string]interface{}{}})
+	script, _ = Poll(logger, states, nil, eventLog, renderer, nil, nil, "localhost", srv)
+	if !strings.Contains(script, "/poll/1/06-66-de-ad-be-ef") {
+		t.Errorf("Expected: retry script\nGot: %q", script)
+	}
+	if len(ListPending(states)) != 1 {
+		t.Errorf("Expected: the failed assignment to be kept\nGot: %v", ListPending(states))
+	}
+}
+
+func TestMaxServers(t *testing.T) {
+	logger := log.MakeLogger(io.Discard)
+	states := &server.States{Servers: make(map[string]*server.State), MaxServers: 1}
+	eventLog := &event.Log{}
+
+	script, _ := Poll(logger, states, nil, eventLog, nil, nil, nil, "localhost", server.New(testMac, "192.168.0.1", ""))
+	if strings.Contains(script, "sleep") {
+		t.Errorf("Expected: retry script\nGot: %q", script)
+	}
+	script, _ = Poll(logger, states, nil, eventLog, nil, nil, nil, "localhost", server.New("06:66:de:ad:be:ee", "192.168.0.2", ""))
+	expected := "#!ipxe\n" +
+		"echo Shoelaces is busy, retrying in 30 seconds\n" +
+		"sleep 30\n" +
+		"chain --autofree --replace http://localhost/poll/1/06-66-de-ad-be-ee?uuid=${uuid}&serial=${serial:uristring}\n"
+	if script != expected {
+		t.Errorf("Expected: %q\nGot: %q", expected, script)
+	}
+	if len(states.Servers) != 1 || len(eventLog.List()) != 1 {
+		t.Errorf("Expected: a single waiting server\nGot: %v", states.Servers)
+	}
+
+	// Servers already waiting keep retrying as usual.
+	script, _ = Poll(logger, states, nil, eventLog, nil, nil, nil, "localhost", server.New(testMac, "192.168.0.1", ""))
+	if strings.Contains(script, "sleep") {
+		t.Errorf("Expected: retry script\nGot: %q", script)
+	}
+}
+
+func TestCancelPending(t *testing.T) {
+	logger := log.MakeLogger(io.Discard)
+	states := &server.States{Servers: make(map[string]*server.State)}
+
+	if err := CancelPending(logger, states, testMac); err == nil {
+		t.Error("Expected: error for unknown MAC\nGot: nil")
+	}
+	states.AddPending(server.Assignment{Mac: testMac, Target: "test.ipxe"})
+	if err := CancelPending(logger, states, strings.ToUpper(testMac)); err != nil {
+		t.Errorf("Expected: no error\nGot: %v", err)
+	}
+	if len(ListPending(states)) != 0 {
+		t.Errorf("Expected: no assignments\nGot: %v", ListPending(states))
+	}
+}
+
+func TestNewSelection(t *testing.T) {
+	if _, err := NewSelection(nil, "", "", ""); err == nil {
+		t.Error("Expected: error for empty selection\nGot: nil")
+	}
+	if _, err := NewSelection(nil, "", "10.0.0.0/33", ""); err == nil {
+		t.Error("Expected: error for invalid subnet\nGot: nil")
+	}
+	if _, err := NewSelection(nil, "", "", "rack("); err == nil {
+		t.Error("Expected: error for invalid regex\nGot: nil")
+	}
+
+	s, err := NewSelection(nil, "06-66", "10.0.12.0/24", "^rack12-")
+	if err != nil {
+		t.Fatalf("Expected: no error\nGot: %v", err)
+	}
+	cases := []struct {
+		srv      server.Server
+		expected bool
+	}{
+		{server.New("06:66:de:ad:be:ef", "10.0.12.5", "rack12-1"), true},
+		{server.New("06:67:de:ad:be:ef", "10.0.12.5", "rack12-1"), false},
+		{server.New("06:66:de:ad:be:ef", "10.0.13.5", "rack12-1"), false},
+		{server.New("06:66:de:ad:be:ef", "10.0.12.5", "rack13-1"), false},
+	}
+	for _, c := range cases {
+		if got := s.Match(c.srv); got != c.expected {
+			t.Errorf("Expected: %v for %v\nGot: %v", c.expected, c.srv, got)
+		}
+	}
+}
+
+func TestUpdateTargets(t *testing.T) {
+	logger := log.MakeLogger(io.Discard)
+	states := &server.States{Servers: make(map[string]*server.State)}
+	eventLog := &event.Log{}
+	renderer := testRenderer(t)
+	states.AddServer(server.New("06:66:de:ad:be:02", "10.0.12.2", ""))
+	states.AddServer(server.New("06:66:de:ad:be:01", "10.0.12.1", ""))
+	states.AddServer(server.New("06:66:de:ad:be:03", "10.0.13.1", ""))
+
+	selection, _ := NewSelection([]string{"06:66:de:ad:be:01", "06:66:de:ad:be:02", "06:66:de:ad:be:09"}, "", "", "")
+	results := UpdateTargets(logger, states, renderer, nil, nil, eventLog, "localhost", selection,
+		"test.ipxe", "", map[string]interface{}{"hostname": "rack12-{{.index}}", "release": "noble"})
+
+	if len(results) != 3 {
+		t.Fatalf("Expected: 3 results\nGot: %v", results)
+	}
+	for i, mac := range []string{"06:66:de:ad:be:01", "06:66:de:ad:be:02"} {
+		expected := fmt.Sprintf("rack12-%d", i+1)
+		if results[i].Server.Mac != mac || results[i].Error != "" || results[i].Params["hostname"] != expected {
+			t.Errorf("Expected: %s booting as %s\nGot: %v", mac, expected, results[i])
+		}
+		if states.Servers[mac].Target != "test.ipxe" {
+			t.Errorf("Expected: test.ipxe target for %s\nGot: %s", mac, states.Servers[mac].Target)
+		}
+	}
+	if results[2].Server.Mac != "06:66:de:ad:be:09" || results[2].Error == "" {
+		t.Errorf("Expected: error for a server not waiting\nGot: %v", results[2])
+	}
+	if states.Servers["06:66:de:ad:be:03"].Target != server.InitTarget {
+		t.Errorf("Expected: unselected server to keep waiting\nGot: %s", states.Servers["06:66:de:ad:be:03"].Target)
+	}
+
+	selection, _ = NewSelection(nil, "", "10.0.13.0/24", "")
+	results = UpdateTargets(logger, states, renderer, nil, nil, eventLog, "localhost", selection,
+		"test.ipxe", "", map[string]interface{}{"hostname": "{{.missing}}", "release": "noble"})
+	if len(results) != 1 || results[0].Error == "" {
+		t.Errorf("Expected: template error for a single server\nGot: %v", results)
+	}
+}
+
+func TestIPv6Client(t *testing.T) {
+	logger := log.MakeLogger(io.Discard)
+	states := &server.States{Servers: make(map[string]*server.State)}
+	eventLog := &event.Log{}
+	renderer := testRenderer(t)
+	baseURL := "[2001:db8::1]:8081"
+
+	_, network, _ := net.ParseCIDR("2001:db8:12::/48")
+	script := &mappings.Script{Name: "test.ipxe", Params: map[string]interface{}{"release": "noble"}}
+	sources := []inventory.HostSource{inventory.NewMappings(nil, []mappings.NetworkMap{{Network: network, Script: script}})}
+
+	text, err := Poll(logger, states, sources, eventLog, renderer, nil, nil, baseURL, server.New(testMac, "2001:db8:12::5", ""))
+	if err != nil {
+		t.Fatalf("Expected: no error\nGot: %v", err)
+	}
+	if expected := "#!ipxe\necho 06-66-de-ad-be-ef noble\n"; text != expected {
+		t.Errorf("Expected: %q\nGot: %q", expected, text)
+	}
+
+	text, _ = Poll(logger, states, sources, eventLog, renderer, nil, nil, baseURL, server.New(testMac, "2001:db8:13::5", ""))
+	if !strings.Contains(text, "http://[2001:db8::1]:8081/poll/1/06-66-de-ad-be-ef?") {
+		t.Errorf("Expected: retry script with the IPv6 base URL\nGot: %q", text)
+	}
+
+	text = GenStartScript(logger, baseURL)
+	if !strings.Contains(text, "http://[2001:db8::1]:8081/poll/1/${netX/mac:hexhyp}?") {
+		t.Errorf("Expected: start script with the IPv6 base URL\nGot: %q", text)
+	}
+
+	selection, err := NewSelection(nil, "", "2001:db8:13::/48", "")
+	if err != nil {
+		t.Fatalf("Expected: no error\nGot: %v", err)
+	}
+	if !selection.Match(server.New(testMac, "2001:db8:13::5", "")) || selection.Match(server.New(testMac, "10.0.13.5", "")) {
+		t.Error("Expected: only IPv6 hosts in the subnet to match")
+	}
+}
+
+func TestSourceRenderFailure(t *testing.T) {
+	logger := log.MakeLogger(io.Discard)
+	states := &server.States{Servers: make(map[string]*server.State)}
+	eventLog := &event.Log{}
+	renderer := testRenderer(t)
+
+	_, network, _ := net.ParseCIDR("10.0.0.0/8")
+	for _, script := range []*mappings.Script{
+		{Name: "unknown.ipxe", Params: map[string]interface{}{"release": "noble"}},
+		{Name: "test.ipxe", Environment: "unknown", Params: map[string]interface{}{"release": "noble"}},
+		{Name: "test.ipxe", Params: map[string]interface{}{}},
+	} {
+		sources := []inventory.HostSource{
+			inventory.NewMappings(nil, []mappings.NetworkMap{{Network: network, Script: script}}),
+			inventory.NewMappings(nil, []mappings.NetworkMap{{Network: network, Script: &mappings.Script{Name: "test.ipxe", Params: map[string]interface{}{"release": "jammy"}}}}),
+		}
+		text, err := Poll(logger, states, sources, eventLog, renderer, nil, nil, "localhost:8081", server.New(testMac, "10.0.0.5", ""))
+		if err != nil || text != "#!ipxe\necho 06-66-de-ad-be-ef jammy\n" {
+			t.Errorf("Expected: the script of the next source for %s\nGot: %q %v", script.Name, text, err)
+		}
+	}
+	// Only the boots of the next source are recorded.
+	if events := eventLog.Events[testMac]; len(events) != 3 {
+		t.Errorf("Expected: 3 boot events\nGot: %d", len(events))
+	}
+}
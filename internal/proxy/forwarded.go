@@ -0,0 +1,88 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/thousandeyes/shoelaces/internal/utils"
+)
+
+// ClientIP returns the IP of the client of a request received from
+// remoteAddr with header. When remoteAddr is a trusted proxy, the client is
+// the last address of the Forwarded, or else X-Forwarded-For, header that
+// isn't a trusted proxy itself. It returns false if remoteAddr isn't a
+// trusted proxy or the headers don't hold a valid address.
+func ClientIP(remoteAddr string, header http.Header, trusted []*net.IPNet) (string, bool) {
+	ip, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil || !utils.InNetworks(ip, trusted) {
+		return "", false
+	}
+
+	hops := forwardedFor(header.Values("Forwarded"))
+	if hops == nil {
+		for _, v := range header.Values("X-Forwarded-For") {
+			for _, hop := range strings.Split(v, ",") {
+				hops = append(hops, strings.TrimSpace(hop))
+			}
+		}
+	}
+
+	// Proxies append the address they got the request from, so the
+	// client is the first hop from the right not added by a trusted proxy.
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := parseHop(hops[i])
+		if hop == "" {
+			return "", false
+		}
+		if i == 0 || !utils.InNetworks(hop, trusted) {
+			return hop, true
+		}
+	}
+	return "", false
+}
+
+// forwardedFor returns the for parameters of the Forwarded header values,
+// as defined by RFC 7239.
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, v := range values {
+		for _, element := range strings.Split(v, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					hops = append(hops, strings.Trim(value, `"`))
+				}
+			}
+		}
+	}
+	return hops
+}
+
+// parseHop returns the IP of a hop, which can have a port and, for IPv6,
+// brackets. Unknown or obfuscated hops give an empty string.
+func parseHop(hop string) string {
+	if host, _, err := net.SplitHostPort(hop); err == nil {
+		hop = host
+	}
+	hop = strings.TrimSuffix(strings.TrimPrefix(hop, "["), "]")
+	ip := net.ParseIP(hop)
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
@@ -0,0 +1,182 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thousandeyes/shoelaces/internal/utils"
+)
+
+// headerTimeout is how long trusted proxies have to send the PROXY header.
+const headerTimeout = 10 * time.Second
+
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// Listener accepts connections with a HAProxy PROXY protocol v1 or v2 header
+// from trusted proxies, making their RemoteAddr the address of the client.
+// Connections from other sources, or without a header, are left as they
+// are.
+type Listener struct {
+	net.Listener
+	Trusted []*net.IPNet
+}
+
+// NewListener wraps l, parsing the PROXY header of the connections from the
+// trusted networks.
+func NewListener(l net.Listener, trusted []*net.IPNet) *Listener {
+	return &Listener{Listener: l, Trusted: trusted}
+}
+
+// Accept implements net.Listener. The header is read on the first Read or
+// RemoteAddr call, so a slow proxy doesn't block other connections.
+func (l *Listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	ip, _, _ := net.SplitHostPort(c.RemoteAddr().String())
+	if !utils.InNetworks(ip, l.Trusted) {
+		return c, nil
+	}
+	return &conn{Conn: c, reader: bufio.NewReader(c)}, nil
+}
+
+type conn struct {
+	net.Conn
+	reader *bufio.Reader
+	once   sync.Once
+	remote net.Addr
+	err    error
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *conn) readHeader() {
+	c.Conn.SetReadDeadline(time.Now().Add(headerTimeout))
+	defer c.Conn.SetReadDeadline(time.Time{})
+	c.remote, c.err = ReadHeader(c.reader)
+	if c.err != nil {
+		c.err = fmt.Errorf("PROXY header from %s: %w", c.Conn.RemoteAddr(), c.err)
+	}
+}
+
+// ReadHeader reads a PROXY protocol v1 or v2 header from r and returns the
+// address of the client. It returns nil, and reads nothing, if there is no
+// header, and nil as well for the headers without a client address, such
+// as health checks.
+func ReadHeader(r *bufio.Reader) (net.Addr, error) {
+	if start, err := r.Peek(len(v2Signature)); err == nil && bytes.Equal(start, v2Signature) {
+		return readV2(r)
+	}
+	if start, err := r.Peek(6); err == nil && string(start) == "PROXY " {
+		return readV1(r)
+	}
+	return nil, nil
+}
+
+func readV1(r *bufio.Reader) (net.Addr, error) {
+	// The longest v1 header is 107 bytes, CRLF included.
+	var line []byte
+	for len(line) < 107 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if bytes.HasSuffix(line, []byte("\r\n")) {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("v1 header too long")
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errors.New("invalid v1 header")
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil || (fields[1] == "TCP4") != (ip.To4() != nil) {
+		return nil, errors.New("invalid v1 address")
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+func readV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, errors.New("invalid v2 version")
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	switch header[12] & 0x0f {
+	case 0x0: // LOCAL, sent by the proxy itself
+		return nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, errors.New("invalid v2 command")
+	}
+
+	switch header[13] >> 4 {
+	case 0x1: // AF_INET
+		if len(payload) < 12 {
+			return nil, errors.New("short v2 IPv4 address")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case 0x2: // AF_INET6
+		if len(payload) < 36 {
+			return nil, errors.New("short v2 IPv6 address")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	default:
+		// AF_UNSPEC or AF_UNIX, there is no client IP.
+		return nil, nil
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/thousandeyes/shoelaces/internal/utils"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, _ := utils.ParseNetworks("10.0.0.0/8,fd00::/8")
+	cases := []struct {
+		remote   string
+		header   http.Header
+		expected string
+		ok       bool
+	}{
+		{"192.168.0.1:1234", http.Header{"X-Forwarded-For": {"1.2.3.4"}}, "", false},
+		{"10.0.0.1:1234", http.Header{}, "", false},
+		{"10.0.0.1:1234", http.Header{"X-Forwarded-For": {"1.2.3.4"}}, "1.2.3.4", true},
+		{"10.0.0.1:1234", http.Header{"X-Forwarded-For": {"6.6.6.6, 1.2.3.4, 10.0.0.2"}}, "1.2.3.4", true},
+		{"10.0.0.1:1234", http.Header{"X-Forwarded-For": {"6.6.6.6", "1.2.3.4"}}, "1.2.3.4", true},
+		{"10.0.0.1:1234", http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, "10.0.0.3", true},
+		{"10.0.0.1:1234", http.Header{"X-Forwarded-For": {"garbage"}}, "", false},
+		{"10.0.0.1:1234", http.Header{"Forwarded": {`for=192.0.2.60;proto=http, for="[2001:db8:cafe::17]:4711"`}}, "2001:db8:cafe::17", true},
+		{"10.0.0.1:1234", http.Header{"Forwarded": {"for=192.0.2.60"}, "X-Forwarded-For": {"1.2.3.4"}}, "192.0.2.60", true},
+		{"10.0.0.1:1234", http.Header{"Forwarded": {"for=unknown"}}, "", false},
+		{"[fd00::1]:1234", http.Header{"X-Forwarded-For": {"2001:db8::1"}}, "2001:db8::1", true},
+	}
+	for _, c := range cases {
+		ip, ok := ClientIP(c.remote, c.header, trusted)
+		if ip != c.expected || ok != c.ok {
+			t.Errorf("Expected: %q %t for %s %v\nGot: %q %t", c.expected, c.ok, c.remote, c.header, ip, ok)
+		}
+	}
+}
+
+func TestReadHeaderV1(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("PROXY TCP4 192.0.2.1 192.0.2.2 56324 80\r\nGET / HTTP/1.1\r\n"))
+	addr, err := ReadHeader(r)
+	if err != nil || addr.String() != "192.0.2.1:56324" {
+		t.Errorf("Expected: 192.0.2.1:56324\nGot: %v, %v", addr, err)
+	}
+	if rest, _ := io.ReadAll(r); string(rest) != "GET / HTTP/1.1\r\n" {
+		t.Errorf("Expected: the request after the header\nGot: %q", rest)
+	}
+
+	r = bufio.NewReader(strings.NewReader("PROXY TCP6 2001:db8::1 2001:db8::2 56324 80\r\n"))
+	if addr, err := ReadHeader(r); err != nil || addr.String() != "[2001:db8::1]:56324" {
+		t.Errorf("Expected: [2001:db8::1]:56324\nGot: %v, %v", addr, err)
+	}
+
+	r = bufio.NewReader(strings.NewReader("PROXY UNKNOWN\r\n"))
+	if addr, err := ReadHeader(r); err != nil || addr != nil {
+		t.Errorf("Expected: no address\nGot: %v, %v", addr, err)
+	}
+
+	r = bufio.NewReader(strings.NewReader("PROXY TCP4 192.0.2.1 nonsense\r\n"))
+	if _, err := ReadHeader(r); err == nil {
+		t.Error("Expected: error for invalid header\nGot: nil")
+	}
+
+	r = bufio.NewReader(strings.NewReader("GET / HTTP/1.1\r\n"))
+	if addr, err := ReadHeader(r); err != nil || addr != nil {
+		t.Errorf("Expected: no header\nGot: %v, %v", addr, err)
+	}
+	if rest, _ := io.ReadAll(r); string(rest) != "GET / HTTP/1.1\r\n" {
+		t.Errorf("Expected: nothing read\nGot: %q", rest)
+	}
+}
+
+func v2Header(command byte, family byte, payload []byte) []byte {
+	h := append([]byte{}, v2Signature...)
+	h = append(h, 0x20|command, family)
+	h = binary.BigEndian.AppendUint16(h, uint16(len(payload)))
+	return append(h, payload...)
+}
+
+func TestReadHeaderV2(t *testing.T) {
+	payload := []byte{192, 0, 2, 1, 192, 0, 2, 2, 0xdc, 0x04, 0, 80}
+	r := bufio.NewReader(strings.NewReader(string(v2Header(0x1, 0x11, payload)) + "GET /"))
+	addr, err := ReadHeader(r)
+	if err != nil || addr.String() != "192.0.2.1:56324" {
+		t.Errorf("Expected: 192.0.2.1:56324\nGot: %v, %v", addr, err)
+	}
+	if rest, _ := io.ReadAll(r); string(rest) != "GET /" {
+		t.Errorf("Expected: the request after the header\nGot: %q", rest)
+	}
+
+	payload = make([]byte, 36)
+	copy(payload, net.ParseIP("2001:db8::1"))
+	binary.BigEndian.PutUint16(payload[32:], 56324)
+	r = bufio.NewReader(strings.NewReader(string(v2Header(0x1, 0x21, payload))))
+	if addr, err := ReadHeader(r); err != nil || addr.String() != "[2001:db8::1]:56324" {
+		t.Errorf("Expected: [2001:db8::1]:56324\nGot: %v, %v", addr, err)
+	}
+
+	r = bufio.NewReader(strings.NewReader(string(v2Header(0x0, 0x00, nil))))
+	if addr, err := ReadHeader(r); err != nil || addr != nil {
+		t.Errorf("Expected: no address for LOCAL\nGot: %v, %v", addr, err)
+	}
+}
+
+func TestListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trusted, _ := utils.ParseNetworks("127.0.0.1")
+	pl := NewListener(l, trusted)
+	defer pl.Close()
+
+	go func() {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		c.Write([]byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 80\r\nhello"))
+	}()
+
+	c, err := pl.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if addr := c.RemoteAddr().String(); addr != "192.0.2.1:56324" {
+		t.Errorf("Expected: 192.0.2.1:56324\nGot: %s", addr)
+	}
+	if data, _ := io.ReadAll(c); string(data) != "hello" {
+		t.Errorf("Expected: hello\nGot: %q", data)
+	}
+}
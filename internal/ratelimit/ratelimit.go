@@ -0,0 +1,109 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// idleBuckets is how many buckets a Limiter keeps before dropping the full
+// ones, which behave as new.
+const idleBuckets = 10000
+
+// ipv6Prefix is the length of the IPv6 prefixes limited as a single source,
+// as hosts usually get a whole /64 to pick addresses from.
+const ipv6Prefix = 64
+
+// IPKey returns the key of an IP for a Limiter of source IPs. IPv6 addresses
+// are keyed by their /64 prefix, so hosts can't escape the limit by
+// switching addresses.
+func IPKey(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || !addr.Is6() || addr.Is4In6() {
+		return ip
+	}
+	prefix, _ := addr.WithZone("").Prefix(ipv6Prefix)
+	return prefix.String()
+}
+
+// Limiter allows up to a number of events per minute for each key, such as
+// a source IP or a MAC, with bursts of the same size. A nil Limiter allows
+// everything.
+type Limiter struct {
+	mu      sync.Mutex
+	rate    float64 // tokens per second
+	burst   float64
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New returns a Limiter allowing perMinute events per minute for each key,
+// or nil if perMinute isn't positive.
+func New(perMinute int) *Limiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &Limiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(perMinute),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow reports whether an event for key is allowed at now. If it isn't,
+// it also returns how long to wait for the next one.
+func (l *Limiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= idleBuckets {
+			l.prune(now)
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// prune drops the buckets refilled by now. The caller must hold the lock.
+func (l *Limiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllow(t *testing.T) {
+	l := New(2)
+	now := time.Unix(1000, 0)
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow("10.0.0.1", now); !ok {
+			t.Errorf("Expected: event %d allowed\nGot: denied", i)
+		}
+	}
+	ok, wait := l.Allow("10.0.0.1", now)
+	if ok || wait != 30*time.Second {
+		t.Errorf("Expected: denied for 30s\nGot: %t, %s", ok, wait)
+	}
+	if ok, _ := l.Allow("10.0.0.2", now); !ok {
+		t.Error("Expected: other keys allowed\nGot: denied")
+	}
+	if ok, _ := l.Allow("10.0.0.1", now.Add(30*time.Second)); !ok {
+		t.Error("Expected: allowed after waiting\nGot: denied")
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	l := New(0)
+	if l != nil {
+		t.Errorf("Expected: nil limiter\nGot: %v", l)
+	}
+	for i := 0; i < 100; i++ {
+		if ok, _ := l.Allow("10.0.0.1", time.Now()); !ok {
+			t.Fatal("Expected: allowed\nGot: denied")
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	l := New(60)
+	now := time.Unix(1000, 0)
+	l.Allow("10.0.0.1", now)
+	l.prune(now.Add(time.Minute))
+	if len(l.buckets) != 0 {
+		t.Errorf("Expected: refilled buckets dropped\nGot: %d", len(l.buckets))
+	}
+}
+
+func TestIPKey(t *testing.T) {
+	cases := map[string]string{
+		"10.0.0.1":             "10.0.0.1",
+		"2001:db8:1:2:3:4:5:6": "2001:db8:1:2::/64",
+		"2001:db8:1:2::ffff":   "2001:db8:1:2::/64",
+		"fe80::1%eth0":         "fe80::/64",
+		"::ffff:10.0.0.1":      "::ffff:10.0.0.1",
+		"not an ip":            "not an ip",
+	}
+	for ip, expected := range cases {
+		if key := IPKey(ip); key != expected {
+			t.Errorf("Expected: %s for %s\nGot: %s", expected, ip, key)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redact
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Mask replaces the redacted values.
+const Mask = "******"
+
+// MinLength is the length of the shortest secret value that can be masked.
+// Shorter values would mask unrelated parts of every message.
+const MinLength = 6
+
+// Redactor masks secret values in parameters and log messages, so they
+// don't end up in events, logs or the web frontend. Parameters are also
+// masked when their name matches a sensitive pattern. A nil Redactor doesn't
+// mask anything.
+type Redactor struct {
+	mu       sync.RWMutex
+	values   map[string]bool
+	replacer *strings.Replacer
+	names    []string
+}
+
+// New returns an empty Redactor.
+func New() *Redactor {
+	return &Redactor{values: make(map[string]bool)}
+}
+
+// AddValue registers a secret value to be masked. Values shorter than
+// MinLength are refused.
+func (r *Redactor) AddValue(value string) error {
+	if r == nil || value == "" {
+		return nil
+	}
+	if len(value) < MinLength {
+		return fmt.Errorf("secret value shorter than %d characters", MinLength)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.values[value] {
+		return nil
+	}
+	r.values[value] = true
+
+	// The longest values go first, so a value containing another one is
+	// masked as a whole.
+	values := make([]string, 0, len(r.values))
+	for v := range r.values {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if len(values[i]) != len(values[j]) {
+			return len(values[i]) > len(values[j])
+		}
+		return values[i] < values[j]
+	})
+	pairs := make([]string, 0, 2*len(values))
+	for _, v := range values {
+		pairs = append(pairs, v, Mask)
+	}
+	r.replacer = strings.NewReplacer(pairs...)
+	return nil
+}
+
+// SetNames sets the patterns of the sensitive parameter names, such as
+// "*password*". Patterns use the syntax of path.Match and are matched case
+// insensitively.
+func (r *Redactor) SetNames(patterns []string) error {
+	names := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+		names = append(names, p)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.names = names
+	return nil
+}
+
+// IsSensitive reports whether the parameter name matches a sensitive
+// pattern.
+func (r *Redactor) IsSensitive(name string) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	name = strings.ToLower(name)
+	for _, p := range r.names {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns s with every secret value masked.
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.replacer == nil {
+		return s
+	}
+	return r.replacer.Replace(s)
+}
+
+// Params returns a copy of params with the values of sensitive parameters
+// and every secret value masked. Other values that aren't strings are kept
+// as they are.
+func (r *Redactor) Params(params map[string]interface{}) map[string]interface{} {
+	if r == nil || params == nil {
+		return params
+	}
+	ret := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		if r.IsSensitive(k) {
+			v = Mask
+		} else if s, ok := v.(string); ok {
+			v = r.String(s)
+		}
+		ret[k] = v
+	}
+	return ret
+}
+
+// URL returns u as a string with the values of sensitive query parameters
+// and every secret value masked.
+func (r *Redactor) URL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	if r == nil {
+		return u.String()
+	}
+	query := u.Query()
+	masked := false
+	for k := range query {
+		if r.IsSensitive(k) {
+			query[k] = []string{Mask}
+			masked = true
+		}
+	}
+	if !masked {
+		return r.String(u.String())
+	}
+	c := *u
+	c.RawQuery = strings.ReplaceAll(query.Encode(), url.QueryEscape(Mask), Mask)
+	return r.String(c.String())
+}
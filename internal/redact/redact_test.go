@@ -0,0 +1,107 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redact
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestRedactor(t *testing.T) {
+	r := New()
+	r.AddValue("hunter2")
+	r.AddValue("")
+
+	if got := r.String("user admin password hunter2"); got != "user admin password "+Mask {
+		t.Errorf("Expected: %q\nGot: %q", "user admin password "+Mask, got)
+	}
+
+	params := map[string]interface{}{"password": "hunter2", "hostname": "web1", "count": 2}
+	masked := r.Params(params)
+	if masked["password"] != Mask || masked["hostname"] != "web1" || masked["count"] != 2 {
+		t.Errorf("Expected: password masked and the rest untouched\nGot: %v", masked)
+	}
+	if params["password"] != "hunter2" {
+		t.Errorf("Expected: params not modified\nGot: %v", params)
+	}
+}
+
+func TestOverlappingValues(t *testing.T) {
+	r := New()
+	for _, v := range []string{"hunter2", "hunter2-admin", "admin-hunter2"} {
+		if err := r.AddValue(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.AddValue("pin1"); err == nil {
+		t.Errorf("Expected: error for a value shorter than %d characters\nGot: nil", MinLength)
+	}
+
+	expected := "a " + Mask + " b " + Mask + " c " + Mask + " pin1"
+	if got := r.String("a hunter2-admin b admin-hunter2 c hunter2 pin1"); got != expected {
+		t.Errorf("Expected: %q\nGot: %q", expected, got)
+	}
+}
+
+func TestNilRedactor(t *testing.T) {
+	var r *Redactor
+	r.AddValue("hunter2")
+	if got := r.String("hunter2"); got != "hunter2" {
+		t.Errorf("Expected: hunter2\nGot: %s", got)
+	}
+	params := map[string]interface{}{"password": "hunter2"}
+	if got := r.Params(params); got["password"] != "hunter2" {
+		t.Errorf("Expected: hunter2\nGot: %v", got["password"])
+	}
+}
+
+func TestSensitiveNames(t *testing.T) {
+	r := New()
+	if err := r.SetNames([]string{"*password*", " *TOKEN* ", ""}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetNames([]string{"[password"}); err == nil {
+		t.Error("Expected: error for invalid pattern\nGot: nil")
+	}
+
+	cases := map[string]bool{
+		"password":      true,
+		"rootPassword":  true,
+		"api_token":     true,
+		"hostname":      false,
+		"passwordless":  true,
+		"tokenizerMode": true,
+		"pass":          false,
+	}
+	for name, expected := range cases {
+		if got := r.IsSensitive(name); got != expected {
+			t.Errorf("Expected: %s sensitive %t\nGot: %t", name, expected, got)
+		}
+	}
+
+	masked := r.Params(map[string]interface{}{"rootPassword": "hunter2", "count": 2, "hostname": "web1"})
+	if masked["rootPassword"] != Mask || masked["count"] != 2 || masked["hostname"] != "web1" {
+		t.Errorf("Expected: rootPassword masked\nGot: %v", masked)
+	}
+
+	u, _ := url.Parse("/configs/kickstart/base?hostname=web1&rootPassword=hunter2")
+	if got := r.URL(u); got != "/configs/kickstart/base?hostname=web1&rootPassword=******" {
+		t.Errorf("Expected: rootPassword masked\nGot: %s", got)
+	}
+	u, _ = url.Parse("/configs/kickstart/base?hostname=web1")
+	if got := r.URL(u); got != "/configs/kickstart/base?hostname=web1" {
+		t.Errorf("Expected: URL untouched\nGot: %s", got)
+	}
+}
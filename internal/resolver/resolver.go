@@ -0,0 +1,193 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolver
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thousandeyes/shoelaces/internal/ttlcache"
+)
+
+// cacheSize is the maximum number of names and failures cached.
+const cacheSize = 10000
+
+// Resolver finds the hostname of booting hosts from their IP, first in an
+// optional static hosts file and then with a reverse DNS lookup. Lookups
+// taking longer than a timeout fail, and answers are cached for a while,
+// failures included, so a slow DNS server doesn't stall every poll. Up to
+// cacheSize answers are cached.
+type Resolver struct {
+	lookup      func(ctx context.Context, addr string) ([]string, error)
+	timeout     time.Duration
+	ttl         time.Duration
+	negativeTTL time.Duration
+	cache       *ttlcache.Cache[string]
+
+	mu     sync.Mutex
+	static map[string]string
+}
+
+// New returns a Resolver asking the DNS server at server, an address with an
+// optional port, or the system resolver if it's empty. Lookups taking longer
+// than timeout, if positive, fail. Names are cached for ttl and failures for
+// negativeTTL.
+func New(server string, timeout, ttl, negativeTTL time.Duration) (*Resolver, error) {
+	r := &Resolver{
+		lookup:      net.DefaultResolver.LookupAddr,
+		timeout:     timeout,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		cache:       ttlcache.New[string](cacheSize),
+	}
+	if server == "" {
+		return r, nil
+	}
+
+	addr, err := serverAddr(server)
+	if err != nil {
+		return nil, err
+	}
+	dns := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+	r.lookup = dns.LookupAddr
+	return r, nil
+}
+
+// serverAddr adds the DNS port to server if it has none.
+func serverAddr(server string) (string, error) {
+	if addr, err := netip.ParseAddr(server); err == nil {
+		return net.JoinHostPort(addr.String(), "53"), nil
+	}
+	if _, err := netip.ParseAddrPort(server); err == nil {
+		return server, nil
+	}
+	if host, port, err := net.SplitHostPort(server); err == nil && host != "" && port != "" {
+		return server, nil
+	}
+	if !strings.Contains(server, ":") {
+		return net.JoinHostPort(server, "53"), nil
+	}
+	return "", fmt.Errorf("invalid DNS server %q", server)
+}
+
+// LoadHosts reads a hosts file, in the /etc/hosts format, whose names are
+// used instead of asking the DNS server. The first name of each address is
+// used.
+func (r *Resolver) LoadHosts(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	static := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		addr, err := netip.ParseAddr(fields[0])
+		if err != nil || len(fields) < 2 {
+			return fmt.Errorf("%s:%d: invalid hosts line", path, n)
+		}
+		ip := addr.Unmap().WithZone("").String()
+		if _, ok := static[ip]; !ok {
+			static[ip] = normalize(fields[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.static = static
+	return nil
+}
+
+// Resolve returns the hostname of ip, lowercased and without trailing dot,
+// or an empty string if it has none. Link-local addresses, common for IPv6
+// hosts, have no PTR records and are only looked up in the hosts file.
+func (r *Resolver) Resolve(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	ip = addr.Unmap().WithZone("").String()
+
+	if name, ok := r.cached(ip); ok {
+		return name
+	}
+	if addr.IsLinkLocalUnicast() {
+		return ""
+	}
+
+	ctx := context.Background()
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	name := ""
+	if names, err := r.lookup(ctx, ip); err == nil {
+		for _, n := range names {
+			if name = normalize(n); name != "" {
+				break
+			}
+		}
+	}
+	r.store(ip, name)
+	return name
+}
+
+func (r *Resolver) cached(ip string) (string, bool) {
+	r.mu.Lock()
+	name, ok := r.static[ip]
+	r.mu.Unlock()
+	if ok {
+		return name, true
+	}
+	return r.cache.Get(ip, time.Now())
+}
+
+func (r *Resolver) store(ip string, name string) {
+	ttl := r.ttl
+	if name == "" {
+		ttl = r.negativeTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+	r.cache.Set(ip, name, ttl, time.Now())
+}
+
+func normalize(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
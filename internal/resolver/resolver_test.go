@@ -0,0 +1,234 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolver
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDNS is an in-process DNS server answering PTR queries from names.
+// Queries for the names in silent get no answer.
+type fakeDNS struct {
+	conn    net.PacketConn
+	names   map[string]string
+	silent  map[string]bool
+	mu      sync.Mutex
+	queries map[string]int
+}
+
+func newFakeDNS(t *testing.T, names map[string]string, silent ...string) *fakeDNS {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeDNS{conn: conn, names: names, silent: map[string]bool{}, queries: map[string]int{}}
+	for _, s := range silent {
+		f.silent[s] = true
+	}
+	t.Cleanup(func() { conn.Close() })
+	go f.serve()
+	return f
+}
+
+func (f *fakeDNS) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := f.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if answer := f.answer(buf[:n]); answer != nil {
+			f.conn.WriteTo(answer, addr)
+		}
+	}
+}
+
+// answer builds the reply to query, echoing its question.
+func (f *fakeDNS) answer(query []byte) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+	var labels []string
+	i := 12
+	for i < len(query) && query[i] != 0 {
+		l := int(query[i])
+		if i+1+l > len(query) {
+			return nil
+		}
+		labels = append(labels, string(query[i+1:i+1+l]))
+		i += 1 + l
+	}
+	end := i + 5 // zero label, type and class
+	if end > len(query) {
+		return nil
+	}
+	qname := strings.ToLower(strings.Join(labels, ".")) + "."
+
+	f.mu.Lock()
+	f.queries[qname]++
+	f.mu.Unlock()
+	if f.silent[qname] {
+		return nil
+	}
+
+	reply := append([]byte{}, query[:2]...)
+	name, ok := f.names[qname]
+	if binary.BigEndian.Uint16(query[i+1:]) != 12 {
+		ok = false
+	}
+	if ok {
+		reply = append(reply, 0x81, 0x80, 0, 1, 0, 1, 0, 0, 0, 0)
+	} else {
+		reply = append(reply, 0x81, 0x83, 0, 1, 0, 0, 0, 0, 0, 0)
+	}
+	reply = append(reply, query[12:end]...)
+	if ok {
+		var rdata []byte
+		for _, l := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+			rdata = append(rdata, byte(len(l)))
+			rdata = append(rdata, l...)
+		}
+		rdata = append(rdata, 0)
+		reply = append(reply, 0xc0, 12, 0, 12, 0, 1, 0, 0, 0, 60)
+		reply = binary.BigEndian.AppendUint16(reply, uint16(len(rdata)))
+		reply = append(reply, rdata...)
+	}
+	return reply
+}
+
+func (f *fakeDNS) count(qname string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.queries[qname]
+}
+
+func TestResolve(t *testing.T) {
+	dns := newFakeDNS(t, map[string]string{
+		"5.2.0.192.in-addr.arpa.": "Web01.Example.COM.",
+		"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.": "web02.example.com.",
+	})
+	r, err := New(dns.conn.LocalAddr().String(), time.Second, time.Minute, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"192.0.2.5":        "web01.example.com",
+		"::ffff:192.0.2.5": "web01.example.com",
+		"2001:db8::1":      "web02.example.com",
+		"192.0.2.6":        "",
+		"fe80::1":          "",
+		"not an ip":        "",
+	}
+	for ip, expected := range cases {
+		if name := r.Resolve(ip); name != expected {
+			t.Errorf("Expected: %q for %s\nGot: %q", expected, ip, name)
+		}
+	}
+
+	// Both names and failures are cached.
+	r.Resolve("192.0.2.5")
+	r.Resolve("192.0.2.6")
+	if n := dns.count("5.2.0.192.in-addr.arpa."); n != 1 {
+		t.Errorf("Expected: 1 query for a cached name\nGot: %d", n)
+	}
+	if n := dns.count("6.2.0.192.in-addr.arpa."); n != 1 {
+		t.Errorf("Expected: 1 query for a cached failure\nGot: %d", n)
+	}
+	if n := dns.count("1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.e.f.ip6.arpa."); n != 0 {
+		t.Errorf("Expected: no query for a link-local address\nGot: %d", n)
+	}
+}
+
+func TestResolveTimeout(t *testing.T) {
+	dns := newFakeDNS(t, map[string]string{}, "7.2.0.192.in-addr.arpa.")
+	r, err := New(dns.conn.LocalAddr().String(), 200*time.Millisecond, time.Minute, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if name := r.Resolve("192.0.2.7"); name != "" {
+		t.Errorf("Expected: no name\nGot: %q", name)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected: the lookup to time out\nGot: %v", elapsed)
+	}
+
+	start = time.Now()
+	r.Resolve("192.0.2.7")
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("Expected: the failure to be cached\nGot: %v", elapsed)
+	}
+}
+
+func TestLoadHosts(t *testing.T) {
+	dns := newFakeDNS(t, map[string]string{"5.2.0.192.in-addr.arpa.": "dns.example.com."})
+	r, err := New(dns.conn.LocalAddr().String(), time.Second, time.Minute, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hostsFile := filepath.Join(t.TempDir(), "hosts")
+	contents := "# static names\n192.0.2.5 web01.example.com web01\n192.0.2.5 other\n\nfe80::1%eth0 switch01. # link-local\n"
+	if err := os.WriteFile(hostsFile, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.LoadHosts(hostsFile); err != nil {
+		t.Fatal(err)
+	}
+
+	if name := r.Resolve("192.0.2.5"); name != "web01.example.com" {
+		t.Errorf("Expected: web01.example.com\nGot: %q", name)
+	}
+	if name := r.Resolve("fe80::1"); name != "switch01" {
+		t.Errorf("Expected: switch01\nGot: %q", name)
+	}
+	if n := dns.count("5.2.0.192.in-addr.arpa."); n != 0 {
+		t.Errorf("Expected: no query for a static name\nGot: %d", n)
+	}
+
+	if err := os.WriteFile(hostsFile, []byte("web01\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.LoadHosts(hostsFile); err == nil {
+		t.Error("Expected: error for invalid hosts line\nGot: nil")
+	}
+}
+
+func TestServerAddr(t *testing.T) {
+	cases := map[string]string{
+		"192.0.2.53":          "192.0.2.53:53",
+		"192.0.2.53:5353":     "192.0.2.53:5353",
+		"2001:db8::53":        "[2001:db8::53]:53",
+		"[2001:db8::53]:5353": "[2001:db8::53]:5353",
+		"dns.example.com":     "dns.example.com:53",
+	}
+	for server, expected := range cases {
+		if addr, err := serverAddr(server); err != nil || addr != expected {
+			t.Errorf("Expected: %s for %s\nGot: %s, %v", expected, server, addr, err)
+		}
+	}
+	if _, err := New("[2001:db8::53", time.Second, 0, 0); err == nil {
+		t.Error("Expected: error for invalid server\nGot: nil")
+	}
+}
@@ -32,22 +32,52 @@ func ShoelacesRouter(env *environment.Environment) http.Handler {
 	mux.Handle("GET /{$}", handlers.RenderDefaultTemplate("index"))
 	mux.Handle("GET /events", handlers.RenderDefaultTemplate("events"))
 	mux.Handle("GET /mappings", handlers.RenderDefaultTemplate("mappings"))
+	mux.Handle("GET /pending", handlers.RenderDefaultTemplate("pending"))
+	mux.Handle("GET /downloads", handlers.RenderDefaultTemplate("downloads"))
+	mux.Handle("GET /assets", handlers.RenderDefaultTemplate("assets"))
 	mux.Handle("GET /static/", staticFiles)
 
 	// UI JSON endpoints and manual boot selection.
-	mux.HandleFunc("POST /update/target", handlers.UpdateTargetHandler)
+	mux.Handle("POST /update/target", handlers.CSRFCheck(http.HandlerFunc(handlers.UpdateTargetHandler)))
+	mux.Handle("POST /update/targets", handlers.CSRFCheck(http.HandlerFunc(handlers.UpdateTargetsHandler)))
+	mux.Handle("POST /update/pending", handlers.CSRFCheck(http.HandlerFunc(handlers.UpdatePendingHandler)))
+	mux.Handle("POST /cancel/pending", handlers.CSRFCheck(http.HandlerFunc(handlers.CancelPendingHandler)))
 	mux.HandleFunc("GET /ajax/servers", handlers.ServerListHandler)
+	mux.HandleFunc("GET /ajax/pending", handlers.PendingListHandler)
 	mux.HandleFunc("GET /ajax/events", handlers.ListEvents)
+	mux.HandleFunc("GET /ajax/timelines", handlers.ListTimelines)
+	mux.HandleFunc("GET /ajax/assets", handlers.ListAssets)
 	mux.HandleFunc("GET /ajax/script/params", handlers.GetTemplateParams)
 
 	// Static and templated configuration files served to booting hosts.
-	mux.Handle("GET /configs/static/", staticConfigs)
-	mux.Handle("GET /configs/", dynamicConfigs)
+	mux.Handle("GET /configs/static/", handlers.BootSourceCheck(handlers.DownloadTracker("/configs/", handlers.SignatureCheck("/configs/", staticConfigs))))
+	mux.Handle("GET /configs/", handlers.BootSourceCheck(handlers.DownloadTracker("/configs/", handlers.SignatureCheck("/configs/", dynamicConfigs))))
+
+	// Installer files of the upstream mirrors, cached.
+	cachedFiles := http.StripPrefix("/cache/", http.HandlerFunc(handlers.CacheHandler))
+	mux.Handle("GET /cache/", handlers.BootSourceCheck(handlers.DownloadTracker("/cache/", cachedFiles)))
+
+	// Verified files of the assets of assets.yaml.
+	assetFiles := http.StripPrefix("/assets/", http.HandlerFunc(handlers.AssetHandler))
+	mux.Handle("GET /assets/", handlers.BootSourceCheck(handlers.DownloadTracker("/assets/", assetFiles)))
 
 	// iPXE boot endpoints.
-	mux.HandleFunc("GET /start", handlers.StartPollingHandler)
-	mux.HandleFunc("GET /poll/1/{mac}", handlers.PollHandler)
-	mux.HandleFunc("GET /ipxemenu", handlers.IPXEMenu)
+	mux.Handle("GET /start", bootHandler(handlers.StartPollingHandler))
+	mux.Handle("GET /poll/1/{mac}", bootHandler(handlers.PollHandler))
+	mux.Handle("GET /ipxemenu", bootHandler(handlers.IPXEMenu))
+
+	// iPXE binaries and boot images, to start booting from Shoelaces.
+	mux.HandleFunc("GET /ipxe/{file}", handlers.IPXEBinary)
+
+	// Installation progress reported by installers and booted hosts.
+	callback := handlers.BootSourceCheck(handlers.RateLimit(http.HandlerFunc(handlers.CallbackHandler)))
+	mux.Handle("GET /callback/{mac}/{phase}", callback)
+	mux.Handle("POST /callback/{mac}/{phase}", callback)
 
 	return mux
 }
+
+// bootHandler restricts and rate limits an iPXE boot endpoint.
+func bootHandler(h http.HandlerFunc) http.Handler {
+	return handlers.BootSourceCheck(handlers.BootRateLimit(h))
+}
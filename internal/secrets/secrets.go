@@ -0,0 +1,215 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"gopkg.in/yaml.v3"
+
+	"github.com/thousandeyes/shoelaces/internal/redact"
+)
+
+// EnvPrefix is prepended to the names of the secrets looked up as
+// environment variables.
+const EnvPrefix = "SHOELACES_SECRET_"
+
+const (
+	keySize   = 32
+	nonceSize = 24
+)
+
+// Provider looks up secrets by name. Lookup returns false if the provider
+// doesn't know the secret. Values returns every secret value known upfront,
+// so they are masked even before being used.
+type Provider interface {
+	Name() string
+	Lookup(name string) (string, bool, error)
+	Values() []string
+}
+
+// Store asks its providers, in order, for secrets. Every value it returns
+// is registered in its Redactor.
+type Store struct {
+	providers []Provider
+	redactor  *redact.Redactor
+}
+
+// NewStore returns a Store asking providers in order. It fails if a value
+// known upfront is too short to be masked.
+func NewStore(redactor *redact.Redactor, providers ...Provider) (*Store, error) {
+	s := &Store{providers: providers, redactor: redactor}
+	for _, p := range providers {
+		for _, v := range p.Values() {
+			if err := redactor.AddValue(v); err != nil {
+				return nil, fmt.Errorf("%s: %w", p.Name(), err)
+			}
+		}
+	}
+	return s, nil
+}
+
+// Secret is a template function returning the value of the secret name,
+// e.g. {{ secret "root-password" }}. It fails if no provider knows it.
+func (s *Store) Secret(name string) (string, error) {
+	if s != nil {
+		for _, p := range s.providers {
+			value, ok, err := p.Lookup(name)
+			if err != nil {
+				return "", fmt.Errorf("secret %s: %s: %w", name, p.Name(), err)
+			}
+			if ok {
+				if err := s.redactor.AddValue(value); err != nil {
+					return "", fmt.Errorf("secret %s: %s: %w", name, p.Name(), err)
+				}
+				return value, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("unknown secret %s", name)
+}
+
+// Env is a Provider reading secrets from environment variables, named after
+// the secret with EnvPrefix, in uppercase and with dashes and dots replaced
+// by underscores, e.g. SHOELACES_SECRET_ROOT_PASSWORD for root-password.
+type Env struct{}
+
+// Name implements Provider.
+func (Env) Name() string {
+	return "env"
+}
+
+// Lookup implements Provider.
+func (Env) Lookup(name string) (string, bool, error) {
+	value, ok := os.LookupEnv(EnvVar(name))
+	return value, ok, nil
+}
+
+// Values implements Provider.
+func (Env) Values() []string {
+	values := make([]string, 0)
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok && strings.HasPrefix(k, EnvPrefix) {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// EnvVar returns the environment variable holding the secret name.
+func EnvVar(name string) string {
+	return EnvPrefix + strings.NewReplacer("-", "_", ".", "_").Replace(strings.ToUpper(name))
+}
+
+// File is a Provider reading secrets from a YAML map of names and values,
+// encrypted with NaCl secretbox. The file holds the nonce followed by the
+// encrypted map.
+type File struct {
+	secrets map[string]string
+}
+
+// LoadFile decrypts the secrets file at path with key, a base64-encoded 32
+// bytes key.
+func LoadFile(path string, key string) (*File, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := Decrypt(contents, key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	f := &File{secrets: make(map[string]string)}
+	if err := yaml.Unmarshal(plain, &f.secrets); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
+
+// Name implements Provider.
+func (f *File) Name() string {
+	return "file"
+}
+
+// Lookup implements Provider.
+func (f *File) Lookup(name string) (string, bool, error) {
+	value, ok := f.secrets[name]
+	return value, ok, nil
+}
+
+// Values implements Provider.
+func (f *File) Values() []string {
+	values := make([]string, 0, len(f.secrets))
+	for _, v := range f.secrets {
+		values = append(values, v)
+	}
+	return values
+}
+
+// GenerateKey returns a new random key, encoded in base64.
+func GenerateKey() (string, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// Encrypt encrypts plain with key, a base64-encoded 32 bytes key.
+func Encrypt(plain []byte, key string) ([]byte, error) {
+	k, err := decodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	var nonce [nonceSize]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	return secretbox.Seal(nonce[:], plain, &nonce, k), nil
+}
+
+// Decrypt decrypts data encrypted by Encrypt with the same key.
+func Decrypt(data []byte, key string) ([]byte, error) {
+	k, err := decodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < nonceSize+secretbox.Overhead {
+		return nil, errors.New("invalid secrets file")
+	}
+	var nonce [nonceSize]byte
+	copy(nonce[:], data[:nonceSize])
+	plain, ok := secretbox.Open(nil, data[nonceSize:], &nonce, k)
+	if !ok {
+		return nil, errors.New("can't decrypt secrets, wrong key or corrupted file")
+	}
+	return plain, nil
+}
+
+func decodeKey(key string) (*[keySize]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil || len(raw) != keySize {
+		return nil, errors.New("the secrets key must be 32 bytes encoded in base64")
+	}
+	var k [keySize]byte
+	copy(k[:], raw)
+	return &k, nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thousandeyes/shoelaces/internal/redact"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Encrypt([]byte("root-password: hunter2\n"), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := Decrypt(data, key)
+	if err != nil || string(plain) != "root-password: hunter2\n" {
+		t.Errorf("Expected: decrypted contents\nGot: %q, %v", plain, err)
+	}
+
+	other, _ := GenerateKey()
+	if _, err := Decrypt(data, other); err == nil {
+		t.Error("Expected: error for wrong key\nGot: nil")
+	}
+	if _, err := Encrypt(data, "short"); err == nil {
+		t.Error("Expected: error for invalid key\nGot: nil")
+	}
+}
+
+func TestEnvVar(t *testing.T) {
+	if got := EnvVar("root-password.v2"); got != "SHOELACES_SECRET_ROOT_PASSWORD_V2" {
+		t.Errorf("Expected: SHOELACES_SECRET_ROOT_PASSWORD_V2\nGot: %s", got)
+	}
+}
+
+func TestStore(t *testing.T) {
+	key, _ := GenerateKey()
+	data, _ := Encrypt([]byte("root-password: from-file\napi-token: token-file\n"), key)
+	path := filepath.Join(t.TempDir(), "secrets.enc")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := LoadFile(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("SHOELACES_SECRET_ROOT_PASSWORD", "from-env")
+	r := redact.New()
+	s, err := NewStore(r, Env{}, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := r.String("from-env token-file"); got != redact.Mask+" "+redact.Mask {
+		t.Errorf("Expected: secret values masked before being used\nGot: %s", got)
+	}
+
+	if v, err := s.Secret("root-password"); err != nil || v != "from-env" {
+		t.Errorf("Expected: from-env\nGot: %s, %v", v, err)
+	}
+	if v, err := s.Secret("api-token"); err != nil || v != "token-file" {
+		t.Errorf("Expected: token-file\nGot: %s, %v", v, err)
+	}
+	if _, err := s.Secret("missing"); err == nil {
+		t.Error("Expected: error for unknown secret\nGot: nil")
+	}
+
+	if got := r.String("from-env from-file token-file"); got != redact.Mask+" "+redact.Mask+" "+redact.Mask {
+		t.Errorf("Expected: every secret value masked\nGot: %s", got)
+	}
+}
+
+func TestShortSecret(t *testing.T) {
+	key, _ := GenerateKey()
+	data, _ := Encrypt([]byte("pin: 1234\n"), key)
+	path := filepath.Join(t.TempDir(), "secrets.enc")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := LoadFile(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewStore(redact.New(), f); err == nil {
+		t.Error("Expected: error for a secret too short to be masked\nGot: nil")
+	}
+
+	s, err := NewStore(redact.New(), Env{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SHOELACES_SECRET_PIN", "1234")
+	if _, err := s.Secret("pin"); err == nil {
+		t.Error("Expected: error for a secret too short to be masked\nGot: nil")
+	}
+}
@@ -31,6 +31,8 @@ type Server struct {
 	Mac      string
 	IP       string
 	Hostname string
+	Serial   string `json:",omitempty"`
+	UUID     string `json:",omitempty"`
 }
 
 // Servers is an array of Server
@@ -61,11 +63,43 @@ type State struct {
 	LastAccess  int
 }
 
+// Assignment holds a script assigned to a host before it polls. It's
+// consumed the next time the host polls.
+type Assignment struct {
+	Mac         string
+	Target      string
+	Environment string
+	Params      map[string]interface{}
+	Created     time.Time
+}
+
+// Assignments is an array of Assignment
+type Assignments []Assignment
+
+// Len implementation for the sort Interface
+func (a Assignments) Len() int {
+	return len(a)
+}
+
+// Swap implementation for the sort interface
+func (a Assignments) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+
+// Less implementation for the Sort interface
+func (a Assignments) Less(i, j int) bool {
+	return a[i].Mac < a[j].Mac
+}
+
 // States holds a map between MAC addresses and
-// States. It provides a mutex for thread-safety.
+// States, and the pending assignments of hosts that didn't poll yet.
+// It provides a mutex for thread-safety. MaxServers caps the number of
+// waiting hosts, 0 means no limit.
 type States struct {
 	sync.RWMutex
-	Servers map[string]*State
+	Servers    map[string]*State
+	Pending    map[string]*Assignment
+	MaxServers int
 }
 
 // New returns a Server with is values initialized
@@ -87,11 +121,37 @@ func (m *States) AddServer(server Server) {
 	}
 }
 
+// Full reports whether the States struct reached MaxServers, so no more
+// servers should be added.
+func (m *States) Full() bool {
+	return m.MaxServers > 0 && len(m.Servers) >= m.MaxServers
+}
+
 // DeleteServer deletes a server from the States struct
 func (m *States) DeleteServer(mac string) {
 	delete(m.Servers, mac)
 }
 
+// AddPending adds an assignment to the States struct, replacing the
+// previous one for the same MAC, if any.
+func (m *States) AddPending(a Assignment) {
+	if m.Pending == nil {
+		m.Pending = make(map[string]*Assignment)
+	}
+	a.Created = time.Now().UTC()
+	m.Pending[a.Mac] = &a
+}
+
+// DeletePending deletes an assignment from the States struct. It returns
+// false if there was no assignment for the MAC.
+func (m *States) DeletePending(mac string) bool {
+	if _, ok := m.Pending[mac]; !ok {
+		return false
+	}
+	delete(m.Pending, mac)
+	return true
+}
+
 // StartStateCleaner spawns a goroutine that cleans MAC addresses that
 // have been inactive in Shoelaces for more than 3 minutes.
 func StartStateCleaner(logger log.Logger, serverStates *States) {
@@ -0,0 +1,160 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thousandeyes/shoelaces/internal/utils"
+)
+
+// Query parameters added to signed URLs.
+const (
+	MacParam       = "mac"
+	ExpiresParam   = "expires"
+	SignatureParam = "signature"
+)
+
+// Signer signs and verifies config URLs with HMAC-SHA256, so they are bound
+// to a MAC address and expire after a while.
+type Signer struct {
+	key   []byte
+	ttl   time.Duration
+	paths []string
+}
+
+// New returns a Signer using key, whose URLs are valid for ttl. Paths are
+// config names, or directories if they end with a slash, that can only be
+// downloaded with a valid signature.
+func New(key string, ttl time.Duration, paths []string) (*Signer, error) {
+	if key == "" {
+		return nil, errors.New("empty signing key")
+	}
+	if ttl <= 0 {
+		return nil, errors.New("signed URLs TTL must be positive")
+	}
+	return &Signer{key: []byte(key), ttl: ttl, paths: paths}, nil
+}
+
+// Required returns true if the config named name needs a valid signature.
+func (s *Signer) Required(name string) bool {
+	if s == nil {
+		return false
+	}
+	name = strings.TrimPrefix(name, "/")
+	for _, p := range s.paths {
+		if p == name || (strings.HasSuffix(p, "/") && strings.HasPrefix(name, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign returns a copy of query with the mac, expiration date and signature
+// for the URL path.
+func (s *Signer) Sign(path string, query url.Values, mac string, now time.Time) url.Values {
+	signed := url.Values{}
+	for k, v := range query {
+		signed[k] = append([]string(nil), v...)
+	}
+	signed.Set(MacParam, mac)
+	signed.Set(ExpiresParam, strconv.FormatInt(now.Add(s.ttl).Unix(), 10))
+	signed.Del(SignatureParam)
+	signed.Set(SignatureParam, s.signature(path, signed))
+	return signed
+}
+
+// Verify checks that query holds a valid, not expired, signature for the URL
+// path.
+func (s *Signer) Verify(path string, query url.Values, now time.Time) error {
+	sig := query.Get(SignatureParam)
+	if sig == "" {
+		return errors.New("missing signature")
+	}
+	if query.Get(MacParam) == "" {
+		return errors.New("missing mac")
+	}
+	expires, err := strconv.ParseInt(query.Get(ExpiresParam), 10, 64)
+	if err != nil {
+		return errors.New("invalid expiration date")
+	}
+
+	unsigned := url.Values{}
+	for k, v := range query {
+		if k != SignatureParam {
+			unsigned[k] = v
+		}
+	}
+	if !hmac.Equal([]byte(sig), []byte(s.signature(path, unsigned))) {
+		return errors.New("invalid signature")
+	}
+	if now.Unix() > expires {
+		return errors.New("expired signature")
+	}
+	return nil
+}
+
+// signature returns the signature of the path and the query, without the
+// signature parameter. Query parameters are encoded sorted by key.
+func (s *Signer) signature(path string, query url.Values) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(path))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(query.Encode()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignedURL is a template function returning the URL of the config named
+// name, signed for the mac template variable and the optional key and value
+// pairs of query parameters, e.g.:
+//
+//	{{ signedURL . "kickstart/base" "role" "web" }}
+//
+// The URL is built with the baseURL template variable. It isn't signed if
+// there is no Signer.
+func (s *Signer) SignedURL(params map[string]interface{}, name string, pairs ...string) (string, error) {
+	if len(pairs)%2 != 0 {
+		return "", errors.New("signedURL: odd number of query parameters")
+	}
+	mac, ok := params[MacParam].(string)
+	if !ok || mac == "" {
+		return "", errors.New("signedURL: missing mac variable")
+	}
+	baseURL, _ := params["baseURL"].(string)
+	u, err := utils.BaseURLJoin(baseURL, "/configs/"+strings.TrimPrefix(name, "/"))
+	if err != nil {
+		return "", fmt.Errorf("signedURL: %w", err)
+	}
+
+	query := url.Values{}
+	for i := 0; i < len(pairs); i += 2 {
+		query.Add(pairs[i], pairs[i+1])
+	}
+	if s == nil {
+		query.Set(MacParam, mac)
+	} else {
+		query = s.Sign(u.Path, query, mac, time.Now())
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
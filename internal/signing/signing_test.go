@@ -0,0 +1,126 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signing
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testMac = "06:66:de:ad:be:ef"
+
+func TestNew(t *testing.T) {
+	if _, err := New("", time.Hour, nil); err == nil {
+		t.Error("Expected: error for empty key\nGot: nil")
+	}
+	if _, err := New("secret", 0, nil); err == nil {
+		t.Error("Expected: error for zero TTL\nGot: nil")
+	}
+}
+
+func TestRequired(t *testing.T) {
+	s, _ := New("secret", time.Hour, []string{"kickstart/", "preseeds/ubuntu"})
+	cases := map[string]bool{
+		"kickstart/base":       true,
+		"/kickstart/base":      true,
+		"preseeds/ubuntu":      true,
+		"preseeds/ubuntu-mini": false,
+		"kickstart":            false,
+		"static/rc.local":      false,
+	}
+	for name, expected := range cases {
+		if got := s.Required(name); got != expected {
+			t.Errorf("Expected: %v for %s\nGot: %v", expected, name, got)
+		}
+	}
+	var nilSigner *Signer
+	if nilSigner.Required("kickstart/base") {
+		t.Error("Expected: no signature required without signer\nGot: required")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	s, _ := New("secret", time.Hour, nil)
+	now := time.Now()
+	path := "/env/prod/configs/kickstart/base"
+	signed := s.Sign(path, url.Values{"role": {"web"}}, testMac, now)
+
+	if err := s.Verify(path, signed, now); err != nil {
+		t.Errorf("Expected: valid signature\nGot: %v", err)
+	}
+	if err := s.Verify(path, signed, now.Add(2*time.Hour)); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("Expected: expired signature\nGot: %v", err)
+	}
+	if err := s.Verify("/configs/kickstart/base", signed, now); err == nil {
+		t.Error("Expected: invalid signature for another path\nGot: nil")
+	}
+
+	tampered := url.Values{}
+	for k, v := range signed {
+		tampered[k] = v
+	}
+	tampered.Set("mac", "06:66:de:ad:be:00")
+	if err := s.Verify(path, tampered, now); err == nil {
+		t.Error("Expected: invalid signature for another MAC\nGot: nil")
+	}
+	tampered = url.Values{}
+	for k, v := range signed {
+		tampered[k] = v
+	}
+	tampered.Set("role", "db")
+	if err := s.Verify(path, tampered, now); err == nil {
+		t.Error("Expected: invalid signature for other params\nGot: nil")
+	}
+
+	other, _ := New("other", time.Hour, nil)
+	if err := other.Verify(path, signed, now); err == nil {
+		t.Error("Expected: invalid signature for another key\nGot: nil")
+	}
+	if err := s.Verify(path, url.Values{"mac": {testMac}}, now); err == nil {
+		t.Error("Expected: missing signature\nGot: nil")
+	}
+}
+
+func TestSignedURL(t *testing.T) {
+	s, _ := New("secret", time.Hour, nil)
+	params := map[string]interface{}{"baseURL": "localhost:8081/env/prod", "mac": testMac}
+
+	raw, err := s.SignedURL(params, "kickstart/base", "role", "web")
+	if err != nil {
+		t.Fatalf("Expected: no error\nGot: %v", err)
+	}
+	u, _ := url.Parse(raw)
+	if u.Host != "localhost:8081" || u.Path != "/env/prod/configs/kickstart/base" {
+		t.Errorf("Expected: URL of kickstart/base in prod\nGot: %s", raw)
+	}
+	if err := s.Verify(u.Path, u.Query(), time.Now()); err != nil {
+		t.Errorf("Expected: valid signature\nGot: %v", err)
+	}
+
+	if _, err := s.SignedURL(map[string]interface{}{"baseURL": "localhost"}, "kickstart/base"); err == nil {
+		t.Error("Expected: error without mac\nGot: nil")
+	}
+	if _, err := s.SignedURL(params, "kickstart/base", "role"); err == nil {
+		t.Error("Expected: error for odd query parameters\nGot: nil")
+	}
+
+	var nilSigner *Signer
+	raw, _ = nilSigner.SignedURL(params, "kickstart/base")
+	if raw != "http://localhost:8081/env/prod/configs/kickstart/base?mac=06%3A66%3Ade%3Aad%3Abe%3Aef" {
+		t.Errorf("Expected: unsigned URL\nGot: %s", raw)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templates
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// ContentTypeDirective starts the first line of the templates declaring the
+// content type of their output, e.g. "#content-type: text/cloud-config".
+// The line is removed from the output.
+const ContentTypeDirective = "#content-type:"
+
+const cloudConfigHeader = "#cloud-config"
+
+// contentTypes holds the content types of the templates named after the
+// files they produce, by extension.
+var contentTypes = map[string]string{
+	".ign":     "application/json",
+	".bu":      "application/json", // Served transpiled to Ignition
+	".json":    "application/json",
+	".ipxe":    "text/plain; charset=utf-8",
+	".ks":      "text/plain; charset=utf-8",
+	".cfg":     "text/plain; charset=utf-8",
+	".preseed": "text/plain; charset=utf-8",
+	".yaml":    "application/yaml",
+	".yml":     "application/yaml",
+}
+
+// ContentType returns the content type of a rendered template, and its
+// output without the content type directive. The content type is, in order
+// of precedence:
+//
+//   - the one given by the directive on the first line of the output
+//   - text/cloud-config if the output starts with #cloud-config
+//   - the one of the extension of the template name, e.g. application/json
+//     for .ign templates
+//   - application/json if the output is a JSON object
+//   - the one detected from the output
+func ContentType(name, rendered string) (string, string, error) {
+	first, rest, _ := strings.Cut(rendered, "\n")
+	if len(first) >= len(ContentTypeDirective) && strings.EqualFold(first[:len(ContentTypeDirective)], ContentTypeDirective) {
+		contentType := strings.TrimSpace(first[len(ContentTypeDirective):])
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			return "", "", fmt.Errorf("invalid content type %q: %w", contentType, err)
+		}
+		return contentType, rest, nil
+	}
+
+	if strings.HasPrefix(rendered, cloudConfigHeader) {
+		return "text/cloud-config", rendered, nil
+	}
+	if contentType, ok := contentTypes[path.Ext(name)]; ok {
+		return contentType, rendered, nil
+	}
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		return contentType, rendered, nil
+	}
+	if strings.HasPrefix(strings.TrimSpace(rendered), "{") && json.Valid([]byte(rendered)) {
+		return "application/json", rendered, nil
+	}
+	return http.DetectContentType([]byte(rendered)), rendered, nil
+}
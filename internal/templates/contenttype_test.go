@@ -0,0 +1,50 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templates
+
+import (
+	"testing"
+)
+
+func TestContentType(t *testing.T) {
+	for _, c := range []struct {
+		name, rendered string
+		contentType    string
+		body           string
+	}{
+		{"flatcar.ign", `{"ignition": {}}`, "application/json", `{"ignition": {}}`},
+		{"ignition/flatcar", "{\n  \"ignition\": {}\n}\n", "application/json", "{\n  \"ignition\": {}\n}\n"},
+		{"worker.bu", "{\n  \"ignition\": {}\n}\n", "application/json", "{\n  \"ignition\": {}\n}\n"},
+		{"flatcar.ipxe", "#!ipxe\nboot\n", "text/plain; charset=utf-8", "#!ipxe\nboot\n"},
+		{"kickstart/alma.ks", "text\n", "text/plain; charset=utf-8", "text\n"},
+		{"talos.yaml", "version: v1alpha1\n", "application/yaml", "version: v1alpha1\n"},
+		{"user-data.yaml", "#cloud-config\nhostname: a\n", "text/cloud-config", "#cloud-config\nhostname: a\n"},
+		{"user-data", "#cloud-config\n", "text/cloud-config", "#cloud-config\n"},
+		{"index.html", "<p>a</p>", "text/html; charset=utf-8", "<p>a</p>"},
+		{"preseeds/ubuntu", "d-i debian-installer/locale string en_US\n", "text/plain; charset=utf-8", "d-i debian-installer/locale string en_US\n"},
+		{"ignition/flatcar", "#content-type: application/vnd.coreos.ignition+json\n{}", "application/vnd.coreos.ignition+json", "{}"},
+		{"user-data", "#Content-Type: text/cloud-config\r\nhostname: a\n", "text/cloud-config", "hostname: a\n"},
+		{"a.ipxe", "#content-type: text/plain\n", "text/plain", ""},
+	} {
+		contentType, body, err := ContentType(c.name, c.rendered)
+		if err != nil || contentType != c.contentType || body != c.body {
+			t.Errorf("Expected: %q %q for %s\nGot: %q %q %v", c.contentType, c.body, c.name, contentType, body, err)
+		}
+	}
+
+	if _, _, err := ContentType("a", "#content-type: not a type\nbody"); err == nil {
+		t.Error("Expected an error for an invalid content type directive")
+	}
+}
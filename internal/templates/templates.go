@@ -18,39 +18,47 @@ import (
 	"bufio"
 	"bytes"
 	"errors"
+	"fmt"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"text/template"
 
 	"github.com/thousandeyes/shoelaces/internal/log"
+	"github.com/thousandeyes/shoelaces/internal/overrides"
 	"github.com/thousandeyes/shoelaces/internal/utils"
 )
 
-const defaultEnvironment = "default"
+const defaultEnvironment = overrides.Default
 
 var varRegex = regexp.MustCompile(`{{\.(.*?)}}`)
 var configNameRegex = regexp.MustCompile(`{{define\s+"(.*?)".*}}`)
+var configRefRegex = regexp.MustCompile(`{{-?\s*\.baseURL\s*-?}}/configs/([^\s"'<>{}?]*)`)
 
 // ShoelacesTemplates holds the core attributes for handling the dyanmic configurations
 // in Shoelaces.
 type ShoelacesTemplates struct {
 	envTemplates map[string]shoelacesTemplateEnvironment
+	envTree      *overrides.Tree
 	dataDir      string
 	envDir       string
 	tplExt       string
 }
 
 type shoelacesTemplateEnvironment struct {
-	templateObj  *template.Template
-	templateVars map[string][]string
+	templateObj     *template.Template
+	templateVars    map[string][]string
+	templateFormats map[string]string
+	templateRefs    map[string][]string
 }
 
 type shoelacesTemplateInfo struct {
 	name      string
 	variables []string
+	refs      []string
 }
 
 // New creates and initializes a new ShoelacesTemplates instance a returns a pointer to
@@ -58,12 +66,20 @@ type shoelacesTemplateInfo struct {
 func New() *ShoelacesTemplates {
 	e := make(map[string]shoelacesTemplateEnvironment)
 	e[defaultEnvironment] = shoelacesTemplateEnvironment{
-		templateObj:  template.New(""),
-		templateVars: make(map[string][]string),
+		templateObj:     template.New(""),
+		templateVars:    make(map[string][]string),
+		templateFormats: make(map[string]string),
+		templateRefs:    make(map[string][]string),
 	}
 	return &ShoelacesTemplates{envTemplates: e}
 }
 
+// Funcs adds functions to the ones available in the templates. It must be
+// called before ParseTemplates.
+func (s *ShoelacesTemplates) Funcs(funcs map[string]interface{}) {
+	s.envTemplates[defaultEnvironment].templateObj.Funcs(funcs)
+}
+
 func (s *ShoelacesTemplates) parseTemplateInfo(logger log.Logger, path string) shoelacesTemplateInfo {
 	fh, err := os.Open(path)
 	if err != nil {
@@ -74,6 +90,7 @@ func (s *ShoelacesTemplates) parseTemplateInfo(logger log.Logger, path string) s
 	defer fh.Close()
 
 	templateVars := make([]string, 0)
+	var refs []string
 	scanner := bufio.NewScanner(fh)
 	templateName := ""
 	i := 0
@@ -88,6 +105,12 @@ func (s *ShoelacesTemplates) parseTemplateInfo(logger log.Logger, path string) s
 				}
 			}
 		}
+		// find the configs linked with baseURL
+		for _, v := range configRefRegex.FindAllStringSubmatch(scanner.Text(), -1) {
+			if !utils.StringInSlice(v[1], refs) {
+				refs = append(refs, v[1])
+			}
+		}
 		// if first line get name of template
 		if i == 0 {
 			nameResult := configNameRegex.FindAllStringSubmatch(scanner.Text(), -1)
@@ -96,47 +119,44 @@ func (s *ShoelacesTemplates) parseTemplateInfo(logger log.Logger, path string) s
 		i++
 	}
 
-	return shoelacesTemplateInfo{name: templateName, variables: templateVars}
+	return shoelacesTemplateInfo{name: templateName, variables: templateVars, refs: refs}
 }
 
-func (s *ShoelacesTemplates) checkAddEnvironment(logger log.Logger, environment string) {
-	if _, ok := s.envTemplates[environment]; !ok {
-		c, e := s.envTemplates[defaultEnvironment].templateObj.Clone()
-		if e != nil {
-			logger.Error("template for environment already executed", "component", "template", "environment", environment)
-			os.Exit(1)
-		}
-		s.envTemplates[environment] = shoelacesTemplateEnvironment{
-			templateObj:  c,
-			templateVars: make(map[string][]string),
-		}
+// addEnvironment creates the template set of an environment as a copy of
+// the one of its parent, so every template not overridden is inherited.
+func (s *ShoelacesTemplates) addEnvironment(logger log.Logger, environment string, parent string) {
+	c, e := s.envTemplates[parent].templateObj.Clone()
+	if e != nil {
+		logger.Error("template for environment already executed", "component", "template", "environment", parent)
+		os.Exit(1)
+	}
+	s.envTemplates[environment] = shoelacesTemplateEnvironment{
+		templateObj:     c,
+		templateVars:    make(map[string][]string),
+		templateFormats: make(map[string]string),
+		templateRefs:    make(map[string][]string),
 	}
 }
 
-func (s *ShoelacesTemplates) addTemplate(logger log.Logger, path string, environment string) error {
-	s.checkAddEnvironment(logger, environment)
-	i := s.parseTemplateInfo(logger, path)
-	_, err := s.envTemplates[environment].templateObj.ParseFiles(path)
+func (s *ShoelacesTemplates) addTemplate(logger log.Logger, p string, environment string) error {
+	i := s.parseTemplateInfo(logger, p)
+	_, err := s.envTemplates[environment].templateObj.ParseFiles(p)
 	if err != nil {
 		return err
 	}
 	s.envTemplates[environment].templateVars[i.name] = i.variables
+	s.envTemplates[environment].templateRefs[i.name] = i.refs
+	s.envTemplates[environment].templateFormats[i.name] = path.Ext(strings.TrimSuffix(filepath.Base(p), s.tplExt))
 	return nil
 }
 
-func (s *ShoelacesTemplates) getEnvFromPath(path string) string {
-	envPath := filepath.Join(s.dataDir, s.envDir)
-	if strings.HasPrefix(path, envPath) {
-		return strings.Split(strings.TrimPrefix(path, envPath), "/")[1]
-	}
-	return defaultEnvironment
-}
-
 // ParseTemplates travels the dataDir and loads in an internal structure
-// all the templates found.
-func (s *ShoelacesTemplates) ParseTemplates(logger log.Logger, dataDir string, envDir string, envs []string, tplExt string) {
+// all the templates found. Environment overrides are parsed after the
+// environment they inherit from.
+func (s *ShoelacesTemplates) ParseTemplates(logger log.Logger, dataDir string, envDir string, envTree *overrides.Tree, tplExt string) {
 	s.dataDir = dataDir
 	s.envDir = envDir
+	s.envTree = envTree
 	s.tplExt = tplExt
 
 	logger.Debug("template parsing started", "component", "template", "dir", dataDir)
@@ -155,48 +175,58 @@ func (s *ShoelacesTemplates) ParseTemplates(logger log.Logger, dataDir string, e
 		return err
 	}
 
-	tplScannerOverride := func(p string, info os.FileInfo, err error) error {
-		if strings.HasSuffix(p, tplExt) {
-			env := s.getEnvFromPath(p)
-			logger.Info("parsing override", "component", "template", "environment", env, "file", p)
+	tplScannerOverride := func(env string) filepath.WalkFunc {
+		return func(p string, info os.FileInfo, err error) error {
+			if strings.HasSuffix(p, tplExt) {
+				logger.Info("parsing override", "component", "template", "environment", env, "file", p)
 
-			if err := s.addTemplate(logger, p, env); err != nil {
-				logger.Error("parse template override failed", "component", "template", "err", err)
-				os.Exit(1)
+				if err := s.addTemplate(logger, p, env); err != nil {
+					logger.Error("parse template override failed", "component", "template", "err", err)
+					os.Exit(1)
+				}
 			}
+			return err
 		}
-		return err
 	}
 
 	if err := filepath.Walk(dataDir, tplScannerDefault); err != nil {
 		panic(err)
 	}
 	logger.Info("parsing override files", "component", "template", "dir", path.Join(dataDir, envDir))
-	if err := filepath.Walk(path.Join(dataDir, envDir), tplScannerOverride); err != nil {
-		logger.Info("no overrides found", "component", "template")
+	for _, env := range envTree.Names() {
+		s.addEnvironment(logger, env, envTree.Parent(env))
+		if err := filepath.Walk(path.Join(dataDir, envDir, env), tplScannerOverride(env)); err != nil {
+			logger.Info("no overrides found", "component", "template", "environment", env)
+		}
 	}
 	logger.Debug("template parsing ended", "component", "template")
 }
 
 // RenderTemplate receives a name and a map of parameters, among other
 // arguments, and returns the rendered template. It's aware of the
-// environment, in case of any.
-func (s *ShoelacesTemplates) RenderTemplate(logger log.Logger, configName string, paramMap map[string]interface{}, envName string) (string, error) {
+// environment, in case of any. The received parameters take precedence over
+// the default ones of the environment.
+func (s *ShoelacesTemplates) RenderTemplate(logger log.Logger, configName string, params map[string]interface{}, envName string) (string, error) {
 	if envName == "" {
 		envName = defaultEnvironment
 	}
-	logger.Info("template request", "component", "template", "template", configName, "env", envName, "parameters", utils.MapToString(paramMap))
+	paramMap := s.envTree.Params(envName)
+	for k, v := range params {
+		paramMap[k] = v
+	}
+	logger.Info("template request", "component", "template", "template", configName, "env", envName, "parameters", utils.MapToString(logger.Redactor().Params(paramMap)))
 
-	requiredVariables := s.envTemplates[envName].templateVars[configName]
+	envTemplates, ok := s.envTemplates[envName]
+	if !ok {
+		logger.Info("unknown environment", "component", "template", "env", envName)
+		return "", fmt.Errorf("Unknown environment: %s", envName)
+	}
+	requiredVariables := s.ListVariables(configName, envName)
 
+	// The template set of an environment already holds the templates
+	// inherited through its chain, so there is no need to fall back.
 	var b bytes.Buffer
-	err := s.envTemplates[envName].templateObj.ExecuteTemplate(&b, configName, paramMap)
-	// Fall back to default template in case this is non default environment
-	// XXX: this is temporary and will be simplified to reduce the code duplication
-	if err != nil && envName != defaultEnvironment {
-		requiredVariables = s.envTemplates[defaultEnvironment].templateVars[configName]
-		err = s.envTemplates[defaultEnvironment].templateObj.ExecuteTemplate(&b, configName, paramMap)
-	}
+	err := envTemplates.templateObj.ExecuteTemplate(&b, configName, paramMap)
 	if err != nil {
 		logger.Info("render template failed", "component", "template", "err", err)
 		return "", err
@@ -219,15 +249,88 @@ func (s *ShoelacesTemplates) RenderTemplate(logger log.Logger, configName string
 	return r, nil
 }
 
+// Has reports whether a template is defined in an environment, inherited
+// templates included.
+func (s *ShoelacesTemplates) Has(templateName, envName string) bool {
+	if envName == "" {
+		envName = defaultEnvironment
+	}
+	e, ok := s.envTemplates[envName]
+	return ok && e.templateObj.Lookup(templateName) != nil
+}
+
 // ListVariables receives a template name and return the list of variables
 // that belong to it. It's mainly used by the web frontend to provide a
-// list of dynamic fields to complete before rendering a template.
+// list of dynamic fields to complete before rendering a template. The
+// variables come from the closest environment in the inheritance chain
+// defining the template.
 func (s *ShoelacesTemplates) ListVariables(templateName, envName string) []string {
-	if e, ok := s.envTemplates[envName]; ok {
-		if v, ok := e.templateVars[templateName]; ok {
+	for _, e := range s.envTree.Chain(envName) {
+		if v, ok := s.envTemplates[e].templateVars[templateName]; ok {
 			return v
 		}
 	}
 	var empty []string
 	return empty
 }
+
+// Format returns the extension of the file a template is defined in,
+// without the template extension, e.g. ".ign" for flatcar.ign.slc. It
+// comes from the closest environment in the inheritance chain defining the
+// template.
+func (s *ShoelacesTemplates) Format(templateName, envName string) string {
+	for _, e := range s.envTree.Chain(envName) {
+		if f, ok := s.envTemplates[e].templateFormats[templateName]; ok {
+			return f
+		}
+	}
+	return ""
+}
+
+// Names returns the sorted names of the templates of an environment,
+// inherited templates included.
+func (s *ShoelacesTemplates) Names(envName string) []string {
+	var names []string
+	for _, e := range s.envTree.Chain(envName) {
+		for name := range s.envTemplates[e].templateVars {
+			if !utils.StringInSlice(name, names) {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ConfigReference is a link from a template to a config built with the
+// baseURL variable, as in http://{{.baseURL}}/configs/name. Names built with
+// template actions end before the first one.
+type ConfigReference struct {
+	Environment string
+	Template    string
+	Config      string
+}
+
+// ConfigReferences returns the links to configs of the templates of every
+// environment, sorted.
+func (s *ShoelacesTemplates) ConfigReferences() []ConfigReference {
+	var refs []ConfigReference
+	for envName, e := range s.envTemplates {
+		for name, configs := range e.templateRefs {
+			for _, config := range configs {
+				refs = append(refs, ConfigReference{Environment: envName, Template: name, Config: config})
+			}
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		a, b := refs[i], refs[j]
+		if a.Environment != b.Environment {
+			return a.Environment < b.Environment
+		}
+		if a.Template != b.Template {
+			return a.Template < b.Template
+		}
+		return a.Config < b.Config
+	})
+	return refs
+}
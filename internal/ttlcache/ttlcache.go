@@ -0,0 +1,96 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ttlcache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache holds values for a while, up to a number of entries. Once full, the
+// oldest entry is dropped for each new one. It's safe for concurrent use.
+type Cache[V any] struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List // Of *entry, oldest first
+}
+
+type entry[V any] struct {
+	key     string
+	value   V
+	expires time.Time
+}
+
+// New returns a Cache holding up to size entries.
+func New[V any](size int) *Cache[V] {
+	return &Cache[V]{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Get returns the value of key, if it's cached and not expired at now.
+func (c *Cache[V]) Get(key string, now time.Time) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	el, ok := c.entries[key]
+	if !ok {
+		return zero, false
+	}
+	e := el.Value.(*entry[V])
+	if now.After(e.expires) {
+		c.remove(el)
+		return zero, false
+	}
+	return e.value, true
+}
+
+// Set caches the value of key from now until ttl later.
+func (c *Cache[V]) Set(key string, value V, ttl time.Duration, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	// Drop the expired entries in front, and the oldest ones if still full.
+	for el := c.order.Front(); el != nil; el = c.order.Front() {
+		if len(c.entries) < c.size && !now.After(el.Value.(*entry[V]).expires) {
+			break
+		}
+		c.remove(el)
+	}
+	if c.size > 0 {
+		c.entries[key] = c.order.PushBack(&entry[V]{key: key, value: value, expires: now.Add(ttl)})
+	}
+}
+
+// Len returns the number of entries, expired ones included.
+func (c *Cache[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// remove drops an entry. The caller must hold the lock.
+func (c *Cache[V]) remove(el *list.Element) {
+	delete(c.entries, el.Value.(*entry[V]).key)
+	c.order.Remove(el)
+}
@@ -0,0 +1,66 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ttlcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGet(t *testing.T) {
+	c := New[string](10)
+	now := time.Unix(1000, 0)
+	c.Set("a", "1", time.Minute, now)
+	c.Set("b", "", time.Second, now)
+
+	if v, ok := c.Get("a", now.Add(time.Minute)); !ok || v != "1" {
+		t.Errorf("Expected: 1\nGot: %q %v", v, ok)
+	}
+	if v, ok := c.Get("b", now); !ok || v != "" {
+		t.Errorf("Expected: empty value cached\nGot: %q %v", v, ok)
+	}
+	if _, ok := c.Get("a", now.Add(time.Minute+time.Second)); ok {
+		t.Error("Expected: a expired\nGot: cached")
+	}
+	if _, ok := c.Get("c", now); ok {
+		t.Error("Expected: c not cached\nGot: cached")
+	}
+	if n := c.Len(); n != 1 {
+		t.Errorf("Expected: 1 entry left\nGot: %d", n)
+	}
+}
+
+func TestSize(t *testing.T) {
+	c := New[int](3)
+	now := time.Unix(1000, 0)
+	for i, key := range []string{"a", "b", "c", "a", "d"} {
+		c.Set(key, i, time.Minute, now)
+	}
+	// a was set again, so b is the oldest.
+	if _, ok := c.Get("b", now); ok {
+		t.Error("Expected: b dropped\nGot: cached")
+	}
+	for key, want := range map[string]int{"a": 3, "c": 2, "d": 4} {
+		if v, ok := c.Get(key, now); !ok || v != want {
+			t.Errorf("Expected: %d for %s\nGot: %d %v", want, key, v, ok)
+		}
+	}
+
+	// Expired entries are dropped first.
+	c.Set("e", 5, time.Minute, now.Add(2*time.Minute))
+	if n := c.Len(); n != 1 {
+		t.Errorf("Expected: 1 entry\nGot: %d", n)
+	}
+}
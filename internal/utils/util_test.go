@@ -37,3 +37,82 @@ func TestMacDashToColon(t *testing.T) {
 	testNormMac("ff-ff-ff-ff-ff-ff", "ff:ff:ff:ff:ff:ff")
 	testNormMac("ff.ff.ff.ff.ff.ff", "ff.ff.ff.ff.ff.ff")
 }
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := ParseNetworks("10.0.0.0/8, 192.0.2.1,2001:db8::1,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"10.0.0.0/8", "192.0.2.1/32", "2001:db8::1/128"}
+	if len(networks) != len(expected) {
+		t.Fatalf("Expected: %v\nGot: %v", expected, networks)
+	}
+	for i, n := range networks {
+		if n.String() != expected[i] {
+			t.Errorf("Expected: %s\nGot: %s", expected[i], n)
+		}
+	}
+	if !InNetworks("10.1.2.3", networks) || InNetworks("192.0.2.2", networks) || InNetworks("bogus", networks) {
+		t.Error("Expected: only addresses in the networks to match")
+	}
+
+	if _, err := ParseNetworks("10.0.0.0/33"); err == nil {
+		t.Error("Expected: error for invalid network\nGot: nil")
+	}
+	if _, err := ParseNetworks("bogus"); err == nil {
+		t.Error("Expected: error for invalid address\nGot: nil")
+	}
+}
+
+func TestNormalizeBaseURL(t *testing.T) {
+	cases := map[string]string{
+		"localhost:8081":              "localhost:8081",
+		"shoelaces.example.com":       "shoelaces.example.com",
+		"10.0.0.1:8081/prefix":        "10.0.0.1:8081/prefix",
+		"2001:db8::1":                 "[2001:db8::1]",
+		"[2001:DB8::1]":               "[2001:db8::1]",
+		"[2001:db8:0::1]:8081":        "[2001:db8::1]:8081",
+		"[2001:db8::1]:8081/env/prod": "[2001:db8::1]:8081/env/prod",
+		"[::ffff:10.0.0.1]:8081":      "10.0.0.1:8081",
+		":8081":                       ":8081",
+	}
+	for baseURL, expected := range cases {
+		if got, err := NormalizeBaseURL(baseURL); err != nil || got != expected {
+			t.Errorf("Expected: %s for %s\nGot: %s, %v", expected, baseURL, got, err)
+		}
+	}
+
+	for _, baseURL := range []string{"/prefix", "[2001:db8::1:8081", "host:80:80"} {
+		if _, err := NormalizeBaseURL(baseURL); err == nil {
+			t.Errorf("Expected: error for %s\nGot: nil", baseURL)
+		}
+	}
+}
+
+func TestBaseURLJoin(t *testing.T) {
+	cases := map[string]string{
+		"localhost:8081":       "http://localhost:8081/configs/a.ign?x=1",
+		"10.0.0.1:8081/prefix": "http://10.0.0.1:8081/prefix/configs/a.ign?x=1",
+		"[2001:db8::1]:8081":   "http://[2001:db8::1]:8081/configs/a.ign?x=1",
+	}
+	for baseURL, expected := range cases {
+		if u, err := BaseURLJoin(baseURL, "/configs/a.ign?x=1"); err != nil || u.String() != expected {
+			t.Errorf("Expected: %s for %s\nGot: %v, %v", expected, baseURL, u, err)
+		}
+	}
+}
+
+func TestNormalizeIP(t *testing.T) {
+	cases := map[string]string{
+		"10.0.0.1":        "10.0.0.1",
+		"2001:DB8:0::1":   "2001:db8::1",
+		"fe80::1%eth0":    "fe80::1",
+		"::ffff:10.0.0.1": "10.0.0.1",
+		"not an ip":       "not an ip",
+	}
+	for ip, expected := range cases {
+		if got := NormalizeIP(ip); got != expected {
+			t.Errorf("Expected: %s for %s\nGot: %s", expected, ip, got)
+		}
+	}
+}
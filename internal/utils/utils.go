@@ -17,6 +17,8 @@ package utils
 import (
 	"fmt"
 	"net"
+	"net/netip"
+	"net/url"
 	"path/filepath"
 	"strings"
 )
@@ -52,6 +54,19 @@ func KeyInMap(key string, mapInput map[string]interface{}) bool {
 	return found
 }
 
+// MergeMaps returns a new map with the entries of upper applied on top of
+// the ones of lower.
+func MergeMaps(lower, upper map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(lower)+len(upper))
+	for k, v := range lower {
+		result[k] = v
+	}
+	for k, v := range upper {
+		result[k] = v
+	}
+	return result
+}
+
 // MapToString provides a string representation of a map of strings.
 func MapToString(mapInput map[string]interface{}) string {
 	result := ""
@@ -64,6 +79,13 @@ func MapToString(mapInput map[string]interface{}) string {
 	return result
 }
 
+// BaseURLJoin returns the URL of p, an absolute path with an optional
+// query, on the Shoelaces instance at baseURL, a host with an optional port
+// and path as in the baseURL template variable. Shoelaces serves plain HTTP.
+func BaseURLJoin(baseURL, p string) (*url.URL, error) {
+	return url.Parse("http://" + baseURL + p)
+}
+
 // BaseURLforEnvName provides an environment-sensitive method for returning
 // the BaseURL of the application.
 func BaseURLforEnvName(baseURL, environment string) string {
@@ -73,14 +95,52 @@ func BaseURLforEnvName(baseURL, environment string) string {
 	return baseURL
 }
 
-// ResolveHostname receives an IP and returns the resolved PTR. It returns an
-// empty string in case the DNS lookup fails.
-func ResolveHostname(ip string) (host string) {
-	hosts, err := net.LookupAddr(ip)
+// NormalizeBaseURL receives a base URL, a host with an optional port and
+// path, and returns it with IPv6 literals in brackets, so it can follow
+// "http://" in URLs. An IPv6 literal with a port must be bracketed already,
+// as in "[2001:db8::1]:8081".
+func NormalizeBaseURL(baseURL string) (string, error) {
+	host, rest := baseURL, ""
+	if i := strings.Index(baseURL, "/"); i >= 0 {
+		host, rest = baseURL[:i], baseURL[i:]
+	}
+	if host == "" {
+		return "", fmt.Errorf("base URL %q has no host", baseURL)
+	}
+
+	literal := host
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		literal = host[1 : len(host)-1]
+	}
+	if addr, err := netip.ParseAddr(literal); err == nil {
+		if addr = addr.Unmap(); addr.Is6() {
+			return "[" + addr.String() + "]" + rest, nil
+		}
+		return addr.String() + rest, nil
+	}
+	if !strings.Contains(host, ":") {
+		return baseURL, nil
+	}
+
+	name, port, err := net.SplitHostPort(host)
 	if err != nil {
-		return ""
+		return "", fmt.Errorf("invalid base URL %q: %w", baseURL, err)
 	}
-	return hosts[0]
+	if addr, err := netip.ParseAddr(name); err == nil {
+		name = addr.Unmap().String()
+	}
+	return net.JoinHostPort(name, port) + rest, nil
+}
+
+// NormalizeIP returns the canonical form of an IP, without IPv6 zone and with
+// IPv4-mapped IPv6 addresses as IPv4, so the same host always gets the same
+// string. Invalid IPs are returned as they are.
+func NormalizeIP(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	return addr.Unmap().WithZone("").String()
 }
 
 // IsValidIP returns whether or not an IP is well-formed.
@@ -103,3 +163,47 @@ func MacColonToDash(mac string) string {
 func MacDashToColon(mac string) string {
 	return strings.Replace(mac, "-", ":", -1)
 }
+
+// ParseNetworks receives a comma separated list of networks in CIDR
+// notation, or single addresses, and returns the networks.
+func ParseNetworks(list string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, n := range strings.Split(list, ",") {
+		n = strings.TrimSpace(n)
+		if n == "" {
+			continue
+		}
+		if !strings.Contains(n, "/") {
+			ip := net.ParseIP(n)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", n)
+			}
+			if ip.To4() != nil {
+				n = ip.String() + "/32"
+			} else {
+				n = ip.String() + "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(n)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// InNetworks receives an IP and a list of networks and returns whether any
+// of the networks contains the IP.
+func InNetworks(ip string, networks []*net.IPNet) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, n := range networks {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
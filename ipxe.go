@@ -0,0 +1,88 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/thousandeyes/shoelaces/internal/ipxebin"
+	"github.com/thousandeyes/shoelaces/internal/utils"
+)
+
+const ipxeUsage = `usage: shoelaces ipxe placeholder > placeholder.ipxe
+       shoelaces ipxe embed [-base-url URL] < ipxe.efi > shoelaces.efi
+       shoelaces ipxe iso [-base-url URL] < ipxe.efi > shoelaces.iso
+       shoelaces ipxe usb [-base-url URL] < ipxe.efi > shoelaces.img
+
+The base URL defaults to the BASE_URL environment variable. Binaries must be
+built with the placeholder script to get a script embedded. Boot images get
+it as autoexec.ipxe as well.
+`
+
+// ipxeCommand prints the embedded script placeholder, and embeds the script
+// booting from Shoelaces in iPXE binaries or builds boot images with it,
+// from the standard input to the standard output.
+func ipxeCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, ipxeUsage)
+		os.Exit(2)
+	}
+
+	if args[0] == "placeholder" {
+		os.Stdout.Write(ipxebin.Placeholder())
+		return
+	}
+
+	var build func([]byte, string) ([]byte, error)
+	switch args[0] {
+	case "embed":
+		build = ipxebin.Embed
+	case "iso":
+		build = ipxebin.ISOImage
+	case "usb":
+		build = ipxebin.USBImage
+	default:
+		fmt.Fprint(os.Stderr, ipxeUsage)
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet("ipxe "+args[0], flag.ExitOnError)
+	baseURL := flags.String("base-url", os.Getenv("BASE_URL"), "The base Shoelaces URL booting hosts chain")
+	flags.Parse(args[1:])
+	if *baseURL == "" {
+		fmt.Fprintln(os.Stderr, "[*] base-url is required")
+		os.Exit(2)
+	}
+	url, err := utils.NormalizeBaseURL(*baseURL)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	in, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	out, err := build(in, ipxebin.StartScript(url))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(out)
+}
@@ -15,23 +15,51 @@
 package main
 
 import (
+	"net"
 	"net/http"
 	"os"
 
 	"github.com/thousandeyes/shoelaces/internal/environment"
 	"github.com/thousandeyes/shoelaces/internal/handlers"
+	"github.com/thousandeyes/shoelaces/internal/proxy"
 	"github.com/thousandeyes/shoelaces/internal/router"
 )
 
 var version = "dev"
 
+// commands holds the subcommands that can be given as first argument.
+// Without a subcommand, Shoelaces starts serving requests.
+var commands = map[string]func(args []string){
+	"assets":   assetsCommand,
+	"ipxe":     ipxeCommand,
+	"render":   renderCommand,
+	"secrets":  secretsCommand,
+	"validate": validate,
+}
+
 func main() {
-	env := environment.New()
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			command(os.Args[2:])
+			return
+		}
+	}
+
+	env := environment.New(os.Args[1:])
 	app := handlers.MiddlewareChain(env, router.ShoelacesRouter(env))
 
 	env.Logger.Info("starting", "component", "main", "version", version)
-	env.Logger.Info("listening", "component", "main", "transport", "http", "addr", env.BindAddr)
-	env.Logger.Error("server exited", "component", "main", "err", http.ListenAndServe(env.BindAddr, app))
+	listener, err := net.Listen("tcp", env.BindAddr)
+	if err != nil {
+		env.Logger.Error("listen failed", "component", "main", "err", err)
+		os.Exit(1)
+	}
+	if env.ProxyProtocol {
+		listener = proxy.NewListener(listener, env.TrustedNetworks)
+	}
+
+	env.Logger.Info("listening", "component", "main", "transport", "http", "addr", env.BindAddr, "proxy-protocol", env.ProxyProtocol)
+	env.Logger.Error("server exited", "component", "main", "err", http.Serve(listener, app))
 
 	os.Exit(1)
 }
@@ -0,0 +1,87 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/thousandeyes/shoelaces/internal/environment"
+	"github.com/thousandeyes/shoelaces/internal/handlers"
+)
+
+const renderUsage = `usage: shoelaces render [parameters] [-env name] config [name=value...]
+
+Renders a config the way it's served at /configs/config, with the given
+variables, and writes it to the standard output. Butane templates are
+transpiled and Ignition configs validated, with their local configs merged.
+The variables of the host identified by the mac, hostname, serial or uuid
+variables are used too. Takes the same parameters as the server, e.g.
+-data-dir, and -env to render the config of an environment.
+`
+
+// renderCommand renders a config template the way the configs endpoint
+// does, exiting with an error if it can't be rendered.
+func renderCommand(args []string) {
+	envName, args := envArg(args)
+	env, args := environment.LoadCommand(args)
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, renderUsage)
+		os.Exit(2)
+	}
+
+	query := url.Values{}
+	for _, arg := range args[1:] {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			fmt.Fprint(os.Stderr, renderUsage)
+			os.Exit(2)
+		}
+		query.Set(name, value)
+	}
+
+	params := handlers.ConfigParams(env, envName, query)
+	_, config, err := handlers.RenderConfig(env, envName, args[0], params)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Print(config)
+}
+
+// envArg removes the -env parameter from the arguments, returning its
+// value.
+func envArg(args []string) (string, []string) {
+	var envName string
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--":
+			return envName, append(rest, args[i:]...)
+		case arg == "-env" || arg == "--env":
+			if i+1 < len(args) {
+				envName = args[i+1]
+				i++
+			}
+		case strings.HasPrefix(arg, "-env=") || strings.HasPrefix(arg, "--env="):
+			_, envName, _ = strings.Cut(arg, "=")
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return envName, rest
+}
@@ -0,0 +1,78 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/thousandeyes/shoelaces/internal/secrets"
+)
+
+const secretsUsage = `usage: shoelaces secrets keygen
+       shoelaces secrets encrypt [-key KEY] < secrets.yaml > secrets.enc
+       shoelaces secrets decrypt [-key KEY] < secrets.enc > secrets.yaml
+
+The key defaults to the SECRETS_KEY environment variable.
+`
+
+// secretsCommand manages the encrypted secrets file read by the secret
+// template function. It generates keys and encrypts and decrypts from the
+// standard input to the standard output.
+func secretsCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, secretsUsage)
+		os.Exit(2)
+	}
+
+	if args[0] == "keygen" {
+		key, err := secrets.GenerateKey()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println(key)
+		return
+	}
+
+	var crypt func([]byte, string) ([]byte, error)
+	switch args[0] {
+	case "encrypt":
+		crypt = secrets.Encrypt
+	case "decrypt":
+		crypt = secrets.Decrypt
+	default:
+		fmt.Fprint(os.Stderr, secretsUsage)
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet("secrets "+args[0], flag.ExitOnError)
+	key := flags.String("key", os.Getenv("SECRETS_KEY"), "Key of the secrets file, 32 bytes encoded in base64")
+	flags.Parse(args[1:])
+
+	in, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	out, err := crypt(in, *key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(out)
+}
@@ -17,6 +17,7 @@
 """ Test shoelaces """
 
 import os
+import re
 import signal
 import shutil
 import subprocess
@@ -170,12 +171,18 @@ def test_unknown_server(shoelaces_instance):
     # Request for unknown host will give result in retries/polling
     with open(os.path.join(FIXTURE_DIR, "poll-unknown.txt")) as poll:
         assert requests.get(poll_url).text == poll.read()
-    # Setting the config for the new host should succeed.
-    requests.post(API_URL + '/update/target',
-                  {"target": "flatcar.ipxe",
-                   "mac": "06:66:de:ad:be:ef",
-                   "version": "666.0",
-                   "cloudconfig": "virtual"}).raise_for_status()
+    # Setting the config for the new host without a CSRF token should fail.
+    form = {"target": "flatcar.ipxe",
+            "mac": "06:66:de:ad:be:ef",
+            "version": "666.0",
+            "cloudconfig": "virtual"}
+    assert requests.post(API_URL + '/update/target', form).status_code == 403
+    # Setting it with the token of the home page should succeed.
+    session = requests.Session()
+    page = session.get(API_URL + '/')
+    page.raise_for_status()
+    form["csrf_token"] = re.search(r'name="csrf_token" value="([0-9a-f]+)"', page.text).group(1)
+    session.post(API_URL + '/update/target', form).raise_for_status()
     # After setting we should be able to get the new config.
     with open(os.path.join(FIXTURE_DIR, "poll-unknown-set-from-ui.txt")) as poll:
         assert requests.get(poll_url).text == poll.read()
@@ -0,0 +1,81 @@
+// Copyright 2018-2026 ThousandEyes Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/url"
+	"os"
+
+	"github.com/thousandeyes/shoelaces/internal/environment"
+	"github.com/thousandeyes/shoelaces/internal/handlers"
+	"github.com/thousandeyes/shoelaces/internal/ipxe"
+)
+
+// validate loads the data dir the same way the server does, without
+// serving requests. Loading exits with an error if anything is wrong, such
+// as unparsable templates or mappings, environment inheritance cycles,
+// host files sharing a key, invalid iPXE menus, invalid assets or invalid
+// Butane and Ignition configs, or links to signed configs without a
+// signature.
+func validate(args []string) {
+	env := environment.Load(args)
+
+	for _, name := range append([]string{""}, env.Environments...) {
+		if _, err := ipxe.BuildMenu(env, name); err != nil {
+			env.Logger.Error("invalid ipxe menu", "component", "validate", "environment", name, "err", err)
+			os.Exit(1)
+		}
+	}
+
+	valid := true
+	for _, name := range append([]string{""}, env.Environments...) {
+		valid = validateIgnition(env, name) && valid
+	}
+	if !valid {
+		os.Exit(1)
+	}
+
+	env.Logger.Info("data dir is valid", "component", "validate",
+		"dir", env.DataDir,
+		"environments", len(env.Environments),
+		"network-maps", len(env.NetworkMaps),
+		"hostname-maps", len(env.HostnameMaps),
+		"hosts", len(env.Hosts.List()))
+}
+
+// validateIgnition renders the Butane and Ignition configs of an
+// environment, with their local configs merged, and reports the invalid
+// ones. Their variables without a default value are set to their name.
+func validateIgnition(env *environment.Environment, envName string) bool {
+	valid := true
+	defaults := env.Overrides.Params(envName)
+	for _, config := range env.Templates.Names(envName) {
+		if !handlers.IsIgnition(env, config, envName) {
+			continue
+		}
+		query := url.Values{}
+		for _, v := range env.Templates.ListVariables(config, envName) {
+			if _, ok := defaults[v]; !ok {
+				query.Set(v, v)
+			}
+		}
+		params := handlers.ConfigParams(env, envName, query)
+		if _, _, err := handlers.RenderConfig(env, envName, config, params); err != nil {
+			env.Logger.Error("invalid ignition config", "component", "validate", "environment", envName, "config", config, "err", err)
+			valid = false
+		}
+	}
+	return valid
+}
@@ -27,6 +27,15 @@ document.addEventListener('DOMContentLoaded', function () {
         target.addEventListener('change', scriptSelection);
     }
 
+    var systems = document.getElementById('systems');
+    if (systems) {
+        systems.addEventListener('submit', updateTargets);
+    }
+
+    document.querySelectorAll('.pending-edit').forEach(function (button) {
+        button.addEventListener('click', editPending);
+    });
+
     window.setTimeout(function () {
         document.querySelectorAll('.alert').forEach(fadeOutAndRemove);
     }, 3000);
@@ -112,8 +121,11 @@ function updateHostnames() {
 
     fetchJSON('/ajax/servers')
         .then(function (systems) {
-            var selected = macs.options[macs.selectedIndex];
-            var selection = selected ? selected.textContent : '';
+            var selection = Array.prototype.filter.call(macs.options, function (option) {
+                return option.selected;
+            }).map(function (option) {
+                return option.value;
+            });
 
             macs.textContent = '';
 
@@ -137,7 +149,7 @@ function updateHostnames() {
                 option.className = 'text-primary-custom';
                 option.value = system.Mac;
                 option.textContent = systemText;
-                option.selected = systemText === selection;
+                option.selected = selection.indexOf(system.Mac) !== -1;
                 macs.appendChild(option);
             });
         })
@@ -145,6 +157,10 @@ function updateHostnames() {
 }
 
 function scriptSelection() {
+    loadScriptParams({});
+}
+
+function loadScriptParams(values) {
     var paramsElems = document.querySelector('.params-container');
     var target = document.querySelector('select[name="target"]');
 
@@ -182,6 +198,11 @@ function scriptSelection() {
                 input.name = param;
                 input.placeholder = param;
                 input.required = true;
+                // Masked values must be typed again, or the mask would
+                // replace the secret.
+                if (values[param] !== undefined && values[param] !== '******') {
+                    input.value = values[param];
+                }
 
                 col.appendChild(input);
                 paramsElems.appendChild(col);
@@ -196,14 +217,111 @@ function scriptSelection() {
         .catch(logFetchError);
 }
 
+function updateTargets(event) {
+    var form = event.currentTarget;
+
+    event.preventDefault();
+
+    fetch(form.action, {
+        method: 'POST',
+        headers: {
+            'Accept': 'application/json',
+        },
+        body: new URLSearchParams(new FormData(form)),
+    }).then(function (response) {
+        if (!response.ok) {
+            return response.text().then(function (text) {
+                throw new Error(text);
+            });
+        }
+        return response.json();
+    }).then(function (results) {
+        showTargetResults(results, null);
+        updateHostnames();
+    }).catch(function (error) {
+        showTargetResults([], error);
+    });
+}
+
+function showTargetResults(results, error) {
+    var container = document.querySelector('.target-results');
+    if (!container) {
+        return;
+    }
+
+    var card = document.createElement('div');
+    var header = document.createElement('h5');
+    var list = document.createElement('ul');
+
+    card.className = 'card';
+    header.className = 'card-header text-primary-custom';
+    header.textContent = 'Results';
+    list.className = 'list-group list-group-flush';
+
+    if (error) {
+        results = [{ Server: { Mac: '' }, Error: error.message }];
+    } else if (results.length === 0) {
+        results = [{ Server: { Mac: '' }, Error: 'No waiting servers matched' }];
+    }
+
+    results.forEach(function (result) {
+        var item = document.createElement('li');
+        var mac = document.createElement('b');
+        var text = result.Error ? result.Error : 'booting with ' +
+            Object.keys(result.Params || {}).map(function (k) {
+                return k + ': ' + result.Params[k];
+            }).join(', ');
+
+        item.className = 'list-group-item' + (result.Error ? ' text-danger' : '');
+        mac.textContent = result.Server.Mac;
+
+        item.appendChild(mac);
+        item.appendChild(document.createTextNode((result.Server.Mac ? ': ' : '') + text));
+        list.appendChild(item);
+    });
+
+    card.appendChild(header);
+    card.appendChild(list);
+    container.textContent = '';
+    container.appendChild(card);
+}
+
+function editPending(event) {
+    var mac = event.currentTarget.dataset.mac;
+
+    fetchJSON('/ajax/pending')
+        .then(function (pending) {
+            var assignment = pending.find(function (a) {
+                return a.Mac === mac;
+            });
+            var target = document.getElementById('target');
+
+            if (!assignment || !target) {
+                return;
+            }
+
+            document.getElementById('mac').value = assignment.Mac;
+            Array.prototype.forEach.call(target.options, function (option) {
+                option.selected = option.dataset.script === assignment.Target &&
+                    (option.dataset.env || '') === assignment.Environment;
+            });
+            loadScriptParams(assignment.Params || {});
+            window.scrollTo(0, 0);
+        })
+        .catch(logFetchError);
+}
+
 function updateEventHistory() {
     var eventLogContainer = document.querySelector('.event-log');
     if (!eventLogContainer) {
         return;
     }
 
-    fetchJSON('/ajax/events')
-        .then(function (events) {
+    Promise.all([fetchJSON('/ajax/events'), fetchJSON('/ajax/timelines')])
+        .then(function (results) {
+            var events = results[0];
+            var timelines = results[1] || {};
+
             if (!events) {
                 return;
             }
@@ -211,13 +329,29 @@ function updateEventHistory() {
             eventLogContainer.textContent = '';
 
             Object.keys(events).forEach(function (mac) {
-                eventLogContainer.appendChild(createEventCard(mac, events[mac]));
+                eventLogContainer.appendChild(createEventCard(mac, events[mac], timelines[mac]));
             });
         })
         .catch(logFetchError);
 }
 
-function createEventCard(mac, events) {
+function timelineStatus(timeline) {
+    if (!timeline) {
+        return '';
+    }
+
+    var phase = timeline.phases.length > 0 ? timeline.phases[timeline.phases.length - 1].phase : '';
+
+    if (timeline.done) {
+        return 'done: ' + phase;
+    }
+    if (timeline.stuck) {
+        return 'stuck' + (phase ? ' at ' + phase : '');
+    }
+    return phase ? 'in progress: ' + phase : 'booting ' + timeline.script;
+}
+
+function createEventCard(mac, events, timeline) {
     var card = document.createElement('div');
     var header = document.createElement('h5');
     var body = document.createElement('div');
@@ -229,6 +363,15 @@ function createEventCard(mac, events) {
     header.className = 'card-header text-primary-custom';
     header.textContent = eventTitle(mac, events);
 
+    var status = timelineStatus(timeline);
+    if (status) {
+        var badge = document.createElement('span');
+
+        badge.className = timeline.stuck && !timeline.done ? 'text-danger' : 'text-muted';
+        badge.textContent = ' [' + status + ']';
+        header.appendChild(badge);
+    }
+
     body.className = 'card-body';
     list.className = 'list-group list-group-flush';
 
@@ -267,6 +410,10 @@ function createEventItem(event) {
     item.className = 'list-group-item';
     date.textContent = new Date(event.date).toLocaleString();
 
+    if (event.eventType === 5) {
+        item.classList.add('text-danger');
+    }
+
     item.appendChild(date);
     item.appendChild(document.createTextNode(': ' + event.message));
 